@@ -0,0 +1,214 @@
+package analysis
+
+import (
+	"leopard/ast"
+	"leopard/lexer"
+	"leopard/parser"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+// offsetOf returns the offset of the n-th occurrence (starting at 1) of
+// the word in input.
+func offsetOf(t *testing.T, input, word string, n int) int {
+	matches := regexp.MustCompile(`\b`+word+`\b`).FindAllStringIndex(input, -1)
+	if len(matches) < n {
+		t.Fatalf("occurrence %d of %q not found", n, word)
+	}
+	return matches[n-1][0]
+}
+
+func TestDefinition(t *testing.T) {
+	input := `let x = 1;
+let outer = fn(x) {
+  let inner = fn(y) { x + y + z };
+  inner(2)
+};
+let a = x;
+let a = a + 1;
+let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+later(a.x, len(a));
+fn later(v) { v }
+let [head, ...tail] = [1, 2];
+head + len(tail);
+for (head in tail) { let sq = head * head; puts(sq) }
+for (tail in tail) { tail }
+for (idx, head in tail) { idx + head }
+sq`
+
+	program := parse(t, input)
+
+	tests := []struct {
+		use           string
+		occurrence    int
+		def           string // the defining word, or "" for none
+		defOccurrence int
+	}{
+		{"x", 3, "x", 2}, // in the nested function, the parameter of outer
+		{"y", 2, "y", 1}, // parameter of inner
+		{"x", 4, "x", 1}, // let a = x uses the global
+		{"a", 3, "a", 1}, // the value of a let sees the previous binding
+		{"a", 4, "a", 2}, // afterwards the latest binding wins
+		{"fact", 2, "fact", 1},
+		{"inner", 2, "inner", 1},
+		{"later", 1, "later", 2}, // top-level functions are hoisted
+		{"outer", 1, "outer", 1}, // a definition resolves to itself
+		{"z", 1, "", 0},          // undefined
+		{"len", 1, "", 0},        // builtin
+		{"x", 5, "", 0},          // property of a member expression
+		{"head", 2, "head", 1},   // names bound by a pattern
+		{"tail", 2, "tail", 1},
+		{"head", 4, "head", 3}, // loop variables are bound in the body
+		{"head", 5, "head", 3},
+		{"sq", 2, "sq", 1},
+		{"tail", 3, "tail", 1}, // the iterable is outside the loop's scope
+		{"tail", 5, "tail", 1},
+		{"tail", 6, "tail", 4},
+		{"idx", 2, "idx", 1}, // both variables of a two-variable loop
+		{"head", 7, "head", 6},
+		{"sq", 3, "", 0}, // lets in a loop body stay in it
+	}
+
+	for _, tt := range tests {
+		offset := offsetOf(t, input, tt.use, tt.occurrence)
+		def := Definition(program, offset)
+
+		if tt.def == "" {
+			if def != nil {
+				t.Errorf("%s@%d: expected no definition, got %s at %d", tt.use, tt.occurrence, def.Value, def.Pos())
+			}
+			continue
+		}
+
+		expected := offsetOf(t, input, tt.def, tt.defOccurrence)
+		if def == nil {
+			t.Errorf("%s@%d: expected definition at %d, got nil", tt.use, tt.occurrence, expected)
+			continue
+		}
+		if def.Pos() != expected {
+			t.Errorf("%s@%d: wrong definition. expected offset %d, got %d", tt.use, tt.occurrence, expected, def.Pos())
+		}
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	input := `let limit = 10;
+let scale = fn(factor, values) {
+  let total = 0;
+  CURSOR
+  let after = 1;
+};
+let unrelated = fn(other) { other };`
+
+	offset := strings.Index(input, "CURSOR")
+	completions := Completions(strings.Replace(input, "CURSOR", "      ", 1), offset)
+
+	has := make(map[string]bool)
+	for _, name := range completions {
+		has[name] = true
+	}
+
+	// unrelated is a top-level function and so hoisted.
+	for _, name := range []string{"factor", "values", "total", "limit", "scale", "unrelated", "len", "math", "let", "fn"} {
+		if !has[name] {
+			t.Errorf("completions missing %q: %v", name, completions)
+		}
+	}
+	for _, name := range []string{"after", "other"} {
+		if has[name] {
+			t.Errorf("completions contain out of scope %q", name)
+		}
+	}
+}
+
+func TestCompletionsIncompleteSource(t *testing.T) {
+	input := "let base = 2;\nfn pow(exponent) {\n  let = ;\n  base * "
+
+	completions := Completions(input, len(input))
+
+	has := make(map[string]bool)
+	for _, name := range completions {
+		has[name] = true
+	}
+	for _, name := range []string{"base", "pow", "exponent"} {
+		if !has[name] {
+			t.Errorf("completions missing %q: %v", name, completions)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	input := `let unused = 1;
+let used = 2;
+puts(used + missing);
+let broken = ;`
+
+	expected := []Diagnostic{
+		{
+			Range:    Range{Start: Position{4, 1, 5}, End: Position{10, 1, 11}},
+			Severity: Warning,
+			Message:  "unused declared and not used",
+		},
+		{
+			Range:    Range{Start: Position{42, 3, 13}, End: Position{49, 3, 20}},
+			Severity: Error,
+			Message:  "identifier not found: missing",
+		},
+		{
+			Range:    Range{Start: Position{56, 4, 5}, End: Position{62, 4, 11}},
+			Severity: Warning,
+			Message:  "broken declared and not used",
+		},
+		{
+			Range:    Range{Start: Position{65, 4, 14}, End: Position{66, 4, 15}},
+			Severity: Error,
+			Message:  "no prefix parse function for ; found",
+		},
+	}
+
+	diagnostics := Diagnostics(input)
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. expected=%d, got=%d: %+v", len(expected), len(diagnostics), diagnostics)
+	}
+	for i, d := range diagnostics {
+		if d != expected[i] {
+			t.Errorf("diagnostics[%d] wrong.\nexpected=%+v\ngot=%+v", i, expected[i], d)
+		}
+	}
+}
+
+func TestDiagnosticsThrowaway(t *testing.T) {
+	input := `let [_, x] = [1, 2];
+let _ = 3;
+let {a: _} = {"a": 4};
+puts(x, _);`
+
+	expected := []Diagnostic{
+		{
+			Range:    Range{Start: Position{63, 4, 9}, End: Position{64, 4, 10}},
+			Severity: Error,
+			Message:  "cannot use _ as a value",
+		},
+	}
+
+	diagnostics := Diagnostics(input)
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. expected=%d, got=%d: %+v", len(expected), len(diagnostics), diagnostics)
+	}
+	for i, d := range diagnostics {
+		if d != expected[i] {
+			t.Errorf("diagnostics[%d] wrong.\nexpected=%+v\ngot=%+v", i, expected[i], d)
+		}
+	}
+}
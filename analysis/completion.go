@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	"leopard/evaluator"
+	"leopard/lexer"
+	"leopard/parser"
+	"leopard/token"
+	"sort"
+)
+
+// Completions returns the names that can be typed at offset in src: the
+// variables, parameters and functions in scope there, the builtins and the
+// keywords, sorted and without duplicates. Parse errors are ignored, so
+// completions are still offered for incomplete source; whatever the parser
+// recovered determines the scope.
+func Completions(src string, offset int) []string {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	seen := make(map[string]bool)
+	_, scopes := locate(program, offset)
+	for _, s := range scopes {
+		for _, name := range s.visible(offset) {
+			seen[name] = true
+		}
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		seen[name] = true
+	}
+	for _, name := range token.Keywords() {
+		seen[name] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// visible returns the names bound in s that can be used at offset.
+func (s *scope) visible(offset int) []string {
+	names := []string{}
+
+	for _, param := range s.params {
+		names = append(names, param.Value)
+	}
+	if s.self != nil {
+		names = append(names, s.self.Value)
+	}
+	for _, def := range s.defs {
+		if def.hoisted || def.stmt.End() <= offset {
+			names = append(names, def.name.Value)
+		}
+	}
+
+	return names
+}
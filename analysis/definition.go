@@ -0,0 +1,212 @@
+/*
+Package analysis provides static analysis of Leopard programs for editor
+integrations, such as resolving identifiers to their definitions.
+
+Scopes follow the evaluator: the program, each function body and each loop
+body have their own scope, while the blocks of an if expression share the
+scope they appear in. Loop variables are visible in the loop body. A let
+statement makes its name visible to the code after it, except that
+a function bound by let or declared with fn can refer to itself. Functions
+declared at the top level of the program are visible throughout it.
+*/
+package analysis
+
+import "leopard/ast"
+
+// scope is the program, a function literal or a loop, together with the
+// bindings it introduces.
+type scope struct {
+	params []*ast.Identifier
+	self   *ast.Identifier // the name a function is bound to, if any
+	defs   []definition
+}
+
+// definition is a name bound by a let, destructuring let or fn statement.
+type definition struct {
+	name    *ast.Identifier
+	stmt    ast.Statement
+	hoisted bool
+}
+
+// Definition returns the identifier that defines the variable referred to
+// at offset in program, which may be the identifier at offset itself if it
+// is a definition. It returns nil if there is no identifier at offset, or
+// if it refers to a builtin or to an undefined variable.
+func Definition(program *ast.Program, offset int) *ast.Identifier {
+	use, scopes := locate(program, offset)
+	if use == nil {
+		return nil
+	}
+
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if def := scopes[i].lookup(use); def != nil {
+			return def
+		}
+	}
+
+	return nil
+}
+
+// locate finds the identifier at offset and the scopes enclosing it, from
+// the outermost to the innermost. Property names in member expressions are
+// not variables and are not returned.
+func locate(program *ast.Program, offset int) (*ast.Identifier, []*scope) {
+	scopes := []*scope{programScope(program)}
+	names := make(map[*ast.FunctionLiteral]*ast.Identifier)
+	var use *ast.Identifier
+
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		if offset < node.Pos() || offset >= node.End() {
+			_, isProgram := node.(*ast.Program)
+			return isProgram
+		}
+
+		switch node := node.(type) {
+		case *ast.Identifier:
+			use = node
+		case *ast.LetStatement:
+			if lit, ok := node.Value.(*ast.FunctionLiteral); ok {
+				names[lit] = node.Name
+			}
+		case *ast.FunctionStatement:
+			names[node.Function] = node.Name
+		case *ast.FunctionLiteral:
+			scopes = append(scopes, functionScope(node, names[node]))
+		case *ast.ForInStatement:
+			// The iterable is evaluated outside the loop's scope.
+			if node.Iterable == nil || offset < node.Iterable.Pos() || offset >= node.Iterable.End() {
+				scopes = append(scopes, loopScope(node))
+			}
+		case *ast.MemberExpression:
+			ast.Inspect(node.Object, visit)
+			return false
+		}
+		return true
+	}
+	ast.Inspect(program, visit)
+
+	return use, scopes
+}
+
+// programScope returns the scope of the top level of a program.
+func programScope(program *ast.Program) *scope {
+	s := &scope{defs: collectDefinitions(program.Statements)}
+
+	for i, def := range s.defs {
+		switch stmt := def.stmt.(type) {
+		case *ast.FunctionStatement:
+			s.defs[i].hoisted = isTopLevel(program, stmt)
+		case *ast.LetStatement:
+			_, isFunction := stmt.Value.(*ast.FunctionLiteral)
+			s.defs[i].hoisted = isFunction && isTopLevel(program, stmt)
+		}
+	}
+
+	return s
+}
+
+// functionScope returns the scope of a function's parameters and body.
+func functionScope(lit *ast.FunctionLiteral, self *ast.Identifier) *scope {
+	s := &scope{params: lit.Parameters, self: self}
+	if lit.Body != nil {
+		s.defs = collectDefinitions(lit.Body.Statements)
+	}
+	return s
+}
+
+// loopScope returns the scope of a for-in loop's variables and body.
+func loopScope(stmt *ast.ForInStatement) *scope {
+	s := &scope{params: []*ast.Identifier{stmt.Variable}}
+	if stmt.Key != nil {
+		s.params = []*ast.Identifier{stmt.Key, stmt.Variable}
+	}
+	if stmt.Body != nil {
+		s.defs = collectDefinitions(stmt.Body.Statements)
+	}
+	return s
+}
+
+// collectDefinitions returns the let and fn statements among stmts and
+// the blocks nested in them, without entering function literals or loops.
+func collectDefinitions(stmts []ast.Statement) []definition {
+	defs := []definition{}
+
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.LetStatement:
+				defs = append(defs, definition{name: node.Name, stmt: node})
+			case *ast.DestructuringStatement:
+				for _, name := range node.Pattern.Names() {
+					defs = append(defs, definition{name: name, stmt: node})
+				}
+			case *ast.FunctionStatement:
+				defs = append(defs, definition{name: node.Name, stmt: node})
+				return false
+			case *ast.FunctionLiteral, *ast.ForInStatement:
+				return false
+			}
+			return true
+		})
+	}
+
+	return defs
+}
+
+// isTopLevel reports whether stmt is one of the program's own statements.
+func isTopLevel(program *ast.Program, stmt ast.Statement) bool {
+	for _, s := range program.Statements {
+		if s == stmt {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the binding in s that use refers to, or nil if s does not
+// bind it. The latest definition completed before use wins, then the
+// parameters, then the function's own name and finally hoisted functions.
+func (s *scope) lookup(use *ast.Identifier) *ast.Identifier {
+	for _, param := range s.params {
+		if param == use {
+			return use
+		}
+	}
+	for _, def := range s.defs {
+		if def.name == use {
+			return use
+		}
+	}
+
+	var found *ast.Identifier
+	for _, def := range s.defs {
+		if def.name.Value == use.Value && def.stmt.End() <= use.Pos() {
+			found = def.name
+		}
+	}
+	if found != nil {
+		return found
+	}
+
+	for _, param := range s.params {
+		if param.Value == use.Value {
+			found = param
+		}
+	}
+	if found != nil {
+		return found
+	}
+
+	if s.self != nil && s.self.Value == use.Value {
+		return s.self
+	}
+
+	for _, def := range s.defs {
+		if def.hoisted && def.name.Value == use.Value {
+			found = def.name
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,192 @@
+package analysis
+
+import (
+	"leopard/ast"
+	"leopard/evaluator"
+	"leopard/lexer"
+	"leopard/parser"
+	"leopard/token"
+	"sort"
+)
+
+// Severity tells how serious a Diagnostic is.
+type Severity string
+
+// Diagnostic severities.
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// Position is a location in source, as a 0-based byte offset and the
+// corresponding 1-based line and column.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Range is the span of source from Start up to but not including End.
+type Range struct {
+	Start Position
+	End   Position
+}
+
+// Diagnostic is a problem found in source, as reported to an editor.
+type Diagnostic struct {
+	Range    Range
+	Severity Severity
+	Message  string
+}
+
+// Diagnostics parses and checks src and returns every problem found,
+// ordered by position: parse errors, uses of undefined variables, variables
+// bound with let that are never used, and the parser's warnings.
+func Diagnostics(src string) []Diagnostic {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	diagnostics := []Diagnostic{}
+	add := func(start, end int, severity Severity, message string) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    Range{Start: position(src, start), End: position(src, end)},
+			Severity: severity,
+			Message:  message,
+		})
+	}
+
+	for _, msg := range p.ErrorMessages() {
+		add(msg.Token.Offset, tokenEnd(src, msg.Token), Error, msg.Text)
+	}
+	for _, msg := range p.WarningMessages() {
+		add(msg.Token.Offset, tokenEnd(src, msg.Token), Warning, msg.Text)
+	}
+	for _, ident := range undefinedVariables(program) {
+		if ident.Value == evaluator.Throwaway {
+			add(ident.Pos(), ident.End(), Error, "cannot use _ as a value")
+			continue
+		}
+		add(ident.Pos(), ident.End(), Error, "identifier not found: "+ident.Value)
+	}
+	for _, ident := range unusedVariables(program) {
+		add(ident.Pos(), ident.End(), Warning, ident.Value+" declared and not used")
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Range.Start.Offset < diagnostics[j].Range.Start.Offset
+	})
+
+	return diagnostics
+}
+
+// references maps every identifier in program that refers to a variable,
+// excluding definitions and property names, to its definition, which is
+// nil for builtins and undefined variables.
+func references(program *ast.Program) map[*ast.Identifier]*ast.Identifier {
+	refs := make(map[*ast.Identifier]*ast.Identifier)
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if member, ok := node.(*ast.MemberExpression); ok {
+			ast.Inspect(member.Object, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Identifier); ok {
+					refs[ident] = nil
+				}
+				return true
+			})
+			return false
+		}
+		if ident, ok := node.(*ast.Identifier); ok {
+			refs[ident] = nil
+		}
+		return true
+	})
+
+	for ident := range refs {
+		def := Definition(program, ident.Pos())
+		if def == ident {
+			delete(refs, ident)
+			continue
+		}
+		refs[ident] = def
+	}
+
+	return refs
+}
+
+// undefinedVariables returns the identifiers in program that refer to
+// neither a definition nor a builtin, in source order. Reading the
+// throwaway identifier always counts, since binding it binds nothing.
+func undefinedVariables(program *ast.Program) []*ast.Identifier {
+	builtins := make(map[string]bool)
+	for _, name := range evaluator.BuiltinNames() {
+		builtins[name] = true
+	}
+
+	undefined := []*ast.Identifier{}
+	for ident, def := range references(program) {
+		if (def == nil && !builtins[ident.Value]) || ident.Value == evaluator.Throwaway {
+			undefined = append(undefined, ident)
+		}
+	}
+	sortIdentifiers(undefined)
+
+	return undefined
+}
+
+// unusedVariables returns the names bound by let statements in program
+// that are never referred to, in source order, other than the throwaway
+// identifier.
+func unusedVariables(program *ast.Program) []*ast.Identifier {
+	used := make(map[*ast.Identifier]bool)
+	for _, def := range references(program) {
+		used[def] = true
+	}
+
+	unused := []*ast.Identifier{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if !used[node.Name] && node.Name.Value != evaluator.Throwaway {
+				unused = append(unused, node.Name)
+			}
+		case *ast.DestructuringStatement:
+			for _, name := range node.Pattern.Names() {
+				if !used[name] && name.Value != evaluator.Throwaway {
+					unused = append(unused, name)
+				}
+			}
+		}
+		return true
+	})
+
+	return unused
+}
+
+// sortIdentifiers sorts identifiers by their position.
+func sortIdentifiers(idents []*ast.Identifier) {
+	sort.Slice(idents, func(i, j int) bool { return idents[i].Pos() < idents[j].Pos() })
+}
+
+// tokenEnd returns the offset just after tok in src.
+func tokenEnd(src string, tok token.Token) int {
+	end := tok.Offset + tok.Len()
+	if end > len(src) {
+		end = len(src)
+	}
+	return end
+}
+
+// position converts an offset in src into a Position.
+func position(src string, offset int) Position {
+	pos := Position{Offset: offset, Line: 1, Column: 1}
+	for i := 0; i < offset && i < len(src); i++ {
+		if src[i] == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
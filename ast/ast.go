@@ -16,10 +16,14 @@ import (
 	"strings"
 )
 
-// Node interface represents a generic node in the AST
+// Node interface represents a generic node in the AST. Pos and End return
+// the byte offsets of the first character of the node's source and of the
+// character just after it.
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() int
+	End() int
 }
 
 // Statement interface represents a statement node in the AST
@@ -59,6 +63,62 @@ type LetStatement struct {
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
+// DestructuringStatement represents a 'let' statement that binds the parts
+// of a value to the names in a pattern, as in let [a, b] = pair;.
+type DestructuringStatement struct {
+	Token   token.Token // the token.LET token
+	Pattern Pattern
+	Value   Expression
+}
+
+// Implementing methods for DestructuringStatement.
+func (ds *DestructuringStatement) statementNode()       {}
+func (ds *DestructuringStatement) TokenLiteral() string { return ds.Token.Literal }
+
+// Pattern is the left-hand side of a destructuring let statement.
+type Pattern interface {
+	Node
+	patternNode()
+	// Names returns the identifiers the pattern binds, in source order.
+	Names() []*Identifier
+}
+
+// ArrayPattern represents an array pattern such as [head, ...tail]. The
+// elements bind to Elements in order and Rest, if present, binds to an
+// array of the remaining ones.
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []*Identifier
+	Rest     *Identifier
+	Rbracket int // offset of the closing ']'
+}
+
+// Implementing methods for ArrayPattern.
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) Names() []*Identifier {
+	names := append([]*Identifier{}, ap.Elements...)
+	if ap.Rest != nil {
+		names = append(names, ap.Rest)
+	}
+	return names
+}
+
+// HashPattern represents a hash pattern such as {name, age: years}. The
+// value of the string key Keys[i] binds to Values[i], which has the same
+// name as the key unless the pattern renames it.
+type HashPattern struct {
+	Token  token.Token // the '{' token
+	Keys   []string
+	Values []*Identifier
+	Rbrace int // offset of the closing '}'
+}
+
+// Implementing methods for HashPattern.
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) Names() []*Identifier { return hp.Values }
+
 // Identifier represents a variable identifier in the AST.
 type Identifier struct {
 	Token token.Token // the token.IDENT token
@@ -79,6 +139,66 @@ type ReturnStatement struct {
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
 
+// DeferStatement represents a defer statement, which queues its expression
+// to be evaluated when the enclosing function returns.
+type DeferStatement struct {
+	Token      token.Token // the 'defer' token
+	Expression Expression
+}
+
+// Implementing methods for a defer statement
+func (ds *DeferStatement) statementNode()       {}
+func (ds *DeferStatement) TokenLiteral() string { return ds.Token.Literal }
+
+// YieldStatement represents a yield statement, which hands a value to the
+// caller of a generator and suspends it until the next value is requested.
+type YieldStatement struct {
+	Token token.Token // the 'yield' token
+	Value Expression
+}
+
+// Implementing methods for a yield statement
+func (ys *YieldStatement) statementNode()       {}
+func (ys *YieldStatement) TokenLiteral() string { return ys.Token.Literal }
+
+// ForInStatement represents a loop over the elements of a collection, as
+// in for (x in xs) { ... } or for (i, x in xs) { ... }. Key, if present, is
+// bound to the index or hash key and Variable to the element or value,
+// afresh on each iteration.
+type ForInStatement struct {
+	Token    token.Token // the 'for' token
+	Key      *Identifier
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+// Implementing methods for a for-in statement
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+
+// BreakStatement represents a break statement, which ends the innermost
+// enclosing loop.
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+}
+
+// Implementing methods for a break statement
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return bs.TokenLiteral() + ";" }
+
+// ContinueStatement represents a continue statement, which skips to the
+// next iteration of the innermost enclosing loop.
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+}
+
+// Implementing methods for a continue statement
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return cs.TokenLiteral() + ";" }
+
 // ExpressionStatement represents a statement containing an expression
 type ExpressionStatement struct {
 	Token      token.Token // the first token of the expression
@@ -117,6 +237,50 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// String returns the string representation of the destructuring statement.
+func (ds *DestructuringStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ds.TokenLiteral() + " ")
+	out.WriteString(ds.Pattern.String())
+	out.WriteString(" = ")
+
+	if ds.Value != nil {
+		out.WriteString(ds.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// String returns the string representation of the array pattern.
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// String returns the string representation of the hash pattern.
+func (hp *HashPattern) String() string {
+	entries := []string{}
+	for i, key := range hp.Keys {
+		if hp.Values[i].Value == key {
+			entries = append(entries, key)
+		} else {
+			entries = append(entries, key+": "+hp.Values[i].String())
+		}
+	}
+
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
 // String returns the string representation of the return statement.
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
@@ -132,6 +296,60 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// String returns the string representation of the defer statement.
+func (ds *DeferStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ds.TokenLiteral() + " ")
+
+	if ds.Expression != nil {
+		out.WriteString(ds.Expression.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// String returns the string representation of the yield statement.
+func (ys *YieldStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ys.TokenLiteral() + " ")
+
+	if ys.Value != nil {
+		out.WriteString(ys.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// String returns the string representation of the for-in statement.
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(fs.TokenLiteral() + " (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String() + ", ")
+	}
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+
+	if fs.Iterable != nil {
+		out.WriteString(fs.Iterable.String())
+	}
+
+	out.WriteString(") ")
+
+	if fs.Body != nil {
+		out.WriteString(fs.Body.String())
+	}
+
+	return out.String()
+}
+
 // String returns the string representation of the expression statement
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
@@ -154,6 +372,17 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// FloatLiteral represents a floating point literal.
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+// Implementing methods for FloatLiteral
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 // PrefixExpression represents a prefix operation (e.g., x).
 type PrefixExpression struct {
 	Token    token.Token
@@ -198,6 +427,32 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// ChainedComparison represents a chain of relational operators such as
+// a < b < c, which holds when each comparison holds. Operators[i] compares
+// Operands[i] with Operands[i+1].
+type ChainedComparison struct {
+	Token     token.Token // The first operator token
+	Operands  []Expression
+	Operators []string
+}
+
+// Implementing methods for ChainedComparison.
+func (cc *ChainedComparison) expressionNode()      {}
+func (cc *ChainedComparison) TokenLiteral() string { return cc.Token.Literal }
+func (cc *ChainedComparison) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(cc.Operands[0].String())
+	for i, operator := range cc.Operators {
+		out.WriteString(" " + operator + " ")
+		out.WriteString(cc.Operands[i+1].String())
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // Boolean represents a boolean literal.
 type Boolean struct {
 	Token token.Token
@@ -240,6 +495,7 @@ func (ie *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     int // offset of the closing '}'
 }
 
 // Implement methods for BlockStatement
@@ -255,6 +511,18 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 
+// BlockExpression represents a block in expression position, such as
+// { let a = 1; a + 1 }, whose value is the value of its last statement.
+type BlockExpression struct {
+	Token token.Token // the '{' token
+	Block *BlockStatement
+}
+
+// Implementing methods for BlockExpression.
+func (be *BlockExpression) expressionNode()      {}
+func (be *BlockExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BlockExpression) String() string       { return "{" + be.Block.String() + "}" }
+
 // FunctionLiteral represents a function declaration.
 type FunctionLiteral struct {
 	Token      token.Token // The 'fn' token
@@ -282,11 +550,41 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// FunctionStatement represents a named function declaration
+// (e.g., fn add(x, y) { x + y }).
+type FunctionStatement struct {
+	Token    token.Token // The 'fn' token
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+// Implement methods for FunctionStatement.
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fs.Function.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(fs.TokenLiteral() + " ")
+	out.WriteString(fs.Name.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fs.Function.Body.String())
+
+	return out.String()
+}
+
 // CallExpression represents a function or method call.
 type CallExpression struct {
 	Token     token.Token // The '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Rparen    int // offset of the closing ')'
 }
 
 // Implementing method for CallExpression.
@@ -323,6 +621,7 @@ func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
 	Elements []Expression
+	Rbracket int // offset of the closing ']'
 }
 
 // Implementing methods for ArrayLiteral.
@@ -345,9 +644,11 @@ func (al *ArrayLiteral) String() string {
 
 // IndexExpression represents an indexing operation (e.g., array[index]).
 type IndexExpression struct {
-	Token token.Token // The [ token
-	Left  Expression
-	Index Expression
+	Token    token.Token // The [ or ?[ token
+	Left     Expression
+	Index    Expression
+	Rbracket int  // offset of the closing ']'
+	Optional bool // written as ?[, yielding null when Left is null
 }
 
 // Implementing methods for IndexExpression.
@@ -358,6 +659,9 @@ func (ie *IndexExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?")
+	}
 	out.WriteString("[")
 	out.WriteString(ie.Index.String())
 	out.WriteString("])")
@@ -365,10 +669,62 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// MemberExpression represents a member access (e.g., math.sqrt).
+type MemberExpression struct {
+	Token    token.Token // The . or ?. token
+	Object   Expression
+	Property *Identifier
+	Optional bool // written as ?., yielding null when Object is null
+}
+
+// Implementing methods for MemberExpression.
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	if me.Optional {
+		out.WriteString("?")
+	}
+	out.WriteString(".")
+	out.WriteString(me.Property.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// SetLiteral represents a set literal (e.g., {1, 2, 3}).
+type SetLiteral struct {
+	Token    token.Token // the '{' token
+	Elements []Expression
+	Rbrace   int // offset of the closing '}'
+}
+
+// Implementing methods for SetLiteral.
+func (sl *SetLiteral) expressionNode()      {}
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SetLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range sl.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
 // HashLiteral represents a hash literal with key-value pairs.
 type HashLiteral struct {
-	Token token.Token // the '{' token
-	Pairs map[Expression]Expression
+	Token  token.Token // the '{' token
+	Pairs  map[Expression]Expression
+	Rbrace int // offset of the closing '}'
 }
 
 // Implementing methods for HashLiteral.
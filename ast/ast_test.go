@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"encoding/json"
+	"fmt"
 	"leopard/token"
 	"testing"
 )
@@ -26,3 +28,224 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestToJSON(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			// let myVar = 5 + x;
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Offset: 0},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "myVar", Offset: 4},
+					Value: "myVar",
+				},
+				Value: &InfixExpression{
+					Token:    token.Token{Type: token.PLUS, Literal: "+", Offset: 14},
+					Operator: "+",
+					Left: &IntegerLiteral{
+						Token: token.Token{Type: token.INT, Literal: "5", Offset: 12},
+						Value: 5,
+					},
+					Right: &Identifier{
+						Token: token.Token{Type: token.IDENT, Literal: "x", Offset: 16},
+						Value: "x",
+					},
+				},
+			},
+		},
+	}
+
+	data, err := ToJSON(program)
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+
+	expected := `{"end":17,"kind":"Program","pos":0,"statements":[` +
+		`{"end":17,"kind":"LetStatement","name":"myVar","pos":0,"value":` +
+		`{"end":17,"kind":"InfixExpression","left":{"end":13,"kind":"IntegerLiteral","pos":12,"value":5},"operator":"+","pos":12,` +
+		`"right":{"end":17,"kind":"Identifier","pos":16,"value":"x"}}}]}`
+
+	if string(data) != expected {
+		t.Errorf("ToJSON wrong.\nexpected=%s\ngot=%s", expected, data)
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	input := `{"kind":"Program","statements":[` +
+		`{"kind":"LetStatement","name":"myVar","value":` +
+		`{"kind":"InfixExpression","left":{"kind":"IntegerLiteral","value":5},"operator":"+",` +
+		`"right":{"kind":"Identifier","value":"x"}}}]}`
+
+	program, err := FromJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("FromJSON returned error: %s", err)
+	}
+
+	if program.String() != "let myVar = (5 + x);" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	data, err := ToJSON(program)
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+	if got := withoutPositions(t, data); got != input {
+		t.Errorf("round trip wrong.\nexpected=%s\ngot=%s", input, got)
+	}
+}
+
+func TestFromJSONOptionalAccess(t *testing.T) {
+	input := `{"kind":"Program","statements":[{"expression":` +
+		`{"index":{"kind":"IntegerLiteral","value":0},"kind":"IndexExpression","left":` +
+		`{"kind":"MemberExpression","object":{"kind":"Identifier","value":"a"},"optional":true,"property":"b"},` +
+		`"optional":true},"kind":"ExpressionStatement"}]}`
+
+	program, err := FromJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("FromJSON returned error: %s", err)
+	}
+	if program.String() != "((a?.b)?[0])" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	data, err := ToJSON(program)
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+	if got := withoutPositions(t, data); got != input {
+		t.Errorf("round trip wrong.\nexpected=%s\ngot=%s", input, got)
+	}
+}
+
+func TestFromJSONDestructuring(t *testing.T) {
+	input := `{"kind":"Program","statements":[` +
+		`{"kind":"DestructuringStatement","pattern":{"elements":["a"],"kind":"ArrayPattern","rest":"b"},` +
+		`"value":{"kind":"Identifier","value":"xs"}},` +
+		`{"kind":"DestructuringStatement","pattern":{"keys":["name","age"],"kind":"HashPattern","values":["name","years"]},` +
+		`"value":{"kind":"Identifier","value":"person"}}]}`
+
+	program, err := FromJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("FromJSON returned error: %s", err)
+	}
+	if program.String() != "let [a, ...b] = xs;let {name, age: years} = person;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	data, err := ToJSON(program)
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+	if got := withoutPositions(t, data); got != input {
+		t.Errorf("round trip wrong.\nexpected=%s\ngot=%s", input, got)
+	}
+}
+
+func TestFromJSONForIn(t *testing.T) {
+	input := `{"kind":"Program","statements":[` +
+		`{"body":{"kind":"BlockStatement","statements":[{"kind":"ContinueStatement"},{"kind":"BreakStatement"}]},` +
+		`"iterable":{"kind":"Identifier","value":"xs"},"key":null,"kind":"ForInStatement","variable":"x"},` +
+		`{"body":{"kind":"BlockStatement","statements":[]},` +
+		`"iterable":{"kind":"Identifier","value":"h"},"key":"k","kind":"ForInStatement","variable":"v"}]}`
+
+	program, err := FromJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("FromJSON returned error: %s", err)
+	}
+	if program.String() != "for (x in xs) continue;break;for (k, v in h) " {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	data, err := ToJSON(program)
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+	if got := withoutPositions(t, data); got != input {
+		t.Errorf("round trip wrong.\nexpected=%s\ngot=%s", input, got)
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Program","statements":[{"kind":"WhileStatement"}]}`, `unknown node kind "WhileStatement"`},
+		{`{"kind":"Identifier","value":"x"}`, "expected Program, got *ast.Identifier"},
+		{`{"kind":"Program"}`, `missing field "statements"`},
+		{`{"kind":"Program","statements":[{"kind":"ExpressionStatement","expression":{"kind":"BlockExpression","block":null}}]}`, `field "block" must not be null`},
+		{`{"kind":"Program","statements":[{"kind":"ForInStatement","variable":"x","iterable":{"kind":"Identifier","value":"xs"},"body":null}]}`, `field "body" must not be null`},
+		{`{"kind":"Program","statements":[{"kind":"ForInStatement","variable":"x","iterable":null,"body":null}]}`, `field "iterable" must not be null`},
+	}
+
+	// Required children may not be null, as the evaluator expects them.
+	x := `{"kind":"Identifier","value":"x"}`
+	block := `{"kind":"BlockStatement","statements":[]}`
+	nulls := []struct {
+		expression string
+		field      string
+	}{
+		{`{"kind":"InfixExpression","left":null,"operator":"+","right":` + x + `}`, "left"},
+		{`{"kind":"PrefixExpression","operator":"-","right":null}`, "right"},
+		{`{"kind":"IfExpression","condition":` + x + `,"consequence":null,"alternative":null}`, "consequence"},
+		{`{"kind":"FunctionLiteral","parameters":[],"body":null}`, "body"},
+		{`{"kind":"CallExpression","function":null,"arguments":[]}`, "function"},
+		{`{"kind":"IndexExpression","left":null,"index":null}`, "left"},
+		{`{"kind":"IndexExpression","left":` + x + `,"index":null}`, "index"},
+		{`{"kind":"MemberExpression","object":null,"property":"a"}`, "object"},
+		{`{"kind":"HashLiteral","pairs":[{"key":` + x + `,"value":null}]}`, "value"},
+		{`{"kind":"IfExpression","condition":null,"consequence":` + block + `,"alternative":null}`, "condition"},
+	}
+	for _, tt := range nulls {
+		tests = append(tests, struct {
+			input    string
+			expected string
+		}{
+			`{"kind":"Program","statements":[{"kind":"ExpressionStatement","expression":` + tt.expression + `}]}`,
+			fmt.Sprintf("field %q must not be null", tt.field),
+		})
+	}
+
+	for _, tt := range tests {
+		_, err := FromJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected error for %s", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+// withoutPositions returns the JSON in data with the "pos" and "end" fields
+// of every node removed, for comparing trees that were not parsed.
+func withoutPositions(t *testing.T, data []byte) string {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+
+	var strip func(v interface{})
+	strip = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			delete(v, "pos")
+			delete(v, "end")
+			for _, child := range v {
+				strip(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				strip(child)
+			}
+		}
+	}
+	strip(value)
+
+	stripped, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("cannot encode JSON: %s", err)
+	}
+	return string(stripped)
+}
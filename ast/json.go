@@ -0,0 +1,791 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"leopard/token"
+	"strconv"
+)
+
+// ToJSON encodes the tree rooted at node as JSON for use by tools written in
+// other languages. Every node becomes an object with a "kind" field naming
+// its type (e.g. "LetStatement"), "pos" and "end" fields with the byte
+// offsets returned by its Pos and End methods, and one field per child, so
+// the output is stable: object keys are sorted and hash literal pairs are
+// ordered by the source text of their keys. Missing optional children are
+// encoded as null.
+func ToJSON(node Node) ([]byte, error) {
+	value, err := toJSONValue(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(value)
+}
+
+// jsonNode is the JSON representation of a single node.
+type jsonNode map[string]interface{}
+
+// toJSONValue converts a node and its children into a jsonNode, with the
+// position of the node.
+func toJSONValue(node Node) (jsonNode, error) {
+	value, err := nodeToJSON(node)
+	if err != nil {
+		return nil, err
+	}
+	value["pos"] = node.Pos()
+	value["end"] = node.End()
+
+	return value, nil
+}
+
+// nodeToJSON converts a node and its children into a jsonNode without the
+// position of the node itself.
+func nodeToJSON(node Node) (jsonNode, error) {
+	switch node := node.(type) {
+	case *Program:
+		statements, err := statementsToJSON(node.Statements)
+		return jsonNode{"kind": "Program", "statements": statements}, err
+
+	case *LetStatement:
+		value, err := expressionToJSON(node.Value)
+		return jsonNode{"kind": "LetStatement", "name": node.Name.Value, "value": value}, err
+
+	case *DestructuringStatement:
+		pattern, err := toJSONValue(node.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		value, err := expressionToJSON(node.Value)
+		return jsonNode{"kind": "DestructuringStatement", "pattern": pattern, "value": value}, err
+
+	case *ArrayPattern:
+		elements := []string{}
+		for _, el := range node.Elements {
+			elements = append(elements, el.Value)
+		}
+		var rest interface{}
+		if node.Rest != nil {
+			rest = node.Rest.Value
+		}
+		return jsonNode{"kind": "ArrayPattern", "elements": elements, "rest": rest}, nil
+
+	case *HashPattern:
+		values := []string{}
+		for _, value := range node.Values {
+			values = append(values, value.Value)
+		}
+		return jsonNode{"kind": "HashPattern", "keys": node.Keys, "values": values}, nil
+
+	case *ReturnStatement:
+		value, err := expressionToJSON(node.ReturnValue)
+		return jsonNode{"kind": "ReturnStatement", "value": value}, err
+
+	case *DeferStatement:
+		expression, err := expressionToJSON(node.Expression)
+		return jsonNode{"kind": "DeferStatement", "expression": expression}, err
+
+	case *YieldStatement:
+		value, err := expressionToJSON(node.Value)
+		return jsonNode{"kind": "YieldStatement", "value": value}, err
+
+	case *ForInStatement:
+		iterable, err := expressionToJSON(node.Iterable)
+		if err != nil {
+			return nil, err
+		}
+		body, err := toJSONValue(node.Body)
+		var key interface{}
+		if node.Key != nil {
+			key = node.Key.Value
+		}
+		return jsonNode{"kind": "ForInStatement", "key": key, "variable": node.Variable.Value, "iterable": iterable, "body": body}, err
+
+	case *BreakStatement:
+		return jsonNode{"kind": "BreakStatement"}, nil
+
+	case *ContinueStatement:
+		return jsonNode{"kind": "ContinueStatement"}, nil
+
+	case *ExpressionStatement:
+		expression, err := expressionToJSON(node.Expression)
+		return jsonNode{"kind": "ExpressionStatement", "expression": expression}, err
+
+	case *BlockStatement:
+		statements, err := statementsToJSON(node.Statements)
+		return jsonNode{"kind": "BlockStatement", "statements": statements}, err
+
+	case *FunctionStatement:
+		function, err := toJSONValue(node.Function)
+		return jsonNode{"kind": "FunctionStatement", "name": node.Name.Value, "function": function}, err
+
+	case *Identifier:
+		return jsonNode{"kind": "Identifier", "value": node.Value}, nil
+
+	case *IntegerLiteral:
+		return jsonNode{"kind": "IntegerLiteral", "value": node.Value}, nil
+
+	case *FloatLiteral:
+		return jsonNode{"kind": "FloatLiteral", "value": node.Value}, nil
+
+	case *StringLiteral:
+		return jsonNode{"kind": "StringLiteral", "value": node.Value}, nil
+
+	case *Boolean:
+		return jsonNode{"kind": "Boolean", "value": node.Value}, nil
+
+	case *PrefixExpression:
+		right, err := expressionToJSON(node.Right)
+		return jsonNode{"kind": "PrefixExpression", "operator": node.Operator, "right": right}, err
+
+	case *InfixExpression:
+		left, err := expressionToJSON(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := expressionToJSON(node.Right)
+		return jsonNode{"kind": "InfixExpression", "operator": node.Operator, "left": left, "right": right}, err
+
+	case *ChainedComparison:
+		operands, err := expressionsToJSON(node.Operands)
+		return jsonNode{"kind": "ChainedComparison", "operands": operands, "operators": node.Operators}, err
+
+	case *IfExpression:
+		condition, err := expressionToJSON(node.Condition)
+		if err != nil {
+			return nil, err
+		}
+		consequence, err := toJSONValue(node.Consequence)
+		if err != nil {
+			return nil, err
+		}
+		var alternative jsonNode
+		if node.Alternative != nil {
+			if alternative, err = toJSONValue(node.Alternative); err != nil {
+				return nil, err
+			}
+		}
+		return jsonNode{"kind": "IfExpression", "condition": condition, "consequence": consequence, "alternative": alternative}, nil
+
+	case *BlockExpression:
+		block, err := toJSONValue(node.Block)
+		return jsonNode{"kind": "BlockExpression", "block": block}, err
+
+	case *FunctionLiteral:
+		params := []jsonNode{}
+		for _, p := range node.Parameters {
+			params = append(params, jsonNode{"kind": "Identifier", "value": p.Value, "pos": p.Pos(), "end": p.End()})
+		}
+		body, err := toJSONValue(node.Body)
+		return jsonNode{"kind": "FunctionLiteral", "parameters": params, "body": body}, err
+
+	case *CallExpression:
+		function, err := expressionToJSON(node.Function)
+		if err != nil {
+			return nil, err
+		}
+		arguments, err := expressionsToJSON(node.Arguments)
+		return jsonNode{"kind": "CallExpression", "function": function, "arguments": arguments}, err
+
+	case *ArrayLiteral:
+		elements, err := expressionsToJSON(node.Elements)
+		return jsonNode{"kind": "ArrayLiteral", "elements": elements}, err
+
+	case *SetLiteral:
+		elements, err := expressionsToJSON(node.Elements)
+		return jsonNode{"kind": "SetLiteral", "elements": elements}, err
+
+	case *IndexExpression:
+		left, err := expressionToJSON(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		index, err := expressionToJSON(node.Index)
+		n := jsonNode{"kind": "IndexExpression", "left": left, "index": index}
+		if node.Optional {
+			n["optional"] = true
+		}
+		return n, err
+
+	case *MemberExpression:
+		object, err := expressionToJSON(node.Object)
+		n := jsonNode{"kind": "MemberExpression", "object": object, "property": node.Property.Value}
+		if node.Optional {
+			n["optional"] = true
+		}
+		return n, err
+
+	case *HashLiteral:
+		pairs := []jsonNode{}
+		for _, key := range sortedKeys(node) {
+			k, err := expressionToJSON(key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := expressionToJSON(node.Pairs[key])
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, jsonNode{"key": k, "value": v})
+		}
+		return jsonNode{"kind": "HashLiteral", "pairs": pairs}, nil
+
+	default:
+		return nil, fmt.Errorf("cannot encode node of type %T", node)
+	}
+}
+
+// expressionToJSON converts an expression that may be nil.
+func expressionToJSON(exp Expression) (jsonNode, error) {
+	if exp == nil {
+		return nil, nil
+	}
+	return toJSONValue(exp)
+}
+
+// expressionsToJSON converts a list of expressions.
+func expressionsToJSON(exps []Expression) ([]jsonNode, error) {
+	result := []jsonNode{}
+	for _, exp := range exps {
+		value, err := expressionToJSON(exp)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+// statementsToJSON converts a list of statements.
+func statementsToJSON(statements []Statement) ([]jsonNode, error) {
+	result := []jsonNode{}
+	for _, s := range statements {
+		value, err := toJSONValue(s)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+// FromJSON decodes a program in the format produced by ToJSON. Tokens are
+// reconstructed from the node values, so the resulting tree prints and
+// evaluates like one produced by the parser. Positions are not decoded,
+// since the tree no longer corresponds to any source text. Unknown node
+// kinds are an error, as is null for any child but the alternative of an
+// if expression.
+func FromJSON(data []byte) (*Program, error) {
+	node, err := fromJSONValue(data)
+	if err != nil {
+		return nil, err
+	}
+
+	program, ok := node.(*Program)
+	if !ok {
+		return nil, fmt.Errorf("expected Program, got %T", node)
+	}
+
+	return program, nil
+}
+
+// jsonFields holds the undecoded fields of a single JSON node.
+type jsonFields map[string]json.RawMessage
+
+// fromJSONValue decodes a single node and its children.
+func fromJSONValue(data []byte) (Node, error) {
+	var fields jsonFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	var kind string
+	if err := fields.decode("kind", &kind); err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "Program":
+		statements, err := fields.statements("statements")
+		return &Program{Statements: statements}, err
+
+	case "LetStatement":
+		name, err := fields.identifier("name")
+		if err != nil {
+			return nil, err
+		}
+		value, err := fields.expression("value")
+		return &LetStatement{Token: newToken(token.LET, "let"), Name: name, Value: value}, err
+
+	case "DestructuringStatement":
+		node, err := fields.node("pattern")
+		if err != nil {
+			return nil, err
+		}
+		pattern, ok := node.(Pattern)
+		if !ok {
+			return nil, fmt.Errorf("field %q must be a pattern, got %T", "pattern", node)
+		}
+		value, err := fields.expression("value")
+		return &DestructuringStatement{Token: newToken(token.LET, "let"), Pattern: pattern, Value: value}, err
+
+	case "ArrayPattern":
+		var names []string
+		if err := fields.decode("elements", &names); err != nil {
+			return nil, err
+		}
+		elements := []*Identifier{}
+		for _, name := range names {
+			elements = append(elements, &Identifier{Token: newToken(token.IDENT, name), Value: name})
+		}
+		var rest *string
+		if err := fields.decode("rest", &rest); err != nil {
+			return nil, err
+		}
+		pattern := &ArrayPattern{Token: newToken(token.LBRACKET, "["), Elements: elements}
+		if rest != nil {
+			pattern.Rest = &Identifier{Token: newToken(token.IDENT, *rest), Value: *rest}
+		}
+		return pattern, nil
+
+	case "HashPattern":
+		var keys, values []string
+		if err := fields.decode("keys", &keys); err != nil {
+			return nil, err
+		}
+		if err := fields.decode("values", &values); err != nil {
+			return nil, err
+		}
+		if len(keys) != len(values) {
+			return nil, fmt.Errorf("HashPattern needs as many keys as values, got %d and %d", len(keys), len(values))
+		}
+		pattern := &HashPattern{Token: newToken(token.LBRACE, "{"), Keys: keys}
+		for _, value := range values {
+			pattern.Values = append(pattern.Values, &Identifier{Token: newToken(token.IDENT, value), Value: value})
+		}
+		return pattern, nil
+
+	case "ReturnStatement":
+		value, err := fields.expression("value")
+		return &ReturnStatement{Token: newToken(token.RETURN, "return"), ReturnValue: value}, err
+
+	case "DeferStatement":
+		expression, err := fields.expression("expression")
+		return &DeferStatement{Token: newToken(token.DEFER, "defer"), Expression: expression}, err
+
+	case "YieldStatement":
+		value, err := fields.expression("value")
+		return &YieldStatement{Token: newToken(token.YIELD, "yield"), Value: value}, err
+
+	case "ForInStatement":
+		// The key is optional so that loops encoded before it existed
+		// still decode.
+		var key *string
+		if _, ok := fields["key"]; ok {
+			if err := fields.decode("key", &key); err != nil {
+				return nil, err
+			}
+		}
+		variable, err := fields.identifier("variable")
+		if err != nil {
+			return nil, err
+		}
+		iterable, err := fields.expression("iterable")
+		if err != nil {
+			return nil, err
+		}
+		body, err := fields.block("body")
+		if err != nil {
+			return nil, err
+		}
+		stmt := &ForInStatement{Token: newToken(token.FOR, "for"), Variable: variable, Iterable: iterable, Body: body}
+		if key != nil {
+			stmt.Key = &Identifier{Token: newToken(token.IDENT, *key), Value: *key}
+		}
+		return stmt, nil
+
+	case "BreakStatement":
+		return &BreakStatement{Token: newToken(token.BREAK, "break")}, nil
+
+	case "ContinueStatement":
+		return &ContinueStatement{Token: newToken(token.CONTINUE, "continue")}, nil
+
+	case "ExpressionStatement":
+		expression, err := fields.expression("expression")
+		if err != nil {
+			return nil, err
+		}
+		return &ExpressionStatement{Token: firstToken(expression), Expression: expression}, nil
+
+	case "BlockStatement":
+		statements, err := fields.statements("statements")
+		return &BlockStatement{Token: newToken(token.LBRACE, "{"), Statements: statements}, err
+
+	case "FunctionStatement":
+		name, err := fields.identifier("name")
+		if err != nil {
+			return nil, err
+		}
+		node, err := fields.node("function")
+		if err != nil {
+			return nil, err
+		}
+		function, ok := node.(*FunctionLiteral)
+		if !ok {
+			return nil, fmt.Errorf("FunctionStatement function must be FunctionLiteral, got %T", node)
+		}
+		return &FunctionStatement{Token: newToken(token.FUNCTION, "fn"), Name: name, Function: function}, nil
+
+	case "Identifier":
+		var value string
+		err := fields.decode("value", &value)
+		return &Identifier{Token: newToken(token.IDENT, value), Value: value}, err
+
+	case "IntegerLiteral":
+		var value int64
+		err := fields.decode("value", &value)
+		return &IntegerLiteral{Token: newToken(token.INT, strconv.FormatInt(value, 10)), Value: value}, err
+
+	case "FloatLiteral":
+		var value float64
+		err := fields.decode("value", &value)
+		return &FloatLiteral{Token: newToken(token.FLOAT, strconv.FormatFloat(value, 'f', -1, 64)), Value: value}, err
+
+	case "StringLiteral":
+		var value string
+		err := fields.decode("value", &value)
+		return &StringLiteral{Token: newToken(token.STRING, value), Value: value}, err
+
+	case "Boolean":
+		var value bool
+		if err := fields.decode("value", &value); err != nil {
+			return nil, err
+		}
+		if value {
+			return &Boolean{Token: newToken(token.TRUE, "true"), Value: true}, nil
+		}
+		return &Boolean{Token: newToken(token.FALSE, "false"), Value: false}, nil
+
+	case "PrefixExpression":
+		var operator string
+		if err := fields.decode("operator", &operator); err != nil {
+			return nil, err
+		}
+		right, err := fields.expression("right")
+		return &PrefixExpression{Token: newToken(token.TokenType(operator), operator), Operator: operator, Right: right}, err
+
+	case "InfixExpression":
+		var operator string
+		if err := fields.decode("operator", &operator); err != nil {
+			return nil, err
+		}
+		left, err := fields.expression("left")
+		if err != nil {
+			return nil, err
+		}
+		right, err := fields.expression("right")
+		return &InfixExpression{Token: newToken(token.TokenType(operator), operator), Operator: operator, Left: left, Right: right}, err
+
+	case "ChainedComparison":
+		var operators []string
+		if err := fields.decode("operators", &operators); err != nil {
+			return nil, err
+		}
+		operands, err := fields.expressions("operands")
+		if err != nil {
+			return nil, err
+		}
+		if len(operators) == 0 || len(operands) != len(operators)+1 {
+			return nil, fmt.Errorf("ChainedComparison needs one more operand than operators, got %d and %d", len(operands), len(operators))
+		}
+		return &ChainedComparison{Token: newToken(token.TokenType(operators[0]), operators[0]), Operands: operands, Operators: operators}, nil
+
+	case "IfExpression":
+		condition, err := fields.expression("condition")
+		if err != nil {
+			return nil, err
+		}
+		consequence, err := fields.block("consequence")
+		if err != nil {
+			return nil, err
+		}
+		alternative, err := fields.optionalBlock("alternative")
+		return &IfExpression{Token: newToken(token.IF, "if"), Condition: condition, Consequence: consequence, Alternative: alternative}, err
+
+	case "BlockExpression":
+		block, err := fields.block("block")
+		if err != nil {
+			return nil, err
+		}
+		return &BlockExpression{Token: newToken(token.LBRACE, "{"), Block: block}, nil
+
+	case "FunctionLiteral":
+		var rawParams []json.RawMessage
+		if err := fields.decode("parameters", &rawParams); err != nil {
+			return nil, err
+		}
+		params := []*Identifier{}
+		for _, raw := range rawParams {
+			node, err := fromJSONValue(raw)
+			if err != nil {
+				return nil, err
+			}
+			param, ok := node.(*Identifier)
+			if !ok {
+				return nil, fmt.Errorf("function parameter must be Identifier, got %T", node)
+			}
+			params = append(params, param)
+		}
+		body, err := fields.block("body")
+		return &FunctionLiteral{Token: newToken(token.FUNCTION, "fn"), Parameters: params, Body: body}, err
+
+	case "CallExpression":
+		function, err := fields.expression("function")
+		if err != nil {
+			return nil, err
+		}
+		arguments, err := fields.expressions("arguments")
+		return &CallExpression{Token: newToken(token.LPAREN, "("), Function: function, Arguments: arguments}, err
+
+	case "ArrayLiteral":
+		elements, err := fields.expressions("elements")
+		return &ArrayLiteral{Token: newToken(token.LBRACKET, "["), Elements: elements}, err
+
+	case "SetLiteral":
+		elements, err := fields.expressions("elements")
+		return &SetLiteral{Token: newToken(token.LBRACE, "{"), Elements: elements}, err
+
+	case "IndexExpression":
+		left, err := fields.expression("left")
+		if err != nil {
+			return nil, err
+		}
+		index, err := fields.expression("index")
+		if err != nil {
+			return nil, err
+		}
+		optional, err := fields.optional()
+		if err != nil {
+			return nil, err
+		}
+		if optional {
+			return &IndexExpression{Token: newToken(token.QUESTION_LBRACKET, "?["), Left: left, Index: index, Optional: true}, nil
+		}
+		return &IndexExpression{Token: newToken(token.LBRACKET, "["), Left: left, Index: index}, nil
+
+	case "MemberExpression":
+		object, err := fields.expression("object")
+		if err != nil {
+			return nil, err
+		}
+		property, err := fields.identifier("property")
+		if err != nil {
+			return nil, err
+		}
+		optional, err := fields.optional()
+		if err != nil {
+			return nil, err
+		}
+		if optional {
+			return &MemberExpression{Token: newToken(token.QUESTION_DOT, "?."), Object: object, Property: property, Optional: true}, nil
+		}
+		return &MemberExpression{Token: newToken(token.DOT, "."), Object: object, Property: property}, nil
+
+	case "HashLiteral":
+		var rawPairs []jsonFields
+		if err := fields.decode("pairs", &rawPairs); err != nil {
+			return nil, err
+		}
+		pairs := make(map[Expression]Expression, len(rawPairs))
+		for _, pair := range rawPairs {
+			key, err := pair.expression("key")
+			if err != nil {
+				return nil, err
+			}
+			value, err := pair.expression("value")
+			if err != nil {
+				return nil, err
+			}
+			pairs[key] = value
+		}
+		return &HashLiteral{Token: newToken(token.LBRACE, "{"), Pairs: pairs}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown node kind %q", kind)
+	}
+}
+
+// newToken creates a token for a node decoded from JSON.
+func newToken(tokenType token.TokenType, literal string) token.Token {
+	return token.Token{Type: tokenType, Literal: literal}
+}
+
+// firstToken returns the token the parser would have started exp with.
+func firstToken(exp Expression) token.Token {
+	switch exp := exp.(type) {
+	case *InfixExpression:
+		return firstToken(exp.Left)
+	case *ChainedComparison:
+		return firstToken(exp.Operands[0])
+	case *CallExpression:
+		return firstToken(exp.Function)
+	case *IndexExpression:
+		return firstToken(exp.Left)
+	case *MemberExpression:
+		return firstToken(exp.Object)
+	case *Identifier:
+		return exp.Token
+	case *IntegerLiteral:
+		return exp.Token
+	case *FloatLiteral:
+		return exp.Token
+	case *StringLiteral:
+		return exp.Token
+	case *Boolean:
+		return exp.Token
+	case *PrefixExpression:
+		return exp.Token
+	case *IfExpression:
+		return exp.Token
+	case *BlockExpression:
+		return exp.Token
+	case *FunctionLiteral:
+		return exp.Token
+	case *ArrayLiteral:
+		return exp.Token
+	case *SetLiteral:
+		return exp.Token
+	case *HashLiteral:
+		return exp.Token
+	}
+	return token.Token{}
+}
+
+// decode unmarshals the named field into v.
+func (f jsonFields) decode(name string, v interface{}) error {
+	raw, ok := f[name]
+	if !ok {
+		return fmt.Errorf("missing field %q", name)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// optional decodes the "optional" flag of an index or member expression,
+// which is omitted when false.
+func (f jsonFields) optional() (bool, error) {
+	var optional bool
+	if _, ok := f["optional"]; !ok {
+		return false, nil
+	}
+	err := f.decode("optional", &optional)
+	return optional, err
+}
+
+// node decodes the named field as a node, returning nil for null.
+func (f jsonFields) node(name string) (Node, error) {
+	raw, ok := f[name]
+	if !ok {
+		return nil, fmt.Errorf("missing field %q", name)
+	}
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	return fromJSONValue(raw)
+}
+
+// expression decodes the named field as an expression. The evaluator
+// expects every expression field to be set, so null is an error.
+func (f jsonFields) expression(name string) (Expression, error) {
+	node, err := f.node(name)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, fmt.Errorf("field %q must not be null", name)
+	}
+
+	exp, ok := node.(Expression)
+	if !ok {
+		return nil, fmt.Errorf("field %q must be an expression, got %T", name, node)
+	}
+	return exp, nil
+}
+
+// identifier decodes the named field, which holds a plain name, as an identifier.
+func (f jsonFields) identifier(name string) (*Identifier, error) {
+	var value string
+	if err := f.decode(name, &value); err != nil {
+		return nil, err
+	}
+	return &Identifier{Token: newToken(token.IDENT, value), Value: value}, nil
+}
+
+// block decodes the named field as a block statement. Null is an error.
+func (f jsonFields) block(name string) (*BlockStatement, error) {
+	node, err := f.node(name)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, fmt.Errorf("field %q must not be null", name)
+	}
+
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		return nil, fmt.Errorf("field %q must be BlockStatement, got %T", name, node)
+	}
+	return block, nil
+}
+
+// optionalBlock decodes the named field as a block statement, returning nil
+// for null, as for the alternative of an if expression.
+func (f jsonFields) optionalBlock(name string) (*BlockStatement, error) {
+	if raw, ok := f[name]; ok && string(raw) == "null" {
+		return nil, nil
+	}
+	return f.block(name)
+}
+
+// expressions decodes the named field as a list of expressions.
+func (f jsonFields) expressions(name string) ([]Expression, error) {
+	var raws []json.RawMessage
+	if err := f.decode(name, &raws); err != nil {
+		return nil, err
+	}
+
+	result := []Expression{}
+	for _, raw := range raws {
+		node, err := fromJSONValue(raw)
+		if err != nil {
+			return nil, err
+		}
+		exp, ok := node.(Expression)
+		if !ok {
+			return nil, fmt.Errorf("field %q must hold expressions, got %T", name, node)
+		}
+		result = append(result, exp)
+	}
+	return result, nil
+}
+
+// statements decodes the named field as a list of statements.
+func (f jsonFields) statements(name string) ([]Statement, error) {
+	var raws []json.RawMessage
+	if err := f.decode(name, &raws); err != nil {
+		return nil, err
+	}
+
+	result := []Statement{}
+	for _, raw := range raws {
+		node, err := fromJSONValue(raw)
+		if err != nil {
+			return nil, err
+		}
+		stmt, ok := node.(Statement)
+		if !ok {
+			return nil, fmt.Errorf("field %q must hold statements, got %T", name, node)
+		}
+		result = append(result, stmt)
+	}
+	return result, nil
+}
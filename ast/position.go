@@ -0,0 +1,166 @@
+package ast
+
+import "leopard/token"
+
+// Positions are derived from the tokens the parser stores on each node.
+// Nodes built by hand or decoded from JSON have zero offsets.
+
+// tokenEnd returns the offset just after the source of tok.
+func tokenEnd(tok token.Token) int {
+	return tok.Offset + tok.Len()
+}
+
+// expressionEnd returns the end of exp, or of tok if exp is missing.
+func expressionEnd(exp Expression, tok token.Token) int {
+	if exp == nil {
+		return tokenEnd(tok)
+	}
+	return exp.End()
+}
+
+func (p *Program) Pos() int {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return 0
+}
+
+func (p *Program) End() int {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return 0
+}
+
+func (ls *LetStatement) Pos() int { return ls.Token.Offset }
+func (ls *LetStatement) End() int { return expressionEnd(ls.Value, ls.Name.Token) }
+
+func (ds *DestructuringStatement) Pos() int { return ds.Token.Offset }
+func (ds *DestructuringStatement) End() int { return expressionEnd(ds.Value, ds.Token) }
+
+func (ap *ArrayPattern) Pos() int { return ap.Token.Offset }
+func (ap *ArrayPattern) End() int { return ap.Rbracket + 1 }
+
+func (hp *HashPattern) Pos() int { return hp.Token.Offset }
+func (hp *HashPattern) End() int { return hp.Rbrace + 1 }
+
+func (i *Identifier) Pos() int { return i.Token.Offset }
+func (i *Identifier) End() int { return tokenEnd(i.Token) }
+
+func (rs *ReturnStatement) Pos() int { return rs.Token.Offset }
+func (rs *ReturnStatement) End() int { return expressionEnd(rs.ReturnValue, rs.Token) }
+
+func (ds *DeferStatement) Pos() int { return ds.Token.Offset }
+func (ds *DeferStatement) End() int { return expressionEnd(ds.Expression, ds.Token) }
+
+func (ys *YieldStatement) Pos() int { return ys.Token.Offset }
+func (ys *YieldStatement) End() int { return expressionEnd(ys.Value, ys.Token) }
+
+func (fs *ForInStatement) Pos() int { return fs.Token.Offset }
+
+func (fs *ForInStatement) End() int {
+	if fs.Body == nil {
+		return expressionEnd(fs.Iterable, fs.Token)
+	}
+	return fs.Body.End()
+}
+
+func (bs *BreakStatement) Pos() int { return bs.Token.Offset }
+func (bs *BreakStatement) End() int { return tokenEnd(bs.Token) }
+
+func (cs *ContinueStatement) Pos() int { return cs.Token.Offset }
+func (cs *ContinueStatement) End() int { return tokenEnd(cs.Token) }
+
+func (es *ExpressionStatement) Pos() int {
+	if es.Expression == nil {
+		return es.Token.Offset
+	}
+	return es.Expression.Pos()
+}
+
+func (es *ExpressionStatement) End() int { return expressionEnd(es.Expression, es.Token) }
+
+func (il *IntegerLiteral) Pos() int { return il.Token.Offset }
+func (il *IntegerLiteral) End() int { return tokenEnd(il.Token) }
+
+func (fl *FloatLiteral) Pos() int { return fl.Token.Offset }
+func (fl *FloatLiteral) End() int { return tokenEnd(fl.Token) }
+
+func (pe *PrefixExpression) Pos() int { return pe.Token.Offset }
+func (pe *PrefixExpression) End() int { return expressionEnd(pe.Right, pe.Token) }
+
+func (ie *InfixExpression) Pos() int { return ie.Left.Pos() }
+func (ie *InfixExpression) End() int { return expressionEnd(ie.Right, ie.Token) }
+
+func (cc *ChainedComparison) Pos() int { return cc.Operands[0].Pos() }
+func (cc *ChainedComparison) End() int {
+	return expressionEnd(cc.Operands[len(cc.Operands)-1], cc.Token)
+}
+
+func (b *Boolean) Pos() int { return b.Token.Offset }
+func (b *Boolean) End() int { return tokenEnd(b.Token) }
+
+func (ie *IfExpression) Pos() int { return ie.Token.Offset }
+
+func (ie *IfExpression) End() int {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return expressionEnd(ie.Condition, ie.Token)
+}
+
+func (bs *BlockStatement) Pos() int { return bs.Token.Offset }
+func (bs *BlockStatement) End() int { return bs.Rbrace + 1 }
+
+func (be *BlockExpression) Pos() int { return be.Token.Offset }
+func (be *BlockExpression) End() int { return be.Block.End() }
+
+func (fl *FunctionLiteral) Pos() int { return fl.Token.Offset }
+
+func (fl *FunctionLiteral) End() int {
+	if fl.Body == nil {
+		return tokenEnd(fl.Token)
+	}
+	return fl.Body.End()
+}
+
+func (fs *FunctionStatement) Pos() int { return fs.Token.Offset }
+
+func (fs *FunctionStatement) End() int {
+	if fs.Function == nil {
+		return fs.Name.End()
+	}
+	return fs.Function.End()
+}
+
+func (ce *CallExpression) Pos() int { return ce.Function.Pos() }
+func (ce *CallExpression) End() int { return ce.Rparen + 1 }
+
+// End of a string literal accounts for the quotes, which are not part of
+// its literal.
+func (sl *StringLiteral) Pos() int { return sl.Token.Offset }
+func (sl *StringLiteral) End() int { return tokenEnd(sl.Token) }
+
+func (al *ArrayLiteral) Pos() int { return al.Token.Offset }
+func (al *ArrayLiteral) End() int { return al.Rbracket + 1 }
+
+func (ie *IndexExpression) Pos() int { return ie.Left.Pos() }
+func (ie *IndexExpression) End() int { return ie.Rbracket + 1 }
+
+func (me *MemberExpression) Pos() int { return me.Object.Pos() }
+
+func (me *MemberExpression) End() int {
+	if me.Property == nil {
+		return tokenEnd(me.Token)
+	}
+	return me.Property.End()
+}
+
+func (sl *SetLiteral) Pos() int { return sl.Token.Offset }
+func (sl *SetLiteral) End() int { return sl.Rbrace + 1 }
+
+func (hl *HashLiteral) Pos() int { return hl.Token.Offset }
+func (hl *HashLiteral) End() int { return hl.Rbrace + 1 }
@@ -0,0 +1,134 @@
+package ast
+
+import "sort"
+
+// Inspect traverses the tree rooted at node in depth-first order. It calls
+// f for each node, and descends into the node's children only if f returns
+// true. Hash literal pairs are visited in the order of their keys' String,
+// key before value.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		inspectStatements(node.Statements, f)
+	case *BlockStatement:
+		inspectStatements(node.Statements, f)
+	case *LetStatement:
+		Inspect(node.Name, f)
+		inspectExpression(node.Value, f)
+	case *DestructuringStatement:
+		if node.Pattern != nil {
+			Inspect(node.Pattern, f)
+		}
+		inspectExpression(node.Value, f)
+	case *ArrayPattern:
+		for _, name := range node.Names() {
+			Inspect(name, f)
+		}
+	case *HashPattern:
+		for _, name := range node.Values {
+			Inspect(name, f)
+		}
+	case *ReturnStatement:
+		inspectExpression(node.ReturnValue, f)
+	case *DeferStatement:
+		inspectExpression(node.Expression, f)
+	case *YieldStatement:
+		inspectExpression(node.Value, f)
+	case *ForInStatement:
+		if node.Key != nil {
+			Inspect(node.Key, f)
+		}
+		Inspect(node.Variable, f)
+		inspectExpression(node.Iterable, f)
+		if node.Body != nil {
+			Inspect(node.Body, f)
+		}
+	case *ExpressionStatement:
+		inspectExpression(node.Expression, f)
+	case *FunctionStatement:
+		Inspect(node.Name, f)
+		Inspect(node.Function, f)
+	case *PrefixExpression:
+		inspectExpression(node.Right, f)
+	case *InfixExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Right, f)
+	case *ChainedComparison:
+		inspectExpressions(node.Operands, f)
+	case *IfExpression:
+		inspectExpression(node.Condition, f)
+		if node.Consequence != nil {
+			Inspect(node.Consequence, f)
+		}
+		if node.Alternative != nil {
+			Inspect(node.Alternative, f)
+		}
+	case *BlockExpression:
+		if node.Block != nil {
+			Inspect(node.Block, f)
+		}
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			Inspect(param, f)
+		}
+		if node.Body != nil {
+			Inspect(node.Body, f)
+		}
+	case *CallExpression:
+		inspectExpression(node.Function, f)
+		inspectExpressions(node.Arguments, f)
+	case *ArrayLiteral:
+		inspectExpressions(node.Elements, f)
+	case *SetLiteral:
+		inspectExpressions(node.Elements, f)
+	case *IndexExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Index, f)
+	case *MemberExpression:
+		inspectExpression(node.Object, f)
+		Inspect(node.Property, f)
+	case *HashLiteral:
+		for _, key := range sortedKeys(node) {
+			inspectExpression(key, f)
+			inspectExpression(node.Pairs[key], f)
+		}
+	}
+}
+
+// inspectExpression inspects an expression that may be nil.
+func inspectExpression(exp Expression, f func(Node) bool) {
+	if exp != nil {
+		Inspect(exp, f)
+	}
+}
+
+// inspectExpressions inspects each expression in a list.
+func inspectExpressions(exps []Expression, f func(Node) bool) {
+	for _, exp := range exps {
+		inspectExpression(exp, f)
+	}
+}
+
+// inspectStatements inspects each statement in a list.
+func inspectStatements(stmts []Statement, f func(Node) bool) {
+	for _, stmt := range stmts {
+		if stmt != nil {
+			Inspect(stmt, f)
+		}
+	}
+}
+
+// sortedKeys returns the keys of a hash literal ordered by their String.
+func sortedKeys(hash *HashLiteral) []Expression {
+	keys := make([]Expression, 0, len(hash.Pairs))
+	for key := range hash.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	return keys
+}
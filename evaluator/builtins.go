@@ -3,36 +3,40 @@ package evaluator
 import (
 	"fmt"
 	"leopard/object"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var builtins = map[string]*object.Builtin{
-
-	// len returns the length of a given object
 	"len": &object.Builtin{
+		Name:        "len",
+		Description: "Returns the length of a given object.",
+		MinArgs:     1,
+		MaxArgs:     1,
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
 			switch arg := args[0].(type) {
 			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
+				return newInteger(int64(len(arg.Elements)))
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				return newInteger(int64(len(arg.Value)))
+			case *object.Set:
+				return newInteger(int64(len(arg.Elements)))
 			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
+				return newCodedError(object.TYPE_ERROR, "argument to `len` not supported, got %s", args[0].Type())
 			}
 		},
 	},
 
-	// first returns the first element of the given array
 	"first": &object.Builtin{
+		Name:        "first",
+		Description: "Returns the first element of the given array.",
+		MinArgs:     1,
+		MaxArgs:     1,
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+				return newCodedError(object.TYPE_ERROR, "argument to `first` must be ARRAY, got %s", args[0].Type())
 			}
 
 			arr := args[0].(*object.Array)
@@ -44,14 +48,14 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 
-	// last returns the last element of the given array
 	"last": &object.Builtin{
+		Name:        "last",
+		Description: "Returns the last element of the given array.",
+		MinArgs:     1,
+		MaxArgs:     1,
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("arugment to `last` must be ARRAY, got %s", args[0].Type())
+				return newCodedError(object.TYPE_ERROR, "argument to `last` must be ARRAY, got %s", args[0].Type())
 			}
 
 			arr := args[0].(*object.Array)
@@ -64,14 +68,14 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 
-	// rest returns a new array containing all elements except the first one.
 	"rest": &object.Builtin{
+		Name:        "rest",
+		Description: "Returns a new array containing all elements except the first one. Like first, it returns null for an empty array.",
+		MinArgs:     1,
+		MaxArgs:     1,
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+				return newCodedError(object.TYPE_ERROR, "argument to `rest` must be ARRAY, got %s", args[0].Type())
 			}
 
 			arr := args[0].(*object.Array)
@@ -86,15 +90,36 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 
-	// push adds a new element to the end of the array
-	"push": &object.Builtin{
+	"init": &object.Builtin{
+		Name:        "init",
+		Description: "Returns a new array containing all elements except the last one. Like last, it returns null for an empty array.",
+		MinArgs:     1,
+		MaxArgs:     1,
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			if args[0].Type() != object.ARRAY_OBJ {
+				return newCodedError(object.TYPE_ERROR, "argument to `init` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				newElements := make([]object.Object, length-1, length-1)
+				copy(newElements, arr.Elements[:length-1])
+				return &object.Array{Elements: newElements}
 			}
 
+			return NULL
+		},
+	},
+
+	"push": &object.Builtin{
+		Name:        "push",
+		Description: "Adds a new element to the end of the array.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Fn: func(args ...object.Object) object.Object {
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+				return newCodedError(object.TYPE_ERROR, "argument to `push` must be ARRAY, got %s", args[0].Type())
 			}
 
 			arr := args[0].(*object.Array)
@@ -108,8 +133,359 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 
-	// puts prints the given arguments on new lines to STDOUT.
+	"chunk": &object.Builtin{
+		Name:        "chunk",
+		Description: "Splits an array into arrays of the given size, the last of which may be shorter.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Fn: func(args ...object.Object) object.Object {
+			if args[0].Type() != object.ARRAY_OBJ {
+				return newCodedError(object.TYPE_ERROR, "first argument to `chunk` must be ARRAY, got %s", args[0].Type())
+			}
+			if args[1].Type() != object.INTEGER_OBJ {
+				return newCodedError(object.TYPE_ERROR, "second argument to `chunk` must be INTEGER, got %s", args[1].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			size := args[1].(*object.Integer).Value
+			if size <= 0 {
+				return newCodedError(object.RANGE_ERROR, "chunk size must be positive, got %d", size)
+			}
+
+			chunks := []object.Object{}
+			for start := 0; start < len(arr.Elements); start += int(size) {
+				end := start + int(size)
+				if end > len(arr.Elements) {
+					end = len(arr.Elements)
+				}
+
+				elements := make([]object.Object, end-start)
+				copy(elements, arr.Elements[start:end])
+				chunks = append(chunks, &object.Array{Elements: elements})
+			}
+
+			return &object.Array{Elements: chunks}
+		},
+	},
+
+	"take": &object.Builtin{
+		Name:        "take",
+		Description: "Returns a new array with the first n elements of the array, or all of them if there are fewer than n.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}, {object.INTEGER_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			elements, n, err := splitArgs("take", args)
+			if err != nil {
+				return err
+			}
+
+			return &object.Array{Elements: copyElements(elements[:n])}
+		},
+	},
+
+	"drop": &object.Builtin{
+		Name:        "drop",
+		Description: "Returns a new array without the first n elements of the array, which is empty if there are fewer than n.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}, {object.INTEGER_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			elements, n, err := splitArgs("drop", args)
+			if err != nil {
+				return err
+			}
+
+			return &object.Array{Elements: copyElements(elements[n:])}
+		},
+	},
+
+	"sum": &object.Builtin{
+		Name:        "sum",
+		Description: "Returns the sum of an array of numbers, which is an integer if they are all integers and a float otherwise. The sum of an empty array is 0.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			return foldNumbers("sum", args[0].(*object.Array).Elements, 0,
+				func(a, b int64) int64 { return a + b },
+				func(a, b float64) float64 { return a + b })
+		},
+	},
+
+	"product": &object.Builtin{
+		Name:        "product",
+		Description: "Returns the product of an array of numbers, which is an integer if they are all integers and a float otherwise. The product of an empty array is 1.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			return foldNumbers("product", args[0].(*object.Array).Elements, 1,
+				func(a, b int64) int64 { return a * b },
+				func(a, b float64) float64 { return a * b })
+		},
+	},
+
+	"entries": &object.Builtin{
+		Name:        "entries",
+		Description: "Returns the pairs of a hash as [key, value] arrays sorted by key. Keys of the same type are in their natural order; keys of different types are grouped by type name.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		ArgTypes:    [][]object.ObjectType{{object.HASH_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			hash := args[0].(*object.Hash)
+
+			pairs := make([]object.HashPair, 0, len(hash.Pairs))
+			for _, pair := range hash.Pairs {
+				pairs = append(pairs, pair)
+			}
+			sort.Slice(pairs, func(i, j int) bool {
+				return keyLess(pairs[i].Key, pairs[j].Key)
+			})
+
+			entries := make([]object.Object, len(pairs))
+			for i, pair := range pairs {
+				entries[i] = &object.Array{Elements: []object.Object{pair.Key, pair.Value}}
+			}
+
+			return &object.Array{Elements: entries}
+		},
+	},
+
+	"add": &object.Builtin{
+		Name:        "add",
+		Description: "Returns a new set containing the elements of the set and the new element.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Fn: func(args ...object.Object) object.Object {
+			if args[0].Type() != object.SET_OBJ {
+				return newCodedError(object.TYPE_ERROR, "first argument to `add` must be SET, got %s", args[0].Type())
+			}
+
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newCodedError(object.TYPE_ERROR, "unusable as set element: %s", args[1].Type())
+			}
+
+			set := args[0].Clone().(*object.Set)
+			set.Elements[key.HashKey()] = args[1]
+
+			return set
+		},
+	},
+
+	"remove": &object.Builtin{
+		Name:        "remove",
+		Description: "Returns a new set containing the elements of the set except the given element.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Fn: func(args ...object.Object) object.Object {
+			if args[0].Type() != object.SET_OBJ {
+				return newCodedError(object.TYPE_ERROR, "first argument to `remove` must be SET, got %s", args[0].Type())
+			}
+
+			set := args[0].Clone().(*object.Set)
+			if key, ok := args[1].(object.Hashable); ok {
+				delete(set.Elements, key.HashKey())
+			}
+
+			return set
+		},
+	},
+
+	"union": &object.Builtin{
+		Name:        "union",
+		Description: "Returns a new set containing the elements found in either set.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		ArgTypes:    [][]object.ObjectType{{object.SET_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			set := args[0].Clone().(*object.Set)
+			for key, el := range args[1].(*object.Set).Elements {
+				set.Elements[key] = el
+			}
+
+			return set
+		},
+	},
+
+	"intersect": &object.Builtin{
+		Name:        "intersect",
+		Description: "Returns a new set containing the elements found in both sets.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		ArgTypes:    [][]object.ObjectType{{object.SET_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			left := args[0].(*object.Set)
+			right := args[1].(*object.Set)
+
+			set := &object.Set{Elements: make(map[object.HashKey]object.Object)}
+			for key, el := range left.Elements {
+				if _, ok := right.Elements[key]; ok {
+					set.Elements[key] = el
+				}
+			}
+
+			return set
+		},
+	},
+
+	"lower": stringFunction("lower", "Returns the string with all letters mapped to lower case.", strings.ToLower),
+
+	"upper": stringFunction("upper", "Returns the string with all letters mapped to upper case.", strings.ToUpper),
+
+	"capitalize": stringFunction("capitalize", "Returns the string with its first letter in upper case and the rest in lower case.", capitalize),
+
+	"replace": &object.Builtin{
+		Name:        "replace",
+		Description: "Returns a copy of the string with every non-overlapping occurrence of old, scanning from the left, replaced by new.",
+		MinArgs:     3,
+		MaxArgs:     3,
+		ArgTypes:    [][]object.ObjectType{{object.STRING_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			s := args[0].(*object.String).Value
+			old := args[1].(*object.String).Value
+			new := args[2].(*object.String).Value
+
+			return &object.String{Value: strings.ReplaceAll(s, old, new)}
+		},
+	},
+
+	"starts_with": &object.Builtin{
+		Name:        "starts_with",
+		Description: "Reports whether the string begins with the given prefix.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		ArgTypes:    [][]object.ObjectType{{object.STRING_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			s := args[0].(*object.String).Value
+			prefix := args[1].(*object.String).Value
+
+			return nativeBoolToBooleanObject(strings.HasPrefix(s, prefix))
+		},
+	},
+
+	"ends_with": &object.Builtin{
+		Name:        "ends_with",
+		Description: "Reports whether the string ends with the given suffix.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		ArgTypes:    [][]object.ObjectType{{object.STRING_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			s := args[0].(*object.String).Value
+			suffix := args[1].(*object.String).Value
+
+			return nativeBoolToBooleanObject(strings.HasSuffix(s, suffix))
+		},
+	},
+
+	"contains": &object.Builtin{
+		Name:        "contains",
+		Description: "Reports whether the substring occurs within the string, or whether the element is a member of the set.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Fn: func(args ...object.Object) object.Object {
+			if args[0].Type() == object.SET_OBJ {
+				key, ok := args[1].(object.Hashable)
+				if !ok {
+					return FALSE
+				}
+
+				_, ok = args[0].(*object.Set).Elements[key.HashKey()]
+				return nativeBoolToBooleanObject(ok)
+			}
+			if err := checkStringArgs("contains", args); err != nil {
+				return err
+			}
+
+			s := args[0].(*object.String).Value
+			sub := args[1].(*object.String).Value
+
+			return nativeBoolToBooleanObject(strings.Contains(s, sub))
+		},
+	},
+
+	"index_of": &object.Builtin{
+		Name:        "index_of",
+		Description: "Returns the byte index of the first occurrence of the substring, or -1 if it is not present. Byte indices match `len`, which also counts bytes.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		ArgTypes:    [][]object.ObjectType{{object.STRING_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			s := args[0].(*object.String).Value
+			sub := args[1].(*object.String).Value
+
+			return newInteger(int64(strings.Index(s, sub)))
+		},
+	},
+
+	"freeze": &object.Builtin{
+		Name:        "freeze",
+		Description: "Returns a copy of the function that captures a snapshot of its environment, so later bindings in that environment do not affect it.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Fn: func(args ...object.Object) object.Object {
+			if args[0].Type() != object.FUNCTION_OBJ {
+				return newCodedError(object.TYPE_ERROR, "argument to `freeze` must be FUNCTION, got %s", args[0].Type())
+			}
+
+			fn := args[0].(*object.Function)
+
+			return &object.Function{Parameters: fn.Parameters, Body: fn.Body, Env: fn.Env.Clone()}
+		},
+	},
+
+	"inspect": &object.Builtin{
+		Name:        "inspect",
+		Description: "Returns a multi-line description of the value showing the type of every value nested inside it.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Fn: func(args ...object.Object) object.Object {
+			return &object.String{Value: object.Describe(args[0])}
+		},
+	},
+
+	"string_builder": &object.Builtin{
+		Name:        "string_builder",
+		Description: "Returns a new, empty string builder. Appending to it with `append` is much faster than repeated `+` for building long strings.",
+		MinArgs:     0,
+		MaxArgs:     0,
+		Fn: func(args ...object.Object) object.Object {
+			return &object.StringBuilder{}
+		},
+	},
+
+	"append": &object.Builtin{
+		Name:        "append",
+		Description: "Appends the remaining arguments to the string builder, converting each as `puts` prints it, and returns the builder.",
+		MinArgs:     1,
+		MaxArgs:     -1,
+		ArgTypes:    [][]object.ObjectType{{object.BUILDER_OBJ}, {object.ANY_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			sb := args[0].(*object.StringBuilder)
+			for _, arg := range args[1:] {
+				sb.Builder.WriteString(arg.Inspect())
+			}
+			return sb
+		},
+	},
+
+	"to_string": &object.Builtin{
+		Name:        "to_string",
+		Description: "Returns the string built so far by the string builder.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		ArgTypes:    [][]object.ObjectType{{object.BUILDER_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			return &object.String{Value: args[0].(*object.StringBuilder).Builder.String()}
+		},
+	},
+
 	"puts": &object.Builtin{
+		Name:        "puts",
+		Description: "Prints the given arguments on new lines to STDOUT.",
+		MinArgs:     0,
+		MaxArgs:     -1,
 		Fn: func(args ...object.Object) object.Object {
 			for _, arg := range args {
 				fmt.Println(arg.Inspect())
@@ -119,3 +495,181 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 }
+
+// stringFunction wraps a function transforming a single Go string as a builtin.
+func stringFunction(name, description string, fn func(string) string) *object.Builtin {
+	return &object.Builtin{
+		Name:        name,
+		Description: description,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Fn: func(args ...object.Object) object.Object {
+			if args[0].Type() != object.STRING_OBJ {
+				return newCodedError(object.TYPE_ERROR, "argument to `%s` must be STRING, got %s", name, args[0].Type())
+			}
+
+			return &object.String{Value: fn(args[0].(*object.String).Value)}
+		},
+	}
+}
+
+// capitalize maps the first rune of s to upper case and the rest to lower case.
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return s
+	}
+
+	return string(unicode.ToUpper(r)) + strings.ToLower(s[size:])
+}
+
+// checkStringArgs returns an error unless all of the arguments are strings.
+// Builtins whose argument types do not depend on each other declare them in
+// ArgTypes instead.
+func checkStringArgs(name string, args []object.Object) *object.Error {
+	for i, arg := range args {
+		if arg.Type() != object.STRING_OBJ {
+			return newCodedError(object.TYPE_ERROR, "argument %d to `%s` must be STRING, got %s", i+1, name, arg.Type())
+		}
+	}
+
+	return nil
+}
+
+// checkArity returns an error unless the number of arguments lies within the
+// builtin's MinArgs and MaxArgs. Builtins without a Name, such as those
+// returned by partial or memoize, declare no arity and are not checked.
+func checkArity(builtin *object.Builtin, args []object.Object) *object.Error {
+	if builtin.Name == "" {
+		return nil
+	}
+
+	got := len(args)
+	switch {
+	case builtin.MaxArgs < 0 && got < builtin.MinArgs:
+		return newCodedError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want at least %d", got, builtin.MinArgs)
+	case builtin.MaxArgs < 0:
+		return nil
+	case got >= builtin.MinArgs && got <= builtin.MaxArgs:
+		return nil
+	case builtin.MinArgs == builtin.MaxArgs:
+		return newCodedError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=%d", got, builtin.MinArgs)
+	case builtin.MaxArgs == builtin.MinArgs+1:
+		return newCodedError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=%d or %d", got, builtin.MinArgs, builtin.MaxArgs)
+	default:
+		return newCodedError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=%d to %d", got, builtin.MinArgs, builtin.MaxArgs)
+	}
+}
+
+// checkArgTypes returns an error unless each argument has one of the types
+// the builtin declares for it in ArgTypes.
+func checkArgTypes(builtin *object.Builtin, args []object.Object) *object.Error {
+	if len(builtin.ArgTypes) == 0 {
+		return nil
+	}
+
+	for i, arg := range args {
+		types := builtin.ArgTypes[len(builtin.ArgTypes)-1]
+		if i < len(builtin.ArgTypes) {
+			types = builtin.ArgTypes[i]
+		}
+		if !hasType(arg, types) {
+			return newCodedError(object.TYPE_ERROR, "argument %d to `%s` must be %s, got %s", i+1, builtin.Name, typeList(types), arg.Type())
+		}
+	}
+
+	return nil
+}
+
+// hasType checks whether obj has one of the given types.
+func hasType(obj object.Object, types []object.ObjectType) bool {
+	for _, t := range types {
+		if t == object.ANY_OBJ || t == obj.Type() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typeList joins types for an error message, as in "INTEGER, FLOAT or STRING".
+func typeList(types []object.ObjectType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// splitArgs returns the elements of the array argument to take or drop and
+// the count argument clamped to the array's length.
+func splitArgs(name string, args []object.Object) ([]object.Object, int, *object.Error) {
+	elements := args[0].(*object.Array).Elements
+	n := args[1].(*object.Integer).Value
+	if n < 0 {
+		return nil, 0, newCodedError(object.RANGE_ERROR, "argument 2 to `%s` must not be negative, got %d", name, n)
+	}
+	if n > int64(len(elements)) {
+		n = int64(len(elements))
+	}
+
+	return elements, int(n), nil
+}
+
+// copyElements returns a copy of elements, so the result does not share its
+// backing array with the original.
+func copyElements(elements []object.Object) []object.Object {
+	result := make([]object.Object, len(elements))
+	copy(result, elements)
+
+	return result
+}
+
+// foldNumbers combines numeric elements, starting from identity, with intOp
+// while they are all integers and with floatOp once a float is seen.
+func foldNumbers(name string, elements []object.Object, identity int64, intOp func(a, b int64) int64, floatOp func(a, b float64) float64) object.Object {
+	intResult := identity
+	floatResult := float64(identity)
+	isFloat := false
+
+	for i, el := range elements {
+		switch el := el.(type) {
+		case *object.Integer:
+			intResult = intOp(intResult, el.Value)
+			floatResult = floatOp(floatResult, float64(el.Value))
+		case *object.Float:
+			isFloat = true
+			floatResult = floatOp(floatResult, el.Value)
+		default:
+			return newCodedError(object.TYPE_ERROR, "element %d of argument to `%s` must be INTEGER or FLOAT, got %s", i, name, el.Type())
+		}
+	}
+
+	if isFloat {
+		return &object.Float{Value: floatResult}
+	}
+	return newInteger(intResult)
+}
+
+// keyLess orders hash keys of the same type naturally, with false before
+// true, and keys of different types by the name of their type.
+func keyLess(a, b object.Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+
+	switch a := a.(type) {
+	case *object.Integer:
+		return a.Value < b.(*object.Integer).Value
+	case *object.String:
+		return a.Value < b.(*object.String).Value
+	case *object.Boolean:
+		return !a.Value && b.(*object.Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
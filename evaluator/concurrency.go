@@ -0,0 +1,236 @@
+package evaluator
+
+import (
+	"leopard/ast"
+	"leopard/object"
+	"math/rand"
+	"reflect"
+)
+
+// concurrencyBuiltins returns the builtins that run functions on their own
+// goroutines and pass values between them.
+func (e *Evaluator) concurrencyBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"spawn": &object.Builtin{
+			Name:        "spawn",
+			Description: "Calls the function with the remaining arguments on a goroutine of its own and returns a task for the call without waiting for it. Variables the function closes over stay shared with the caller.",
+			MinArgs:     1,
+			MaxArgs:     -1,
+			ArgTypes:    [][]object.ObjectType{{object.FUNCTION_OBJ, object.BUILTIN_OBJ}, {object.ANY_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				for _, arg := range args {
+					share(arg)
+				}
+
+				task := &object.Task{Done: make(chan struct{})}
+				child := e.fork()
+
+				go func() {
+					defer close(task.Done)
+					task.Result = child.applyFunction(args[0], args[1:])
+				}()
+
+				return task
+			},
+		},
+
+		"wait": &object.Builtin{
+			Name:        "wait",
+			Description: "Waits for the task returned by `spawn` to finish and returns the result of its call, or the error it failed with. Waiting again returns the same result.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.TASK_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				task := args[0].(*object.Task)
+				<-task.Done
+				if task.Result == nil {
+					return NULL
+				}
+				return task.Result
+			},
+		},
+
+		"channel": &object.Builtin{
+			Name:        "channel",
+			Description: "Returns a new unbuffered channel. A send on it waits until another function receives the value.",
+			MinArgs:     0,
+			MaxArgs:     0,
+			Fn: func(args ...object.Object) object.Object {
+				return &object.Channel{C: make(chan object.Object)}
+			},
+		},
+
+		"send": &object.Builtin{
+			Name:        "send",
+			Description: "Sends the value on the channel, waiting until it is received.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.CHANNEL_OBJ}, {object.ANY_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				share(args[1])
+				args[0].(*object.Channel).C <- args[1]
+				return NULL
+			},
+		},
+
+		"receive": &object.Builtin{
+			Name:        "receive",
+			Description: "Waits for a value to be sent on the channel and returns it.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.CHANNEL_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				return <-args[0].(*object.Channel).C
+			},
+		},
+
+		"select": &object.Builtin{
+			Name:        "select",
+			Description: "Waits until a value is sent on any of the channels in the array and returns `[index, value]`, where index is the position of the channel it was received from. If several are ready, one is chosen at random.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				elements := args[0].(*object.Array).Elements
+				if len(elements) == 0 {
+					return newError("`select` needs at least one channel")
+				}
+
+				cases := make([]reflect.SelectCase, len(elements))
+				for i, el := range elements {
+					ch, ok := el.(*object.Channel)
+					if !ok {
+						return newCodedError(object.TYPE_ERROR, "element %d of `select` must be CHANNEL, got %s", i, el.Type())
+					}
+					cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.C)}
+				}
+
+				i, val, _ := reflect.Select(cases)
+				return &object.Array{Elements: []object.Object{
+					newInteger(int64(i)),
+					val.Interface().(object.Object),
+				}}
+			},
+		},
+
+		"mutex": &object.Builtin{
+			Name:        "mutex",
+			Description: "Returns a new unlocked mutex.",
+			MinArgs:     0,
+			MaxArgs:     0,
+			Fn: func(args ...object.Object) object.Object {
+				return &object.Mutex{}
+			},
+		},
+
+		"lock": &object.Builtin{
+			Name:        "lock",
+			Description: "Locks the mutex, waiting until no other function holds it.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.MUTEX_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				args[0].(*object.Mutex).Mu.Lock()
+				return NULL
+			},
+		},
+
+		"unlock": &object.Builtin{
+			Name:        "unlock",
+			Description: "Unlocks the mutex. It is an error to unlock a mutex that is not locked.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.MUTEX_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				m := args[0].(*object.Mutex)
+				// Unlocking an unlocked sync.Mutex cannot be recovered
+				// from, so check first.
+				if m.Mu.TryLock() {
+					m.Mu.Unlock()
+					return newError("unlock of unlocked mutex")
+				}
+				m.Mu.Unlock()
+				return NULL
+			},
+		},
+
+		"atomic": &object.Builtin{
+			Name:        "atomic",
+			Description: "Returns a new atomic integer holding the given value, or 0.",
+			MinArgs:     0,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.INTEGER_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				a := &object.Atomic{}
+				if len(args) == 1 {
+					a.Value.Store(args[0].(*object.Integer).Value)
+				}
+				return a
+			},
+		},
+
+		"atomic_add": &object.Builtin{
+			Name:        "atomic_add",
+			Description: "Adds n to the atomic integer and returns its new value. `atomic_add(ref, 0)` reads it.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.ATOMIC_OBJ}, {object.INTEGER_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				n := args[0].(*object.Atomic).Value.Add(args[1].(*object.Integer).Value)
+				return newInteger(n)
+			},
+		},
+	}
+}
+
+// share makes the environments of the functions in obj, including those
+// inside arrays and hashes, safe to use from the goroutine obj is handed
+// to. Arrays and hashes are not changed once created, so they cannot
+// contain themselves.
+func share(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Function:
+		obj.Env.Share()
+	case *object.Array:
+		for _, el := range obj.Elements {
+			share(el)
+		}
+	case *object.Hash:
+		for _, pair := range obj.Pairs {
+			share(pair.Value)
+		}
+	}
+}
+
+// fork returns an Evaluator for a function spawned on another goroutine.
+// It has the configuration of e and the same builtins, including those
+// added with Register, but its own call frames, random source and caches,
+// so that the two can evaluate at the same time. Builtins created at
+// runtime, such as the results of partial or memoize, call functions back
+// in whichever of them calls the builtin. Spawned functions are not
+// profiled, traced or covered, and tests they run are not reported.
+func (e *Evaluator) fork() *Evaluator {
+	child := &Evaluator{
+		builtins:  make(map[string]*object.Builtin),
+		rand:      rand.New(rand.NewSource(e.rand.Int63())),
+		now:       e.now,
+		sleep:     e.sleep,
+		sandboxed: e.sandboxed,
+		coerce:    e.coerce,
+		loose:     e.loose,
+		strict:    e.strict,
+		out:       e.out,
+		patterns:  newPatternCache(maxCachedPatterns),
+
+		generatorBodies: make(map[*ast.BlockStatement]bool),
+		registered:      make(map[string]bool),
+	}
+	child.installBuiltins()
+
+	for name := range e.registered {
+		child.builtins[name] = e.builtins[name]
+		child.registered[name] = true
+	}
+
+	return child
+}
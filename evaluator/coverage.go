@@ -0,0 +1,83 @@
+package evaluator
+
+import (
+	"leopard/ast"
+	"sort"
+)
+
+// Coverage records which AST nodes an Evaluator has evaluated.
+type Coverage struct {
+	executed map[ast.Node]bool
+}
+
+// TrackCoverage makes the Evaluator record every node it evaluates in a
+// Coverage, available from Coverage.
+func TrackCoverage() Option {
+	return func(e *Evaluator) {
+		e.coverage = &Coverage{executed: make(map[ast.Node]bool)}
+	}
+}
+
+// Coverage returns the coverage collected so far, or nil if the Evaluator
+// was not created with the TrackCoverage option.
+func (e *Evaluator) Coverage() *Coverage {
+	return e.coverage
+}
+
+// Executed reports whether node has been evaluated.
+func (c *Coverage) Executed(node ast.Node) bool {
+	return c.executed[node]
+}
+
+// UncoveredLines returns the sorted line numbers of program that contain
+// statements, none of which have been evaluated.
+func (c *Coverage) UncoveredLines(program *ast.Program) []int {
+	covered := make(map[int]bool)
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if line := statementLine(node); line > 0 {
+			covered[line] = covered[line] || c.executed[node]
+		}
+		return true
+	})
+
+	lines := []int{}
+	for line, ok := range covered {
+		if !ok {
+			lines = append(lines, line)
+		}
+	}
+	sort.Ints(lines)
+
+	return lines
+}
+
+// statementLine returns the line a statement starts on, or zero if node is
+// not a statement with a known position. Blocks are not counted, as they
+// only group other statements.
+func statementLine(node ast.Node) int {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token.Line
+	case *ast.DestructuringStatement:
+		return node.Token.Line
+	case *ast.ReturnStatement:
+		return node.Token.Line
+	case *ast.DeferStatement:
+		return node.Token.Line
+	case *ast.YieldStatement:
+		return node.Token.Line
+	case *ast.ForInStatement:
+		return node.Token.Line
+	case *ast.BreakStatement:
+		return node.Token.Line
+	case *ast.ContinueStatement:
+		return node.Token.Line
+	case *ast.ExpressionStatement:
+		return node.Token.Line
+	case *ast.FunctionStatement:
+		return node.Token.Line
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,50 @@
+package evaluator
+
+import (
+	"leopard/ast"
+	"leopard/object"
+)
+
+// frame holds the state of a function call in progress.
+type frame struct {
+	deferred []deferredExpression
+}
+
+// deferredExpression is an expression queued by a defer statement together
+// with the environment it is evaluated in.
+type deferredExpression struct {
+	expression ast.Expression
+	env        *object.Environment
+}
+
+// evalDeferStatement queues the statement's expression on the innermost
+// function call.
+func (e *Evaluator) evalDeferStatement(node *ast.DeferStatement, env *object.Environment) object.Object {
+	if len(e.frames) == 0 {
+		return newError("defer outside function")
+	}
+
+	f := e.frames[len(e.frames)-1]
+	f.deferred = append(f.deferred, deferredExpression{expression: node.Expression, env: env})
+
+	return nil
+}
+
+// runDeferred pops the innermost function call and evaluates its deferred
+// expressions, last queued first. They run even if the call failed. Their
+// values are discarded, but an error from one of them replaces the call's
+// result unless that is an error already.
+func (e *Evaluator) runDeferred(result object.Object) object.Object {
+	f := e.frames[len(e.frames)-1]
+	e.frames = e.frames[:len(e.frames)-1]
+
+	for i := len(f.deferred) - 1; i >= 0; i-- {
+		d := f.deferred[i]
+		val := unwrapReturnValue(e.Eval(d.expression, d.env))
+		if isError(val) && !isError(result) {
+			result = val
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,84 @@
+package evaluator
+
+import (
+	"leopard/ast"
+	"leopard/object"
+)
+
+// evalDestructuringStatement evaluates the value of a destructuring let
+// statement and binds its parts to the names in the pattern. No name is
+// bound if the value does not match the pattern.
+func (e *Evaluator) evalDestructuringStatement(node *ast.DestructuringStatement, env *object.Environment) object.Object {
+	if err := checkWritable(env, node.Pattern.Names()...); err != nil {
+		return err
+	}
+
+	val := e.Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	switch pattern := node.Pattern.(type) {
+	case *ast.ArrayPattern:
+		return bindArrayPattern(pattern, val, env)
+	case *ast.HashPattern:
+		return bindHashPattern(pattern, val, env)
+	default:
+		return newError("unknown pattern: %T", pattern)
+	}
+}
+
+// bindArrayPattern binds the elements of val to the names in pattern. The
+// array must have exactly as many elements as the pattern has names, or at
+// least as many if the pattern has a rest element.
+func bindArrayPattern(pattern *ast.ArrayPattern, val object.Object, env *object.Environment) object.Object {
+	arr, ok := val.(*object.Array)
+	if !ok {
+		return newCodedError(object.TYPE_ERROR, "cannot destructure %s with an array pattern", val.Type())
+	}
+
+	want := len(pattern.Elements)
+	got := len(arr.Elements)
+	switch {
+	case pattern.Rest == nil && got != want:
+		return newCodedError(object.ARITY_ERROR, "wrong number of values to destructure. got=%d, want=%d", got, want)
+	case got < want:
+		return newCodedError(object.ARITY_ERROR, "wrong number of values to destructure. got=%d, want at least %d", got, want)
+	}
+
+	for i, name := range pattern.Elements {
+		bind(env, name.Value, arr.Elements[i])
+	}
+	if pattern.Rest != nil {
+		bind(env, pattern.Rest.Value, &object.Array{Elements: copyElements(arr.Elements[want:])})
+	}
+
+	return nil
+}
+
+// bindHashPattern binds the values of the string keys in pattern to their
+// names. It is an error for the hash to lack any of the keys; use ?? on a
+// separate lookup for keys that may be missing.
+func bindHashPattern(pattern *ast.HashPattern, val object.Object, env *object.Environment) object.Object {
+	hash, ok := val.(*object.Hash)
+	if !ok {
+		return newCodedError(object.TYPE_ERROR, "cannot destructure %s with a hash pattern", val.Type())
+	}
+
+	values := make([]object.Object, len(pattern.Keys))
+	for i, key := range pattern.Keys {
+		pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+		if !ok {
+			err := newCodedError(object.KEY_ERROR, "key not found: %s", key)
+			err.Data = errorData(map[string]string{"key": key})
+			return err
+		}
+		values[i] = pair.Value
+	}
+
+	for i, name := range pattern.Values {
+		bind(env, name.Value, values[i])
+	}
+
+	return nil
+}
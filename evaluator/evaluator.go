@@ -7,137 +7,518 @@ package evaluator
 
 import (
 	"fmt"
+	"io"
 	"leopard/ast"
 	"leopard/object"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
 )
 
 // Global values for NULL, TRUE, and FALSE
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
+// Evaluator holds the state of a single interpreter session. Builtins that
+// depend on that state, such as the random number generator, are bound to it.
+type Evaluator struct {
+	builtins  map[string]*object.Builtin // bound to e or added with Register
+	shared    map[string]*object.Builtin // sharedBuiltins or sharedSandboxedBuiltins
+	rand      *rand.Rand
+	now       func() time.Time
+	sleep     func(time.Duration)
+	sandboxed bool
+	coerce    bool
+	loose     bool
+	strict    bool
+	profile   *Profile
+	coverage  *Coverage
+	tracer    Tracer
+	out       io.Writer
+	tests     []testResult
+	frames    []*frame
+	patterns  *patternCache
+	generator *generator
+	programs  *programCache
+
+	generatorBodies map[*ast.BlockStatement]bool
+	registered      map[string]bool // names of builtins added with Register
+}
+
+// Option configures an Evaluator created by New.
+type Option func(*Evaluator)
+
+// Sandboxed disables the builtins that access the host, such as `env`,
+// `read_file` and `write_file`, for evaluating untrusted code. Calling one
+// of them returns an error instead.
+func Sandboxed() Option {
+	return func(e *Evaluator) {
+		e.sandboxed = true
+	}
+}
+
+// StringCoercion makes "+" convert the other operand to a string when one
+// operand is a string, so "count: " + 5 yields "count: 5". Without it such
+// expressions are a type mismatch.
+func StringCoercion() Option {
+	return func(e *Evaluator) {
+		e.coerce = true
+	}
+}
+
+// LooseTruthiness makes 0, 0.0, "" and empty arrays, hashes and sets falsy
+// in conditions, as they are in JavaScript. By default only false and null
+// are falsy.
+func LooseTruthiness() Option {
+	return func(e *Evaluator) {
+		e.loose = true
+	}
+}
+
+// StrictIndexing makes indexing an array outside its bounds a RANGE_ERROR.
+// By default it yields null. Optional indexing with ?[ still yields null.
+func StrictIndexing() Option {
+	return func(e *Evaluator) {
+		e.strict = true
+	}
+}
+
+// Output makes the Evaluator write reports, such as the summary of tests run
+// with the `test` builtin or the output of `help`, to w instead of standard
+// output.
+func Output(w io.Writer) Option {
+	return func(e *Evaluator) {
+		e.out = w
+	}
+}
+
+// New creates a new Evaluator with its own randomly seeded random source
+// and the system clock, configured by the given options.
+func New(opts ...Option) *Evaluator {
+	e := &Evaluator{
+		builtins: make(map[string]*object.Builtin),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:      time.Now,
+		sleep:    time.Sleep,
+		out:      os.Stdout,
+		patterns: newPatternCache(maxCachedPatterns),
+
+		generatorBodies: make(map[*ast.BlockStatement]bool),
+		registered:      make(map[string]bool),
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.installBuiltins()
+
+	return e
+}
+
+// sharedBuiltins and sharedSandboxedBuiltins hold the builtins that do not
+// depend on the state of an Evaluator, without and with the host builtins
+// disabled. They are built once and shared by all Evaluators, which must
+// not change them.
+var (
+	sharedBuiltins          = newSharedBuiltins(false)
+	sharedSandboxedBuiltins = newSharedBuiltins(true)
+)
+
+// newSharedBuiltins merges the builtins that do not depend on the state of
+// an Evaluator into one table.
+func newSharedBuiltins(sandboxed bool) map[string]*object.Builtin {
+	shared := make(map[string]*object.Builtin)
+	for name, builtin := range builtins {
+		shared[name] = builtin
+	}
+	for name, builtin := range scopeBuiltins() {
+		shared[name] = builtin
+	}
+	for name, builtin := range hostBuiltins() {
+		if sandboxed {
+			builtin = sandboxedBuiltin(builtin)
+		}
+		shared[name] = builtin
+	}
+	return shared
+}
+
+// installBuiltins adds the standard builtins to e, binding those that
+// depend on its state to it. The others are looked up in a shared table.
+func (e *Evaluator) installBuiltins() {
+	e.shared = sharedBuiltins
+	if e.sandboxed {
+		e.shared = sharedSandboxedBuiltins
+	}
+
+	for name, builtin := range e.randomBuiltins() {
+		e.builtins[name] = builtin
+	}
+	for name, builtin := range e.timeBuiltins() {
+		e.builtins[name] = builtin
+	}
+	for name, builtin := range e.functionalBuiltins() {
+		e.builtins[name] = builtin
+	}
+	for name, builtin := range e.testingBuiltins() {
+		e.builtins[name] = builtin
+	}
+	for name, builtin := range e.regexBuiltins() {
+		e.builtins[name] = builtin
+	}
+	for name, builtin := range e.generatorBuiltins() {
+		e.builtins[name] = builtin
+	}
+	for name, builtin := range e.helpBuiltins() {
+		e.builtins[name] = builtin
+	}
+	for name, builtin := range e.concurrencyBuiltins() {
+		e.builtins[name] = builtin
+	}
+}
+
+// builtin returns the builtin named name, preferring those bound to e or
+// added with Register over the shared ones.
+func (e *Evaluator) builtin(name string) (*object.Builtin, bool) {
+	if builtin, ok := e.builtins[name]; ok {
+		return builtin, true
+	}
+	builtin, ok := e.shared[name]
+	return builtin, ok
+}
+
+// builtinNames returns the names of the builtins available to e, unsorted.
+func (e *Evaluator) builtinNames() []string {
+	names := make([]string, 0, len(e.builtins)+len(e.shared))
+	for name := range e.builtins {
+		names = append(names, name)
+	}
+	for name := range e.shared {
+		if _, ok := e.builtins[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Register makes fn available to scripts evaluated by e under name,
+// replacing any builtin already registered with that name. It lets hosts
+// embedding the interpreter expose their own functions.
+func (e *Evaluator) Register(name string, fn object.BuiltinFunction) {
+	e.builtins[name] = &object.Builtin{Fn: fn, Name: name, MaxArgs: -1}
+	e.registered[name] = true
+}
+
+// BuiltinNames returns the sorted names of the builtins and builtin
+// namespaces available to scripts evaluated by e.
+func (e *Evaluator) BuiltinNames() []string {
+	names := e.builtinNames()
+	for name := range namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Eval evaluates an AST node using a new Evaluator with the default
+// configuration. Each call has its own Evaluator, so calls from several
+// goroutines do not share call frames or a random source, and a script
+// calling `seed` does not reseed others.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
 // Eval evaluates an AST node and returns an object.Object representation.
 // Supports evaluation of programs, expressions, and various literal types.
-func Eval(node ast.Node, env *object.Environment) object.Object {
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if e.tracer != nil && node != nil {
+		e.tracer.BeforeEval(node, env)
+	}
+	if e.coverage != nil {
+		e.coverage.executed[node] = true
+	}
+	if e.profile != nil {
+		return e.evalProfiled(node, env)
+	}
+	return e.eval(node, env)
+}
+
+// eval evaluates node without profiling.
+func (e *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	case *ast.Program:
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return newInteger(node.Value)
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return e.evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		if node.Operator == "??" {
+			// The right operand is only evaluated when it is needed.
+			if left != NULL {
+				return left
+			}
+			return e.Eval(node.Right, env)
+		}
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return e.evalInfixExpression(node.Operator, left, right)
+
+	case *ast.ChainedComparison:
+		return e.evalChainedComparison(node, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+
+	case *ast.BlockExpression:
+		return e.evalBlockExpression(node, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := e.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.DeferStatement:
+		return e.evalDeferStatement(node, env)
+
+	case *ast.YieldStatement:
+		return e.evalYieldStatement(node, env)
+
+	case *ast.ForInStatement:
+		return e.evalForInStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		if err := checkWritable(env, node.Name); err != nil {
+			return err
+		}
+		if lit, ok := node.Value.(*ast.FunctionLiteral); ok {
+			bind(env, node.Name.Value, newRecursiveFunction(node.Name.Value, lit, env))
+			return nil
+		}
+
+		val := e.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		bind(env, node.Name.Value, val)
+
+	case *ast.DestructuringStatement:
+		return e.evalDestructuringStatement(node, env)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
 		return &object.Function{Parameters: params, Env: env, Body: body}
 
+	case *ast.FunctionStatement:
+		if err := checkWritable(env, node.Name); err != nil {
+			return err
+		}
+		env.Set(node.Name.Value, newRecursiveFunction(node.Name.Value, node.Function, env))
+
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := e.Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		if builtin, ok := function.(*object.Builtin); ok && builtin.ScopedFn != nil {
+			return e.applyScopedBuiltin(builtin, args, env)
+		}
+		return e.applyFunction(function, args)
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		if node.Optional && left == NULL {
+			return NULL
+		}
+		index := e.Eval(node.Index, env)
 
 		if isError(index) {
 			return index
 		}
+		if e.strict && !node.Optional {
+			if err := checkArrayIndex(left, index); err != nil {
+				return err
+			}
+		}
 		return evalIndexExpression(left, index)
 
+	case *ast.MemberExpression:
+		obj := e.Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		if node.Optional && obj == NULL {
+			return NULL
+		}
+		return evalMemberExpression(obj, node.Property.Value)
+
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
+
+	case *ast.SetLiteral:
+		elements := e.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return newSet(elements)
 	}
 
 	return nil
 }
 
+// newRecursiveFunction creates a function from lit that can always refer to
+// itself by name. The name is bound in a scope of its own between the function
+// and env, so the function keeps calling itself even if name is later rebound
+// in env. Only the function's own name is bound early: functions referring
+// to each other still need all of them to be bound before the first call.
+func newRecursiveFunction(name string, lit *ast.FunctionLiteral, env *object.Environment) *object.Function {
+	fnEnv := object.NewEnclosedEnvironment(env)
+	fn := &object.Function{Parameters: lit.Parameters, Env: fnEnv, Body: lit.Body}
+	bind(fnEnv, name, fn)
+
+	return fn
+}
+
+// Throwaway is the identifier that discards what is bound to it, so that
+// unwanted values, parameters and loop variables can be ignored, as in
+// `let [_, x] = pair`. It can be bound any number of times but not read.
+const Throwaway = "_"
+
+// bind binds name to val in env, unless name is the throwaway identifier.
+func bind(env *object.Environment, name string, val object.Object) {
+	if name != Throwaway {
+		env.Set(name, val)
+	}
+}
+
+// BuiltinNames returns the sorted names of the builtins and builtin
+// namespaces of an Evaluator with the default configuration.
+func BuiltinNames() []string {
+	return New().BuiltinNames()
+}
+
+// Apply calls a Leopard function or builtin with the given arguments using
+// a new Evaluator with the default configuration, as Eval does, so that
+// hosts can call back into scripts. Errors are returned as *object.Error.
+func Apply(fn object.Object, args ...object.Object) object.Object {
+	return New().Apply(fn, args...)
+}
+
+// Apply calls a Leopard function or builtin with the given arguments.
+func (e *Evaluator) Apply(fn object.Object, args ...object.Object) object.Object {
+	return e.applyFunction(fn, args)
+}
+
 // applyFunction applies a function or built-in function to arguments.
 // Supports user-defined functions and built-in functions.
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (e *Evaluator) applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
+		if len(args) < len(fn.Parameters) {
+			return newCodedError(object.ARITY_ERROR, "wrong number of arguments. got=%d, want=%d", len(args), len(fn.Parameters))
+		}
+		if e.isGenerator(fn) {
+			return e.newGenerator(fn, args)
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		e.frames = append(e.frames, &frame{})
+		evaluated := e.Eval(fn.Body, extendedEnv)
+		return e.runDeferred(unwrapReturnValue(evaluated))
 
 	case *object.Builtin:
+		if err := checkArity(fn, args); err != nil {
+			return err
+		}
+		if err := checkArgTypes(fn, args); err != nil {
+			return err
+		}
+		if fn.CallbackFn != nil {
+			return fn.CallbackFn(e.applyFunction, args...)
+		}
+		if fn.Fn == nil {
+			return newError("`%s` must be called directly", fn.Name)
+		}
 		return fn.Fn(args...)
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newCodedError(object.TYPE_ERROR, "not a function: %s", fn.Type())
+	}
+}
+
+// applyScopedBuiltin calls a builtin that acts on env, the environment of
+// the call.
+func (e *Evaluator) applyScopedBuiltin(fn *object.Builtin, args []object.Object, env *object.Environment) object.Object {
+	if err := checkArity(fn, args); err != nil {
+		return err
 	}
+	if err := checkArgTypes(fn, args); err != nil {
+		return err
+	}
+	return fn.ScopedFn(env, args...)
 }
 
 // extendFunctionEnv extends the function environment with argument bindings
@@ -145,27 +526,32 @@ func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Enviro
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		bind(env, param.Value, args[paramIdx])
 	}
 
 	return env
 }
 
-// unwrapReturnValue extracts the value from a ReturnValue object
+// unwrapReturnValue extracts the value from a ReturnValue object. A break
+// or continue that reaches the end of a function, which the parser does not
+// allow, becomes an error.
 func unwrapReturnValue(obj object.Object) object.Object {
-	if returnValue, ok := obj.(*object.ReturnValue); ok {
-		return returnValue
+	switch obj := obj.(type) {
+	case *object.ReturnValue:
+		return obj.Value
+	case *object.LoopControl:
+		return newError("%s outside loop", obj.Inspect())
 	}
 
 	return obj
 }
 
 // evalExpressions evaluates a list of expressions and returns a list of objects.
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
-	for _, e := range exps {
-		evaluated := Eval(e, env)
+	for _, exp := range exps {
+		evaluated := e.Eval(exp, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -175,30 +561,71 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-// evalIdentifier evaluates an identifier by looking it up in the environment
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+// evalChainedComparison evaluates a chain such as a < b < c from left to
+// right, evaluating each operand once. It stops at the first comparison that
+// does not hold without evaluating the remaining operands.
+func (e *Evaluator) evalChainedComparison(node *ast.ChainedComparison, env *object.Environment) object.Object {
+	left := e.Eval(node.Operands[0], env)
+	if isError(left) {
+		return left
+	}
+
+	for i, operator := range node.Operators {
+		right := e.Eval(node.Operands[i+1], env)
+		if isError(right) {
+			return right
+		}
+
+		result := e.evalInfixExpression(operator, left, right)
+		if isError(result) || !e.isTruthy(result) {
+			return result
+		}
+		left = right
+	}
+
+	return TRUE
+}
+
+// evalIdentifier evaluates an identifier by looking it up in the environment,
+// then among the builtins and finally the namespaces. Because the environment
+// comes first, a binding shadows a builtin of the same name only within its
+// own scope; outer scopes still see the builtin.
+func (e *Evaluator) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
-
+	if builtin, ok := e.builtin(node.Value); ok {
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	if namespace, ok := namespaces[node.Value]; ok {
+		return namespace
+	}
+
+	if node.Value == Throwaway {
+		// Hosts may still bind it themselves, as the REPL does.
+		err := newCodedError(object.NAME_ERROR, "cannot use %s as a value", Throwaway)
+		err.Data = errorData(map[string]string{"name": node.Value})
+		return err
+	}
+
+	err := newCodedError(object.NAME_ERROR, "identifier not found: %s", node.Value)
+	err.Data = errorData(map[string]string{"name": node.Value})
+
+	return err
 }
 
 // evalBlockStatement evaluates a block statement and returns the result
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.LOOP_CONTROL_OBJ {
 				return result
 			}
 		}
@@ -207,51 +634,99 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-// evalIfExpression evaluates an if-else expression and returns the result.
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+// evalBlockExpression evaluates a block expression in a scope of its own, so
+// its let bindings are not visible after it, and returns the value of its last
+// statement, or null if that statement has no value.
+func (e *Evaluator) evalBlockExpression(be *ast.BlockExpression, env *object.Environment) object.Object {
+	result := e.evalBlockStatement(be.Block, object.NewEnclosedEnvironment(env))
+	if result == nil {
+		return NULL
+	}
+
+	return result
+}
+
+// evalIfExpression evaluates an if-else expression and returns the value of
+// the last statement of the branch taken. It returns null when no branch is
+// taken or the last statement, such as a let, has no value.
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
-	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+	var result object.Object
+	if e.isTruthy(condition) {
+		result = e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
-	} else {
+		result = e.Eval(ie.Alternative, env)
+	}
+
+	if result == nil {
 		return NULL
 	}
+	return result
 }
 
-// isTruthy determines if an object is true
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
+// isTruthy reports whether obj counts as true in a condition. Only false
+// and null are falsy unless the Evaluator uses LooseTruthiness, which also
+// makes zero, the empty string and empty collections falsy.
+func (e *Evaluator) isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Null:
 		return false
-	case TRUE:
+	case *object.Boolean:
+		return obj.Value
+	}
+
+	if !e.loose {
 		return true
-	case FALSE:
-		return false
+	}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value != 0
+	case *object.Float:
+		return obj.Value != 0
+	case *object.String:
+		return obj.Value != ""
+	case *object.Array:
+		return len(obj.Elements) > 0
+	case *object.Hash:
+		return len(obj.Pairs) > 0
+	case *object.Set:
+		return len(obj.Elements) > 0
 	default:
 		return true
 	}
 }
 
 // evalIntegerInfixExpression evaluates infix expressions between two integer objects.
-// Supported operators: +, -, *, /, <, >, ==, !=.
+// Supported operators: +, -, *, /, //, <, >, ==, !=. Division with / truncates
+// toward zero, so -7 / 2 is -3, while // rounds down, so -7 // 2 is -4.
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	if (operator == "/" || operator == "//") && rightVal == 0 {
+		return newCodedError(object.RANGE_ERROR, "division by zero")
+	}
+
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return newInteger(leftVal + rightVal)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return newInteger(leftVal - rightVal)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return newInteger(leftVal * rightVal)
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		return newInteger(leftVal / rightVal)
+	case "//":
+		quotient := leftVal / rightVal
+		if leftVal%rightVal != 0 && (leftVal < 0) != (rightVal < 0) {
+			quotient--
+		}
+		return newInteger(quotient)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -261,61 +736,138 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return operatorError("unknown operator", left, operator, right)
+	}
+}
+
+// evalFloatInfixExpression evaluates infix expressions between two numbers
+// where at least one is a float. Integer operands are promoted to floats.
+// Supported operators: +, -, *, /, //, <, >, ==, !=. Floor division with //
+// yields a float whose value is a whole number.
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "//":
+		return &object.Float{Value: math.Floor(leftVal / rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return operatorError("unknown operator", left, operator, right)
+	}
+}
+
+// isNumber checks whether the given object is an integer or a float.
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat converts an integer or float object to a native Go float64.
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
 	}
 }
 
 // evalInfixExpression evaluates infix operations (+, -, *, etc.) on objects.
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func (e *Evaluator) evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
+	case operator == "in":
+		return evalInExpression(left, right)
+	case e.coerce && operator == "+" && (left.Type() == object.STRING_OBJ || right.Type() == object.STRING_OBJ):
+		return &object.String{Value: left.Inspect() + right.Inspect()}
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
 		return nativeBoolToBooleanObject(left != right)
+	case operator == "*" && left.Type() == object.STRING_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalStringRepetition(left.(*object.String), right.(*object.Integer))
+	case operator == "*" && left.Type() == object.INTEGER_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringRepetition(right.(*object.String), left.(*object.Integer))
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return operatorError("type mismatch", left, operator, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
+		return evalArrayInfixExpression(operator, left, right)
+	case left.Type() == object.HASH_OBJ && right.Type() == object.HASH_OBJ:
+		return evalHashInfixExpression(operator, left, right)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return operatorError("unknown operator", left, operator, right)
 	}
 }
 
 // evalPrefixExpression evaluates prefix operations (!, -) on an object
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func (e *Evaluator) evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
-		return evalBangOperatorExpression(right)
+		return nativeBoolToBooleanObject(!e.isTruthy(right))
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newCodedError(object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
-// evalMinusPrefixOperatorExpression negates an integer value.
+// evalMinusPrefixOperatorExpression negates an integer or float value.
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *object.Integer:
+		return newInteger(-right.Value)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newCodedError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
-// evalBangOperatorExpression inverts a boolean value.
-func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE
+// The range of integers that newInteger returns cached objects for.
+const (
+	minCachedInteger = -128
+	maxCachedInteger = 255
+)
+
+// smallIntegers holds the cached integer objects, from minCachedInteger up.
+var smallIntegers = func() []*object.Integer {
+	cache := make([]*object.Integer, maxCachedInteger-minCachedInteger+1)
+	for i := range cache {
+		cache[i] = &object.Integer{Value: int64(i + minCachedInteger)}
 	}
+	return cache
+}()
+
+// newInteger returns an integer object for value. Small integers are
+// shared rather than allocated anew each time, which is safe because
+// integer objects are never changed once created.
+func newInteger(value int64) *object.Integer {
+	if value >= minCachedInteger && value <= maxCachedInteger {
+		return smallIntegers[value-minCachedInteger]
+	}
+	return &object.Integer{Value: value}
 }
 
 // nativeBoolToBooleanObject converts a native Go boolean to an object.Boolean
@@ -327,28 +879,107 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 }
 
 // evalProgram evaluates a sequence of statements and returns the final result.
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+// Top-level functions are hoisted first, so they can call each other
+// regardless of the order in which they are defined.
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
+	defer e.reportTests()
+	hoistFunctions(program.Statements, env)
+
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.LoopControl:
+			return newError("%s outside loop", result.Inspect())
 		}
 	}
 
 	return result
 }
 
+// hoistFunctions binds every function declared by the given statements,
+// either with a function statement or a let statement whose value is a
+// function literal, before any of the statements run. The statements still
+// run in order afterwards, so later bindings of the same name take effect
+// as usual. Block statements do not hoist and keep sequential semantics.
+// Read-only names are not hoisted over; their statements report the error
+// when they run.
+func hoistFunctions(statements []ast.Statement, env *object.Environment) {
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.FunctionStatement:
+			if env.IsReadOnly(statement.Name.Value) {
+				continue
+			}
+			env.Set(statement.Name.Value, newRecursiveFunction(statement.Name.Value, statement.Function, env))
+		case *ast.LetStatement:
+			if env.IsReadOnly(statement.Name.Value) {
+				continue
+			}
+			if lit, ok := statement.Value.(*ast.FunctionLiteral); ok {
+				bind(env, statement.Name.Value, newRecursiveFunction(statement.Name.Value, lit, env))
+			}
+		}
+	}
+}
+
+// checkWritable returns an error if any of names is bound read-only in env,
+// and nil if they may all be bound.
+func checkWritable(env *object.Environment, names ...*ast.Identifier) *object.Error {
+	for _, name := range names {
+		if env.IsReadOnly(name.Value) {
+			err := newCodedError(object.NAME_ERROR, "cannot assign to read-only binding: %s", name.Value)
+			err.Data = errorData(map[string]string{"name": name.Value})
+			return err
+		}
+	}
+	return nil
+}
+
 // newError create a new error object with the given formatted message.
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// newCodedError creates a new error object with the given code and formatted
+// message.
+func newCodedError(code, format string, a ...interface{}) *object.Error {
+	err := newError(format, a...)
+	err.Code = code
+
+	return err
+}
+
+// operatorError creates a TYPE_ERROR for an infix operator that does not
+// apply to its operands, with the operator and operand types as its data.
+func operatorError(reason string, left object.Object, operator string, right object.Object) *object.Error {
+	err := newCodedError(object.TYPE_ERROR, "%s: %s %s %s", reason, left.Type(), operator, right.Type())
+	err.Data = errorData(map[string]string{
+		"operator": operator,
+		"left":     string(left.Type()),
+		"right":    string(right.Type()),
+	})
+
+	return err
+}
+
+// errorData converts the details of an error to a hash of strings.
+func errorData(fields map[string]string) *object.Hash {
+	pairs := make(map[object.HashKey]object.HashPair, len(fields))
+	for name, value := range fields {
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: &object.String{Value: value}}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
 // isError check whether the given object is an error object.
 func isError(obj object.Object) bool {
 	if obj != nil {
@@ -357,11 +988,98 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// evalInExpression reports whether left is a member of right: an element
+// of an array or set, a key of a hash, or a substring of a string. Values
+// are compared as hash keys, so integers, floats, strings and booleans
+// match by value and other objects only match themselves. As with ==, an
+// integer matches the equal float, so 1.0 in [1] is true.
+func evalInExpression(left, right object.Object) object.Object {
+	keys := memberKeys(left)
+
+	switch right := right.(type) {
+	case *object.Array:
+		for _, el := range right.Elements {
+			if el == left {
+				return TRUE
+			}
+			if key, ok := el.(object.Hashable); ok && containsKey(keys, key.HashKey()) {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *object.Hash:
+		for _, key := range keys {
+			if _, ok := right.Pairs[key]; ok {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *object.Set:
+		for _, key := range keys {
+			if _, ok := right.Elements[key]; ok {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *object.String:
+		sub, ok := left.(*object.String)
+		if !ok {
+			return operatorError("type mismatch", left, "in", right)
+		}
+		return nativeBoolToBooleanObject(strings.Contains(right.Value, sub.Value))
+	default:
+		return operatorError("unknown operator", left, "in", right)
+	}
+}
+
+// memberKeys returns the hash keys a value is looked up by in `in`: its
+// own, if it is hashable, and for a number that of the equal number of the
+// other numeric type, if there is one.
+func memberKeys(obj object.Object) []object.HashKey {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return []object.HashKey{obj.HashKey(), (&object.Float{Value: float64(obj.Value)}).HashKey()}
+	case *object.Float:
+		keys := []object.HashKey{obj.HashKey()}
+		if obj.Value == math.Trunc(obj.Value) && math.Abs(obj.Value) < math.MaxInt64 {
+			keys = append(keys, (&object.Integer{Value: int64(obj.Value)}).HashKey())
+		}
+		return keys
+	case object.Hashable:
+		return []object.HashKey{obj.HashKey()}
+	default:
+		return nil
+	}
+}
+
+// containsKey reports whether key is one of keys.
+func containsKey(keys []object.HashKey, key object.HashKey) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// evalStringRepetition evaluates the product of a string and an integer,
+// in either order, as the string repeated count times.
+func evalStringRepetition(str *object.String, count *object.Integer) object.Object {
+	switch {
+	case count.Value < 0:
+		return newCodedError(object.RANGE_ERROR, "negative repeat count: %d", count.Value)
+	case len(str.Value) > 0 && count.Value > math.MaxInt32/int64(len(str.Value)):
+		return newCodedError(object.RANGE_ERROR, "repeated string too long: %d * %d bytes", count.Value, len(str.Value))
+	}
+
+	return &object.String{Value: strings.Repeat(str.Value, int(count.Value))}
+}
+
 // evalStringInfixExpression evaluates infix expressions between two string objects.
 // Supports concatenation using the "+" operator
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return operatorError("unknown operator", left, operator, right)
 	}
 
 	leftVal := left.(*object.String).Value
@@ -369,6 +1087,45 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	return &object.String{Value: leftVal + rightVal}
 }
 
+// evalArrayInfixExpression evaluates infix expressions between two array objects.
+// Supports concatenation into a new array using the "+" operator.
+func evalArrayInfixExpression(operator string, left, right object.Object) object.Object {
+	if operator != "+" {
+		return operatorError("unknown operator", left, operator, right)
+	}
+
+	leftElements := left.(*object.Array).Elements
+	rightElements := right.(*object.Array).Elements
+
+	elements := make([]object.Object, 0, len(leftElements)+len(rightElements))
+	elements = append(elements, leftElements...)
+	elements = append(elements, rightElements...)
+
+	return &object.Array{Elements: elements}
+}
+
+// evalHashInfixExpression evaluates infix expressions between two hash objects.
+// Supports merging into a new hash using the "+" operator, where pairs from
+// the right hash replace pairs with the same key from the left one.
+func evalHashInfixExpression(operator string, left, right object.Object) object.Object {
+	if operator != "+" {
+		return operatorError("unknown operator", left, operator, right)
+	}
+
+	leftPairs := left.(*object.Hash).Pairs
+	rightPairs := right.(*object.Hash).Pairs
+
+	pairs := make(map[object.HashKey]object.HashPair, len(leftPairs)+len(rightPairs))
+	for key, pair := range leftPairs {
+		pairs[key] = pair
+	}
+	for key, pair := range rightPairs {
+		pairs[key] = pair
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
 // evalIndexExpression evaluates index operations for arrays and hashes.
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
@@ -377,7 +1134,7 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newCodedError(object.TYPE_ERROR, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -394,22 +1151,49 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+// checkArrayIndex returns a RANGE_ERROR if left is an array and index is an
+// integer outside its bounds, with both as the error's data.
+func checkArrayIndex(left, index object.Object) *object.Error {
+	arr, ok := left.(*object.Array)
+	if !ok {
+		return nil
+	}
+	idx, ok := index.(*object.Integer)
+	if !ok || idx.Value >= 0 && idx.Value < int64(len(arr.Elements)) {
+		return nil
+	}
+
+	err := newCodedError(object.RANGE_ERROR, "index out of range: %d, length %d", idx.Value, len(arr.Elements))
+	err.Data = errorData(map[string]string{"index": idx.Inspect(), "length": fmt.Sprint(len(arr.Elements))})
+	return err
+}
+
+// evalMemberExpression retrieves a value from a hash by a property name,
+// so that hash.name is equivalent to hash["name"].
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	if obj.Type() != object.HASH_OBJ {
+		return newCodedError(object.TYPE_ERROR, "member access not supported: %s", obj.Type())
+	}
+
+	return evalHashIndexExpression(obj, &object.String{Value: name})
+}
+
 // evalHashLiteral evaluates a hash literal, converting key-value pairs into a hash object.
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+		key := e.Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newCodedError(object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := e.Eval(valueNode, env)
 		if isError(value) {
 			return value
 		}
@@ -421,13 +1205,28 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	return &object.Hash{Pairs: pairs}
 }
 
+// newSet creates a set holding the given elements, which must all be hashable.
+func newSet(elements []object.Object) object.Object {
+	set := &object.Set{Elements: make(map[object.HashKey]object.Object, len(elements))}
+
+	for _, el := range elements {
+		key, ok := el.(object.Hashable)
+		if !ok {
+			return newCodedError(object.TYPE_ERROR, "unusable as set element: %s", el.Type())
+		}
+		set.Elements[key.HashKey()] = el
+	}
+
+	return set
+}
+
 // evalHashIndexExpression retrieves a value from a hash by its key.
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newCodedError(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
 	}
 
 	pair, ok := hashObject.Pairs[key.HashKey()]
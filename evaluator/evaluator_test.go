@@ -1,10 +1,21 @@
 package evaluator
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"leopard/ast"
 	"leopard/lexer"
 	"leopard/object"
 	"leopard/parser"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -27,6 +38,13 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 / 2", 3},
+		{"-7 / 2", -3},
+		{"7 // 2", 3},
+		{"-7 // 2", -4},
+		{"7 // -2", -4},
+		{"-8 // 2", -4},
+		{"1 + 9 // 2 * 2", 9},
 	}
 
 	for _, tt := range tests {
@@ -35,6 +53,29 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7.0 / 2", 3.5},
+		{"7.0 // 2", 3.0},
+		{"-7 // 2.0", -4.0},
+		{"1.0 // 0.5", 2.0},
+		{"10 - 2.5 * 2", 5.0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -58,6 +99,20 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if math.Abs(result.Value-expected) > 1e-9 {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -82,11 +137,30 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1.5 < 2", true},
+		{"2.0 == 2", true},
+		{"2.5 > 3.5", false},
+		{"!1", false},
+		{"2 in [1, 2]", true},
+		{`starts_with("leopard", "leo")`, true},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
+
+		// Booleans are never allocated, so results are the singletons.
+		if evaluated != TRUE && evaluated != FALSE {
+			t.Errorf("%q did not evaluate to TRUE or FALSE. got=%p", tt.input, evaluated)
+		}
+	}
+}
+
+func BenchmarkBooleans(b *testing.B) {
+	program := parser.New(lexer.New("true == !false != (1 < 2) == (true != (2 > 1)) == !!true")).ParseProgram()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
 	}
 }
 
@@ -134,6 +208,9 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { }", nil},
+		{"if (true) { let a = 1; }", nil},
+		{"if (false) { 10 } else { let a = 1; }", nil},
 	}
 
 	for _, tt := range tests {
@@ -353,6 +430,68 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringRepetition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"ab" * 3`, "ababab"},
+		{`3 * "ab"`, "ababab"},
+		{`"ab" * 1`, "ab"},
+		{`"ab" * 0`, ""},
+		{`0 * "ab"`, ""},
+		{`"" * 5`, ""},
+		{`"-" * 2 + "|"`, "--|"},
+		{`"ab" * -1`, errorMessage("negative repeat count: -1")},
+		{`-2 * "ab"`, errorMessage("negative repeat count: -2")},
+		{`"ab" * 9223372036854775807`, errorMessage("repeated string too long: 9223372036854775807 * 2 bytes")},
+		{`"ab" * 1.5`, errorMessage("type mismatch: STRING * FLOAT")},
+		{`"ab" / 2`, errorMessage("type mismatch: STRING / INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestInOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"2 in [1, 2, 3]", true},
+		{"4 in [1, 2, 3]", false},
+		{`"b" in ["a", "b"]`, true},
+		{"true in [false]", false},
+		{"1 in []", false},
+		{"let f = fn() {}; f in [f]", true},
+		{"[1] in [[1]]", false},
+		{`"a" in {"a": 1}`, true},
+		{`"b" in {"a": 1}`, false},
+		{`1 in {"1": 1}`, false},
+		{`[] in {"a": 1}`, false},
+		{"2 in {1, 2}", true},
+		{"3 in {1, 2}", false},
+		{"1.0 in [1]", true},
+		{"1 in [1.0]", true},
+		{"1.5 in [1]", false},
+		{"2.0 in {1, 2}", true},
+		{"2 in {1.0, 2.0}", true},
+		{"1.0 in {1: true}", true},
+		{`"ell" in "hello"`, true},
+		{`"" in "hello"`, true},
+		{`"x" in "hello"`, false},
+		{"1 + 1 in [2]", true},
+		{"2 in [2] == true", true},
+		{`1 in "hello"`, errorMessage("type mismatch: INTEGER in STRING")},
+		{"1 in 2", errorMessage("unknown operator: INTEGER in INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -545,3 +684,2651 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestMathNamespace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"math.sqrt(16)", 4.0},
+		{"math.sqrt(2.25)", 1.5},
+		{"math.sin(0)", 0.0},
+		{"math.cos(0)", 1.0},
+		{"math.sin(math.pi / 2)", 1.0},
+		{"math.floor(2.7)", 2.0},
+		{"math.floor(-2.5)", -3.0},
+		{"math.ceil(2.1)", 3.0},
+		{"math.round(2.5)", 3.0},
+		{"math.round(-2.4)", -2.0},
+		{`math["sqrt"](9)`, 3.0},
+		{"let sqrt = math.sqrt; sqrt(25)", 5.0},
+		{"math.sqrt(-1)", "argument to `sqrt` out of domain, got -1"},
+		{`math.floor("1")`, "argument to `floor` must be INTEGER or FLOAT, got STRING"},
+		{"math.sqrt(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"1.sqrt", "member access not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func testEvalWith(e *Evaluator, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return e.Eval(program, env)
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	e := New()
+	e.Register("double", func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		n, ok := args[0].(*object.Integer)
+		if !ok {
+			return newError("argument to `double` must be INTEGER, got %s", args[0].Type())
+		}
+		return &object.Integer{Value: n.Value * 2}
+	})
+	e.Register("len", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: -1}
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`double(21)`, 42},
+		{`map([1, 2, 3], double)`, "[2, 4, 6]"},
+		{`double("x")`, errorMessage("argument to `double` must be INTEGER, got STRING")},
+		{`len("abc")`, -1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWith(e, tt.input)
+		if s, ok := tt.expected.(string); ok {
+			if evaluated.Inspect() != s {
+				t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, s, evaluated.Inspect())
+			}
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+
+	if testEval(`double(1)`).Type() != object.ERROR_OBJ {
+		t.Errorf("builtin registered on one Evaluator leaked into the default one")
+	}
+}
+
+func TestGoValuesInEnvironment(t *testing.T) {
+	config, err := object.FromGo(map[string]interface{}{
+		"name":  "leopard",
+		"ports": []int{80, 443},
+		"debug": true,
+	})
+	if err != nil {
+		t.Fatalf("FromGo returned error: %s", err)
+	}
+
+	l := lexer.New(`if (config.debug) { config["name"] + ":" } else { "" }`)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	env.Set("config", config)
+
+	testObject(t, Eval(program, env), "leopard:")
+}
+
+func TestReadOnlyBindings(t *testing.T) {
+	config, err := object.FromGo(map[string]interface{}{"name": "leopard"})
+	if err != nil {
+		t.Fatalf("FromGo returned error: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`config["name"]`, "leopard"},
+		{`let config = 1;`, errorMessage("cannot assign to read-only binding: config")},
+		{`fn config() { 1 }`, errorMessage("cannot assign to read-only binding: config")},
+		{`let config = fn() { 1 }; config["name"]`, errorMessage("cannot assign to read-only binding: config")},
+		{`let [a, config] = [1, 2];`, errorMessage("cannot assign to read-only binding: config")},
+		{`let {config} = {"config": 1};`, errorMessage("cannot assign to read-only binding: config")},
+		{`unset("config")`, errorMessage("cannot unset read-only binding: config")},
+		{`let f = fn(config) { config }; f(1)`, 1},
+		{`let f = fn() { let config = 2; config }; f()`, 2},
+		{`let f = fn() { let config = 2; config }; f(); config["name"]`, "leopard"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetReadOnly("config", config)
+
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		testObject(t, Eval(program, env), tt.expected)
+
+		if val, _ := env.Get("config"); val != config {
+			t.Errorf("config was rebound by %q. got=%s", tt.input, val.Inspect())
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	l := lexer.New(`let inc = fn(x) { x + 1 };`)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	Eval(program, env)
+
+	inc, ok := env.Get("inc")
+	if !ok {
+		t.Fatalf("inc is not defined")
+	}
+
+	testIntegerObject(t, Apply(inc, &object.Integer{Value: 41}), 42)
+	testObject(t, Apply(inc, &object.String{Value: "a"}), errorMessage("type mismatch: STRING + INTEGER"))
+	testObject(t, Apply(inc), errorMessage("wrong number of arguments. got=0, want=1"))
+	testObject(t, Apply(&object.Integer{Value: 1}), errorMessage("not a function: INTEGER"))
+
+	testIntegerObject(t, Apply(builtins["len"], &object.String{Value: "abc"}), 3)
+}
+
+func TestProfiling(t *testing.T) {
+	// Recursion is the language's only loop, so the body of countdown runs
+	// once per call.
+	input := `fn countdown(n) { if (n == 0) { 0 } else { countdown(n - 1) } } countdown(%d)`
+
+	counts := []int{}
+	for _, n := range []int{10, 20} {
+		e := New(Profiling())
+		testEvalWith(e, fmt.Sprintf(input, n))
+
+		profile := e.Profile()
+		if profile.Counts["IfExpression"] != n+1 {
+			t.Errorf("IfExpression count wrong for n=%d. got=%d", n, profile.Counts["IfExpression"])
+		}
+		if profile.Counts["Program"] != 1 {
+			t.Errorf("Program count wrong. got=%d", profile.Counts["Program"])
+		}
+		var sum time.Duration
+		for _, d := range profile.Durations {
+			sum += d
+		}
+		if sum != profile.Total {
+			t.Errorf("durations add up to %s, want Total %s", sum, profile.Total)
+		}
+		if !strings.Contains(profile.String(), "IfExpression") {
+			t.Errorf("report does not list IfExpression:\n%s", profile)
+		}
+		counts = append(counts, profile.Counts["InfixExpression"])
+	}
+
+	// Each call evaluates n == 0 and all but the last evaluate n - 1.
+	if counts[0] != 2*10+1 || counts[1] != 2*20+1 {
+		t.Errorf("InfixExpression counts not proportional. got=%v", counts)
+	}
+
+	if New().Profile() != nil {
+		t.Errorf("profile recorded without the Profiling option")
+	}
+}
+
+func TestMemoize(t *testing.T) {
+	fib := `fn(n) { tick(); if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }`
+
+	tests := []struct {
+		input         string
+		expectedCalls int
+	}{
+		{`let fib = ` + fib + `; fib(15)`, 1973},
+		{`let fib = memoize(` + fib + `); fib(15)`, 16},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		e := New()
+		e.Register("tick", func(args ...object.Object) object.Object {
+			calls++
+			return NULL
+		})
+
+		testIntegerObject(t, testEvalWith(e, tt.input), 610)
+		if calls != tt.expectedCalls {
+			t.Errorf("wrong number of calls for %q. expected=%d, got=%d", tt.input, tt.expectedCalls, calls)
+		}
+	}
+
+	collections := `let f = memoize(fn(xs) { len(xs) }); [f([1]), f([1, 2]), f([1])]`
+	testIntegerArray(t, testEval(collections), []int64{1, 2, 1})
+
+	calls := 0
+	e := New()
+	e.Register("tick", func(args ...object.Object) object.Object {
+		calls++
+		return NULL
+	})
+	cached := `let f = memoize(fn(x) { tick(); x }); f([1, {"a": 2}]); f([1, {"a": 2}]); f(len); f(len)`
+	testEvalWith(e, cached)
+	if calls != 3 {
+		t.Errorf("wrong number of calls with collection and function arguments. expected=3, got=%d", calls)
+	}
+
+	// Arguments whose keys collide must not share a cached result.
+	cache := newMemoCache()
+	cache.put(42, []object.Object{newInteger(1)}, newInteger(10))
+	if _, ok := cache.get(42, []object.Object{newInteger(2)}); ok {
+		t.Errorf("memo cache returned a result for different arguments with the same key")
+	}
+	if result, ok := cache.get(42, []object.Object{newInteger(1)}); !ok || result != newInteger(10) {
+		t.Errorf("memo cache lost the result for the stored arguments. got=%v", result)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`memoize(1)`, "argument to `memoize` must be FUNCTION or BUILTIN, got INTEGER"},
+		{`memoize()`, "wrong number of arguments. got=0, want=1"},
+		{`memoize(fn(x) { -x })("a")`, "unknown operator: -STRING"},
+	}
+
+	for _, tt := range errorTests {
+		testObject(t, testEval(tt.input), errorMessage(tt.expected))
+	}
+}
+
+func TestTestBuiltins(t *testing.T) {
+	input := `
+fn add(a, b) { a + b }
+
+test("adds numbers", fn() {
+  assert_eq(add(1, 2), 3);
+  assert_ne(add(1, 2), 4);
+});
+
+test("adds strings", fn() {
+  assert_eq(add("a", "b"), "ab");
+  assert_eq(add({"a": 1}, {"b": 2}), {"b": 2, "a": 1});
+  assert_eq(add(2, 2), 5);
+  puts("not reached");
+});
+
+"done"
+`
+	var out bytes.Buffer
+	e := New(Output(&out))
+
+	testObject(t, testEvalWith(e, input), "done")
+
+	expected := "PASS adds numbers\n" +
+		"FAIL adds strings: assertion failed: 4 != 5\n" +
+		"1 passed, 1 failed\n"
+	if out.String() != expected {
+		t.Errorf("wrong summary.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+
+	out.Reset()
+	testObject(t, testEvalWith(e, `assert_eq([1, 2], [1, 2]); assert_ne(1, 1); 2`), errorMessage("assertion failed: 1 == 1"))
+	if out.Len() != 0 {
+		t.Errorf("summary written without tests: %q", out.String())
+	}
+
+	testObject(t, testEvalWith(e, `assert_eq(1, "1")`), errorMessage(`assertion failed: INTEGER 1 != STRING "1"`))
+	testObject(t, testEvalWith(e, `assert_eq(1, 1.0)`), errorMessage("assertion failed: 1 != 1.0"))
+	testObject(t, testEvalWith(e, `assert_eq({"a": [1, {2}]}, {"a": [1, {2}]}); assert_ne({1}, {2}); 3`), 3)
+	testObject(t, testEvalWith(e, `let f = fn(x) { x }; let g = fn(x) { x + 1 }; assert_eq(f, f); assert_ne(f, g); 4`), 4)
+	testObject(t, testEvalWith(e, `assert_eq(fn(x) { x }, fn(x) { x + 1 })`), errorMessage("assertion failed: fn(x) {\nx\n} != fn(x) {\n(x + 1)\n}"))
+	testObject(t, testEvalWith(e, `test(1, fn() {})`), errorMessage("first argument to `test` must be STRING, got INTEGER"))
+}
+
+func TestCoverage(t *testing.T) {
+	input := `let x = 5;
+if (x > 1) {
+  "big";
+} else {
+  "small";
+}
+fn unused() {
+  x
+}`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	e := New(TrackCoverage())
+	e.Eval(program, object.NewEnvironment())
+
+	ifExp := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	coverage := e.Coverage()
+
+	if !coverage.Executed(ifExp.Condition) {
+		t.Errorf("if condition not marked as executed")
+	}
+	if !coverage.Executed(ifExp.Consequence.Statements[0]) {
+		t.Errorf("taken branch not marked as executed")
+	}
+	ast.Inspect(ifExp.Alternative, func(node ast.Node) bool {
+		if coverage.Executed(node) {
+			t.Errorf("node in branch not taken marked as executed: %s", node.String())
+		}
+		return true
+	})
+
+	expected := []int{5, 8}
+	lines := coverage.UncoveredLines(program)
+	if fmt.Sprint(lines) != fmt.Sprint(expected) {
+		t.Errorf("wrong uncovered lines. expected=%v, got=%v", expected, lines)
+	}
+
+	if New().Coverage() != nil {
+		t.Errorf("coverage recorded without the TrackCoverage option")
+	}
+}
+
+// recordingTracer records the kind of every node it is notified about.
+type recordingTracer struct {
+	visited []string
+}
+
+func (r *recordingTracer) BeforeEval(node ast.Node, env *object.Environment) {
+	r.visited = append(r.visited, strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+}
+
+// breakpointTracer pauses evaluation at the first statement on a line until
+// resumed, sending the environment at that point to paused.
+type breakpointTracer struct {
+	line    int
+	paused  chan *object.Environment
+	resume  chan struct{}
+	stopped bool
+}
+
+func (b *breakpointTracer) BeforeEval(node ast.Node, env *object.Environment) {
+	stmt, ok := node.(*ast.ExpressionStatement)
+	if !ok || stmt.Token.Line != b.line || b.stopped {
+		return
+	}
+	b.stopped = true
+	b.paused <- env
+	<-b.resume
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	testEvalWith(New(Trace(tracer)), `let x = 1 + 2; -x`)
+
+	expected := "Program LetStatement InfixExpression IntegerLiteral IntegerLiteral " +
+		"ExpressionStatement PrefixExpression Identifier"
+	if strings.Join(tracer.visited, " ") != expected {
+		t.Errorf("wrong nodes visited.\nexpected=%s\ngot=%s", expected, strings.Join(tracer.visited, " "))
+	}
+}
+
+func TestTracerBreakpoint(t *testing.T) {
+	tracer := &breakpointTracer{
+		line:   2,
+		paused: make(chan *object.Environment),
+		resume: make(chan struct{}),
+	}
+	e := New(Trace(tracer))
+
+	done := make(chan object.Object)
+	go func() {
+		done <- testEvalWith(e, "let x = 1 + 2;\nx * 2")
+	}()
+
+	env := <-tracer.paused
+	select {
+	case <-done:
+		t.Fatalf("evaluation finished while paused at breakpoint")
+	default:
+	}
+	x, _ := env.Get("x")
+	testIntegerObject(t, x, 3)
+
+	close(tracer.resume)
+	testIntegerObject(t, <-done, 6)
+}
+
+func TestEvalWatch(t *testing.T) {
+	l := lexer.New(`let xs = [1, 2]; let n = 10; fn total(k) { n + k }; let sb = string_builder(); append(sb, "a")`)
+	p := parser.New(l)
+	env := object.NewEnvironment()
+	Eval(p.ParseProgram(), env)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`total(len(push(xs, 3)))`, 13},
+		{`if (true) { let n = 99; let extra = 1; n + extra }`, 100},
+		{`if (true) { return n * 2; }`, 20},
+		{`to_string(append(sb, "x"))`, "ax"},
+	}
+
+	for _, tt := range tests {
+		result, err := EvalWatch(tt.input, env)
+		if err != nil {
+			t.Fatalf("EvalWatch(%q) returned error: %s", tt.input, err)
+		}
+		testObject(t, result, tt.expected)
+	}
+
+	n, _ := env.Get("n")
+	testIntegerObject(t, n, 10)
+	if _, ok := env.Get("extra"); ok {
+		t.Errorf("binding made by watch expression leaked into the environment")
+	}
+	xs, _ := env.Get("xs")
+	if xs.Inspect() != "[1, 2]" {
+		t.Errorf("xs changed by watch expression. got=%s", xs.Inspect())
+	}
+	sb, _ := env.Get("sb")
+	if got := sb.(*object.StringBuilder).Builder.String(); got != "a" {
+		t.Errorf("sb changed by watch expression. got=%q", got)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`n +`, "parse error: no prefix parse function for EOF found"},
+		{`let y = 1`, "watch must be an expression, got let statement"},
+		{`n; xs`, "watch must be a single expression, got 2 statements"},
+		{`missing`, "identifier not found: missing"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := EvalWatch(tt.input, env)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRandomBuiltins(t *testing.T) {
+	input := `seed(42); [rand(), rand(), rand_int(100), rand_int(100)]`
+
+	first := testEvalWith(New(), input)
+	second := testEvalWith(New(), input)
+
+	arr, ok := first.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", first, first)
+	}
+
+	if first.Inspect() != second.Inspect() {
+		t.Errorf("seeded sequences differ. first=%s, second=%s", first.Inspect(), second.Inspect())
+	}
+
+	for _, el := range arr.Elements[:2] {
+		f, ok := el.(*object.Float)
+		if !ok || f.Value < 0 || f.Value >= 1 {
+			t.Errorf("rand() out of range. got=%s", el.Inspect())
+		}
+	}
+
+	for _, el := range arr.Elements[2:] {
+		i, ok := el.(*object.Integer)
+		if !ok || i.Value < 0 || i.Value >= 100 {
+			t.Errorf("rand_int(100) out of range. got=%s", el.Inspect())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"rand(1)", "wrong number of arguments. got=1, want=0"},
+		{"rand_int(0)", "argument to `rand_int` must be positive, got 0"},
+		{`seed("a")`, "argument to `seed` must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range errors {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestTimeBuiltins(t *testing.T) {
+	evaluated := testEval("now()")
+	result, ok := evaluated.(*object.Integer)
+	if !ok {
+		t.Fatalf("object is not Integer. got=%T (%+v)", evaluated, evaluated)
+	}
+	// 2020-01-01T00:00:00Z in milliseconds.
+	if result.Value < 1577836800000 {
+		t.Errorf("now() returned an implausible timestamp. got=%d", result.Value)
+	}
+
+	var slept []time.Duration
+	e := New()
+	e.now = func() time.Time { return time.UnixMilli(1700000000000) }
+	e.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	testIntegerObject(t, testEvalWith(e, "now()"), 1700000000000)
+	testNullObject(t, testEvalWith(e, "sleep(0); sleep(25)"))
+
+	if len(slept) != 2 || slept[0] != 0 || slept[1] != 25*time.Millisecond {
+		t.Errorf("sleep called with wrong durations. got=%v", slept)
+	}
+
+	start := time.Now()
+	testNullObject(t, testEval("sleep(0)"))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("sleep(0) did not return promptly. took=%s", elapsed)
+	}
+
+	evaluated = testEval("sleep(-1)")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "argument to `sleep` must not be negative, got -1" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestEnvBuiltin(t *testing.T) {
+	t.Setenv("LEOPARD_TEST_VAR", "spotted")
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`env("LEOPARD_TEST_VAR")`, "spotted"},
+		{`env("LEOPARD_TEST_VAR", "plain")`, "spotted"},
+		{`env("LEOPARD_UNSET_VAR")`, nil},
+		{`env("LEOPARD_UNSET_VAR", "plain")`, "plain"},
+		{`env("LEOPARD_UNSET_VAR", 5)`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			}
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	evaluated := testEvalWith(New(Sandboxed()), `env("LEOPARD_TEST_VAR")`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "operation not permitted in sandbox: `env`" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestFileBuiltins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+
+	input := fmt.Sprintf(`write_file("%s", "spots"); read_file("%s")`, path, path)
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "spots" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+
+	evaluated = testEval(fmt.Sprintf(`read_file("%s")`, filepath.Join(t.TempDir(), "missing.txt")))
+	if _, ok := evaluated.(*object.Error); !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestFileHandles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.txt")
+	if err := os.WriteFile(path, []byte("first\nsecond\r\n\nlast"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := fmt.Sprintf(`
+let readAll = fn(f, lines) {
+  let line = read_line(f);
+  if (line) { readAll(f, push(lines, line)) } else { lines }
+};
+let lines = fn(path) {
+  let f = open(path, "r");
+  defer close(f);
+  readAll(f, [])
+};
+lines("%s")`, path)
+
+	evaluated := testEval(input)
+	if evaluated.Inspect() != "[first, second, , last]" {
+		t.Errorf("wrong lines. got=%s", evaluated.Inspect())
+	}
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	input = fmt.Sprintf(`let f = open("%s", "w"); write(f, "a"); close(f);
+let f = open("%s", "a"); write(f, "b"); close(f);
+read_file("%s")`, out, out, out)
+	testObject(t, testEval(input), "ab")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = open("%s", "r"); close(f); close(f)`, "file %s is already closed"},
+		{`let f = open("%s", "r"); close(f); read_line(f)`, "file %s is closed"},
+		{`let f = open("%s", "a"); close(f); write(f, "x")`, "file %s is closed"},
+		{`let f = open("%s", "r"); write(f, "x")`, "file %s is not open for writing"},
+		{`let f = open("%s", "a"); read_line(f)`, "file %s is not open for reading"},
+		{`open("%s", "rw")`, "argument 2 to `open` must be \"r\", \"w\" or \"a\", got \"rw\""},
+		{`read_line("%s")`, "argument 1 to `read_line` must be FILE, got STRING"},
+	}
+
+	for _, tt := range tests {
+		expected := tt.expected
+		if strings.Contains(expected, "%s") {
+			expected = fmt.Sprintf(expected, path)
+		}
+		testObject(t, testEval(fmt.Sprintf(tt.input, path)), errorMessage(expected))
+	}
+}
+
+func TestSandboxedEvaluator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(path, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := New(Sandboxed())
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{fmt.Sprintf(`read_file("%s")`, path), "operation not permitted in sandbox: `read_file`"},
+		{fmt.Sprintf(`write_file("%s", "x")`, path), "operation not permitted in sandbox: `write_file`"},
+		{`env("HOME")`, "operation not permitted in sandbox: `env`"},
+		{fmt.Sprintf(`open("%s", "r")`, path), "operation not permitted in sandbox: `open`"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWith(e, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "secret" {
+		t.Errorf("sandboxed write_file modified the file. got=%q (%v)", content, err)
+	}
+
+	testIntegerObject(t, testEvalWith(e, "len([1, 2])"), 2)
+}
+
+func TestArrayAccessBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"first([1, 2, 3])", 1},
+		{"first([7])", 7},
+		{"first([])", nil},
+		{"last([1, 2, 3])", 3},
+		{"last([7])", 7},
+		{"last([])", nil},
+		{"rest([1, 2, 3])", []int64{2, 3}},
+		{"rest([7])", []int64{}},
+		{"rest([])", nil},
+		{"init([1, 2, 3])", []int64{1, 2}},
+		{"init([7])", []int64{}},
+		{"init([])", nil},
+		{"init(1)", "argument to `init` must be ARRAY, got INTEGER"},
+		{"last(1)", "argument to `last` must be ARRAY, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func testIntegerArray(t *testing.T, obj object.Object, expected []int64) bool {
+	arr, ok := obj.(*object.Array)
+	if !ok {
+		t.Errorf("object is not Array. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if len(arr.Elements) != len(expected) {
+		t.Errorf("array has wrong num of elements. got=%d, want=%d", len(arr.Elements), len(expected))
+		return false
+	}
+
+	for i, el := range expected {
+		if !testIntegerObject(t, arr.Elements[i], el) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestStringCaseBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`lower("Hello World")`, "hello world"},
+		{`upper("Hello World")`, "HELLO WORLD"},
+		{`upper("ñandú")`, "ÑANDÚ"},
+		{`lower("ÉCOLE")`, "école"},
+		{`capitalize("éCOLE")`, "École"},
+		{`capitalize("hELLO")`, "Hello"},
+		{`capitalize("")`, ""},
+		{`upper(1)`, errorMessage("argument to `upper` must be STRING, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+// errorMessage marks an expected value in a table test as an error message.
+type errorMessage string
+
+// testObject checks obj against an expected Go value: int64 or int for
+// integers, string for strings, bool for booleans, errorMessage for errors
+// and nil for null.
+func testObject(t *testing.T, obj object.Object, expected interface{}) bool {
+	switch expected := expected.(type) {
+	case int:
+		return testIntegerObject(t, obj, int64(expected))
+	case int64:
+		return testIntegerObject(t, obj, expected)
+	case bool:
+		return testBooleanObject(t, obj, expected)
+	case string:
+		str, ok := obj.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+			return false
+		}
+		if str.Value != expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+			return false
+		}
+		return true
+	case errorMessage:
+		errObj, ok := obj.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+			return false
+		}
+		if errObj.Message != string(expected) {
+			t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			return false
+		}
+		return true
+	default:
+		return testNullObject(t, obj)
+	}
+}
+
+func TestStringSearchBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`replace("aaaa", "aa", "b")`, "bb"},
+		{`replace("aaa", "aa", "b")`, "ba"},
+		{`replace("abab", "aba", "x")`, "xb"},
+		{`replace("leopard", "cat", "dog")`, "leopard"},
+		{`starts_with("leopard", "leo")`, true},
+		{`starts_with("leopard", "pard")`, false},
+		{`ends_with("leopard", "pard")`, true},
+		{`ends_with("leopard", "leo")`, false},
+		{`contains("leopard", "opa")`, true},
+		{`contains("leopard", "cat")`, false},
+		{`index_of("leopard", "pard")`, 3},
+		{`index_of("leopard", "cat")`, -1},
+		{`index_of("héllo", "l")`, 3},
+		{`index_of("", "")`, 0},
+		{`replace("a", 1, "b")`, errorMessage("argument 2 to `replace` must be STRING, got INTEGER")},
+		{`contains("a")`, errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestChunkBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"chunk([1, 2, 3, 4], 2)", "[[1, 2], [3, 4]]"},
+		{"chunk([1, 2, 3, 4, 5], 2)", "[[1, 2], [3, 4], [5]]"},
+		{"chunk([1, 2], 5)", "[[1, 2]]"},
+		{"chunk([], 3)", "[]"},
+		{"chunk([1], 0)", errorMessage("chunk size must be positive, got 0")},
+		{"chunk([1], -2)", errorMessage("chunk size must be positive, got -2")},
+		{"chunk(1, 2)", errorMessage("first argument to `chunk` must be ARRAY, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if _, ok := evaluated.(*object.Array); !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong chunks. expected=%s, got=%s", expected, evaluated.Inspect())
+			}
+		default:
+			testObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestSetLiterals(t *testing.T) {
+	evaluated := testEval("{1, 2, 2, 3, 1}")
+	set, ok := evaluated.(*object.Set)
+	if !ok {
+		t.Fatalf("object is not Set. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(set.Elements) != 3 {
+		t.Fatalf("set has wrong num of elements. got=%d", len(set.Elements))
+	}
+
+	for _, i := range []int64{1, 2, 3} {
+		if _, ok := set.Elements[(&object.Integer{Value: i}).HashKey()]; !ok {
+			t.Errorf("set does not contain %d", i)
+		}
+	}
+
+	testObject(t, testEval("{[1]}"), errorMessage("unusable as set element: ARRAY"))
+}
+
+func TestSetBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"union({1, 2}, {2, 3})", "{1, 2, 3}"},
+		{"union({1}, remove({1}, 1))", "{1}"},
+		{"intersect({1, 2, 3}, {2, 3, 4})", "{2, 3}"},
+		{"intersect({1, 2}, {3, 4})", "{}"},
+		{`add({"a"}, "b")`, "{a, b}"},
+		{"add({1}, 1)", "{1}"},
+		{"remove({1, 2}, 2)", "{1}"},
+		{"remove({1, 2}, 5)", "{1, 2}"},
+		{"let s = {1, 2}; add(s, 3); s", "{1, 2}"},
+		{"contains({1, 2}, 2)", true},
+		{"contains({1, 2}, 5)", false},
+		{"contains({1, 2}, [1])", false},
+		{"len({1, 2, 2})", 2},
+		{"add({1}, fn(x) { x })", errorMessage("unusable as set element: FUNCTION")},
+		{"union({1}, [1])", errorMessage("argument 2 to `union` must be SET, got ARRAY")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case string:
+			if _, ok := evaluated.(*object.Set); !ok {
+				t.Errorf("object is not Set. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong set. expected=%s, got=%s", expected, evaluated.Inspect())
+			}
+		default:
+			testObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestClosureCaptureSemantics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// Closures capture their environment by reference, so a later
+		// binding of the same name in that environment is visible.
+		{"let x = 1; let getX = fn() { x }; let x = 2; getX()", 2},
+		// Bindings made after the closure was created are visible too.
+		{"let getY = fn() { y }; let y = 3; getY()", 3},
+		// freeze captures the environment by value instead.
+		{"let x = 1; let getX = freeze(fn() { x }); let x = 2; getX()", 1},
+		{"let make = fn(n) { freeze(fn() { n }) }; make(4)()", 4},
+		{"let getY = freeze(fn() { y }); let y = 3; getY()", errorMessage("identifier not found: y")},
+		{"freeze(len)", errorMessage("argument to `freeze` must be FUNCTION, got BUILTIN")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn double(x) { x * 2 }; double(4)", 8},
+		{"fn fact(n) { if (n == 0) { return 1; } n * fact(n - 1) }; fact(5)", 120},
+		{"fn outer() { fn inner() { 7 }; inner() }; outer()", 7},
+		{"fn outer() { fn inner() { 7 }; inner() }; outer(); inner()", errorMessage("identifier not found: inner")},
+		{"fn one() { return 1; }; one() + 1", 2},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRecursiveLetBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10)", 55},
+		{"let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; let f = fact; let fact = 0; f(5)", 120},
+		{"fn fact(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; let f = fact; let fact = 0; f(5)", 120},
+		{"let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } }; let c = countdown; c(3)", 0},
+		// Mutual recursion works as long as both functions are bound before the first call.
+		{"let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } }; let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } }; isEven(4)", true},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestHoistedFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`
+		let result = isEven(10);
+		let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+		let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+		result`, true},
+		{`
+		let result = [isEven(7), isOdd(7)];
+		fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+		fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+		result`, "[false, true]"},
+		// Inner scopes keep sequential semantics.
+		{`
+		let outer = fn() {
+			let result = helper();
+			let helper = fn() { 1 };
+			result
+		};
+		outer()`, errorMessage("identifier not found: helper")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(string); ok {
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. expected=%s, got=%s", expected, evaluated.Inspect())
+			}
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestPartialBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let addThree = fn(a, b, c) { a * 100 + b * 10 + c }; let addToTwelve = partial(partial(addThree, 1), 2); addToTwelve(3)", 123},
+		{"let addThree = fn(a, b, c) { a * 100 + b * 10 + c }; partial(addThree, 1, 2)(3)", 123},
+		{"let addThree = fn(a, b, c) { a * 100 + b * 10 + c }; partial(addThree)(1, 2, 3)", 123},
+		{`partial(len, "four")()`, 4},
+		{"let addThree = fn(a, b, c) { a + b + c }; partial(addThree, 1)(2)", errorMessage("wrong number of arguments. got=2, want=3")},
+		{"partial(1, 2)", errorMessage("first argument to `partial` must be FUNCTION or BUILTIN, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestComposeAndPipeBuiltins(t *testing.T) {
+	prelude := "let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; "
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"compose(inc, double)(5)", 11},
+		{"pipe(inc, double)(5)", 12},
+		{"compose(inc, double, inc)(5)", 13},
+		{"pipe(inc, double, inc)(5)", 13},
+		{"compose(inc)(1)", 2},
+		{`compose(inc, len)("four")`, 5},
+		{`pipe(len, double)("four")`, 8},
+		{"let add = fn(a, b) { a + b }; pipe(add, double)(1, 2)", 6},
+		{"compose(inc, double)(true)", errorMessage("type mismatch: BOOLEAN * INTEGER")},
+		{"compose(inc, 5)", errorMessage("argument 2 to `compose` must be FUNCTION or BUILTIN, got INTEGER")},
+		{"pipe()", errorMessage("wrong number of arguments. got=0, want at least 1")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(prelude+tt.input), tt.expected)
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map(["a", "bb", "ccc"], len)`, "[1, 2, 3]"},
+		{`map(["a", "Bb"], upper)`, "[A, BB]"},
+		{"map([1, 2, 3], fn(x) { x * x })", "[1, 4, 9]"},
+		{"map([], fn(x) { x })", "[]"},
+		{`filter(["", "a", "", "b"], fn(s) { len(s) > 0 })`, "[a, b]"},
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", "[3, 4]"},
+		{"sort([3, 1, 2])", "[1, 2, 3]"},
+		{"sort([2.5, 1, 2])", "[1, 2, 2.5]"},
+		{`sort(["pear", "apple", "fig"])`, "[apple, fig, pear]"},
+		{"sort([3, 1, 2], fn(a, b) { a > b })", "[3, 2, 1]"},
+		{`sort(["ccc", "a", "bb"], fn(a, b) { len(a) < len(b) })`, "[a, bb, ccc]"},
+		{"let arr = [3, 1, 2]; sort(arr); arr", "[3, 1, 2]"},
+		{"map([1, 2], fn(x) { x + true })", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{"map([1], 1)", errorMessage("second argument to `map` must be FUNCTION or BUILTIN, got INTEGER")},
+		{`sort([1, "a"])`, errorMessage("cannot compare STRING with INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(string); ok {
+			if _, ok := evaluated.(*object.Array); !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. expected=%s, got=%s", expected, evaluated.Inspect())
+			}
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestCollectionAddition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1] + [2]", "[1, 2]"},
+		{"[1, 2] + []", "[1, 2]"},
+		{"[] + [[3]]", "[[3]]"},
+		{"let a = [1]; let b = a + [2]; a", "[1]"},
+		{`({"a": 1, "b": 2} + {"b": 3})["b"]`, 3},
+		{`let h = {"a": 1}; let m = h + {"a": 2}; h["a"]`, 1},
+		{`[1] + "a"`, errorMessage("type mismatch: ARRAY + STRING")},
+		{`{"a": 1} + [1]`, errorMessage("type mismatch: HASH + ARRAY")},
+		{"[1] - [1]", errorMessage("unknown operator: ARRAY - ARRAY")},
+		{`{"a": 1} * {"a": 1}`, errorMessage("unknown operator: HASH * HASH")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(string); ok {
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. expected=%s, got=%s", expected, evaluated.Inspect())
+			}
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+
+	evaluated := testEval(`{"a": 1} + {"b": 2}`)
+	hash, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("object is not Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("hash has wrong num of pairs. got=%d", len(hash.Pairs))
+	}
+	testIntegerObject(t, hash.Pairs[(&object.String{Value: "a"}).HashKey()].Value, 1)
+	testIntegerObject(t, hash.Pairs[(&object.String{Value: "b"}).HashKey()].Value, 2)
+}
+
+func TestStringCoercion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"count: " + 5`, "count: 5"},
+		{`5 + " apples"`, "5 apples"},
+		{`"ok: " + true`, "ok: true"},
+		{`"pi: " + 3.5`, "pi: 3.5"},
+		{`"list: " + [1, 2]`, "list: [1, 2]"},
+		{`"a" + "b"`, "ab"},
+		{`"a" - 1`, errorMessage("type mismatch: STRING - INTEGER")},
+	}
+
+	e := New(StringCoercion())
+	for _, tt := range tests {
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+	}
+
+	strict := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"count: " + 5`, errorMessage("type mismatch: STRING + INTEGER")},
+		{`"ok: " + true`, errorMessage("type mismatch: STRING + BOOLEAN")},
+	}
+
+	for _, tt := range strict {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTruthiness(t *testing.T) {
+	tests := []struct {
+		input  string
+		strict bool
+		loose  bool
+	}{
+		{"!!true", true, true},
+		{"!!false", false, false},
+		{"!!if (false) { 1 }", false, false},
+		{"!!0", true, false},
+		{"!!1", true, true},
+		{"!!0.0", true, false},
+		{"!!-0.5", true, true},
+		{`!!""`, true, false},
+		{`!!"a"`, true, true},
+		{"!![]", true, false},
+		{"!![0]", true, true},
+		{"!!{}", true, false},
+		{`!!{"a": 1}`, true, true},
+		{"!!remove({1}, 1)", true, false},
+		{"!!{1}", true, true},
+		{"!!fn() {}", true, true},
+		{"if (0) { true } else { false }", true, false},
+	}
+
+	e := New(LooseTruthiness())
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.strict)
+		testBooleanObject(t, testEvalWith(e, tt.input), tt.loose)
+	}
+
+	filter := `len(filter([0, 1, "", "a", []], fn(x) { x }))`
+	testIntegerObject(t, testEval(filter), 5)
+	testIntegerObject(t, testEvalWith(e, filter), 2)
+}
+
+func TestInspectBuiltin(t *testing.T) {
+	input := `
+	let adder = fn(x) { fn(y) { x + y } };
+	inspect({"ok": true, "adders": [adder(1)], "count": 2})`
+
+	expected := `HASH(3) {
+  STRING "adders": ARRAY(1) [
+    FUNCTION fn(y)
+  ]
+  STRING "count": INTEGER 2
+  STRING "ok": BOOLEAN true
+}`
+
+	testObject(t, testEval(input), expected)
+}
+
+func TestJSONRoundTripEvaluation(t *testing.T) {
+	tests := []string{
+		`let add = fn(x, y) { x + y }; add(2, 3) * -1`,
+		`fn fib(n) { if (n < 2) { return n } fib(n - 1) + fib(n - 2) } fib(10)`,
+		`let h = {"a": [1, 2.5, "three"], true: {4, 5}}; h["a"][1] + h.a[0]`,
+		`if (!(1 > 2)) { math.floor(math.pi) } else { null_value }`,
+		`let s = "leo" + "pard"; upper(s)`,
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", input, p.Errors())
+		}
+
+		data, err := ast.ToJSON(program)
+		if err != nil {
+			t.Fatalf("ToJSON returned error: %s", err)
+		}
+		decoded, err := ast.FromJSON(data)
+		if err != nil {
+			t.Fatalf("FromJSON returned error: %s", err)
+		}
+
+		again, err := ast.ToJSON(decoded)
+		if err != nil {
+			t.Fatalf("ToJSON returned error: %s", err)
+		}
+		// Decoded nodes carry no source positions, so compare without them.
+		if want, got := withoutPositions(t, data), withoutPositions(t, again); got != want {
+			t.Errorf("decoded program differs.\nexpected=%s\ngot=%s", want, got)
+		}
+
+		expected := Eval(program, object.NewEnvironment())
+		got := Eval(decoded, object.NewEnvironment())
+		if got.Type() != expected.Type() || got.Inspect() != expected.Inspect() {
+			t.Errorf("evaluation differs for %q. expected=%s, got=%s", input, expected.Inspect(), got.Inspect())
+		}
+	}
+}
+
+// withoutPositions returns the JSON in data with the "pos" and "end" fields
+// of every node removed.
+func withoutPositions(t *testing.T, data []byte) string {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+
+	var strip func(v interface{})
+	strip = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			delete(v, "pos")
+			delete(v, "end")
+			for _, child := range v {
+				strip(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				strip(child)
+			}
+		}
+	}
+	strip(value)
+
+	stripped, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("cannot encode JSON: %s", err)
+	}
+	return string(stripped)
+}
+
+func TestHelpBuiltin(t *testing.T) {
+	var out bytes.Buffer
+	e := New(Output(&out))
+
+	testObject(t, testEvalWith(e, `help("len")`), nil)
+	expected := "len: takes 1 argument\n" +
+		"Returns the length of a given object.\n"
+	if out.String() != expected {
+		t.Errorf("wrong help for len.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+
+	out.Reset()
+	testObject(t, testEvalWith(e, `help()`), nil)
+	listing := out.String()
+	for _, want := range []string{"\nlen ", "\nsort ", "\nhelp ", "1-2", "Returns the length"} {
+		if !strings.Contains(listing, want) {
+			t.Errorf("help listing does not contain %q:\n%s", want, listing)
+		}
+	}
+
+	testObject(t, testEvalWith(e, `help("nope")`), errorMessage("no builtin named `nope`"))
+	testObject(t, testEvalWith(e, `help(1)`), errorMessage("argument to `help` must be STRING, got INTEGER"))
+}
+
+func TestBuiltinArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len()`, errorMessage("wrong number of arguments. got=0, want=1")},
+		{`len("a", "b")`, errorMessage("wrong number of arguments. got=2, want=1")},
+		{`replace("a", "b")`, errorMessage("wrong number of arguments. got=2, want=3")},
+		{`sort()`, errorMessage("wrong number of arguments. got=0, want=1 or 2")},
+		{`sort([1], fn(a, b) { a < b }, 3)`, errorMessage("wrong number of arguments. got=3, want=1 or 2")},
+		{`compose()`, errorMessage("wrong number of arguments. got=0, want at least 1")},
+		{`now(1)`, errorMessage("wrong number of arguments. got=1, want=0")},
+		{`math.sqrt(1, 2)`, errorMessage("wrong number of arguments. got=2, want=1")},
+		{`partial(len)("a")`, 1},
+		{`partial(len)("a", "b")`, errorMessage("wrong number of arguments. got=2, want=1")},
+		{`puts()`, nil},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	b := &object.Builtin{Name: "between", MinArgs: 1, MaxArgs: 3}
+	err := checkArity(b, nil)
+	if err == nil || err.Message != "wrong number of arguments. got=0, want=1 to 3" {
+		t.Errorf("wrong arity error: %v", err)
+	}
+}
+
+func TestBuiltinArgTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`replace("a", 1, "b")`, errorMessage("argument 2 to `replace` must be STRING, got INTEGER")},
+		{`union({1}, [1])`, errorMessage("argument 2 to `union` must be SET, got ARRAY")},
+		{`pipe(len, len, 3)`, errorMessage("argument 3 to `pipe` must be FUNCTION or BUILTIN, got INTEGER")},
+		{`pipe(len, fn(x) { x * 2 })("abc")`, 6},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	b := &object.Builtin{
+		Name:     "pad",
+		MinArgs:  2,
+		MaxArgs:  2,
+		ArgTypes: [][]object.ObjectType{{object.ANY_OBJ}, {object.INTEGER_OBJ, object.FLOAT_OBJ, object.STRING_OBJ}},
+	}
+
+	if err := checkArgTypes(b, []object.Object{NULL, &object.Float{Value: 1}}); err != nil {
+		t.Errorf("unexpected error: %s", err.Message)
+	}
+
+	err := checkArgTypes(b, []object.Object{NULL, TRUE})
+	expected := "argument 2 to `pad` must be INTEGER, FLOAT or STRING, got BOOLEAN"
+	if err == nil || err.Message != expected {
+		t.Errorf("wrong type error. expected=%q, got=%v", expected, err)
+	}
+}
+
+func TestEntriesBuiltin(t *testing.T) {
+	input := `entries({"b": 2, "a": 1, 10: "ten", 2: "two", true: "yes", false: "no"})`
+
+	evaluated := testEval(input)
+	expected := "[[false, no], [true, yes], [2, two], [10, ten], [a, 1], [b, 2]]"
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong entries. expected=%q, got=%q", expected, evaluated.Inspect())
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`entries({})`, []int64{}},
+		{`let h = {"x": 1, "y": 2}; each(entries(h), fn(pair) { assert_eq(h[pair[0]], pair[1]) })`, nil},
+		{`each(entries({"x": 1}), fn(pair) { assert_eq(pair[1], 2) })`, errorMessage("assertion failed: 1 != 2")},
+		{`entries([1])`, errorMessage("argument 1 to `entries` must be HASH, got ARRAY")},
+		{`each([1], 2)`, errorMessage("argument 2 to `each` must be FUNCTION or BUILTIN, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if arr, ok := tt.expected.([]int64); ok {
+			testIntegerArray(t, evaluated, arr)
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestReduceAndScanBuiltins(t *testing.T) {
+	add := `let add = fn(acc, x) { acc + x };`
+
+	testIntegerArray(t, testEval(add+`scan([1, 2, 3], 0, add)`), []int64{0, 1, 3, 6})
+	testIntegerArray(t, testEval(add+`scan([], 5, add)`), []int64{5})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{add + `reduce([1, 2, 3], 0, add)`, 6},
+		{add + `reduce([], 5, add)`, 5},
+		{`reduce(["a", "b"], "", fn(acc, s) { acc + s })`, "ab"},
+		{add + `scan([1, "x", 3], 0, add)`, errorMessage("type mismatch: INTEGER + STRING")},
+		{add + `reduce([1, "x", 3], 0, add)`, errorMessage("type mismatch: INTEGER + STRING")},
+		{`scan(1, 0, len)`, errorMessage("argument 1 to `scan` must be ARRAY, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTakeAndDropBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int64
+	}{
+		{`take([1, 2, 3], 2)`, []int64{1, 2}},
+		{`take([1, 2, 3], 5)`, []int64{1, 2, 3}},
+		{`take([1, 2, 3], 0)`, []int64{}},
+		{`drop([1, 2, 3], 1)`, []int64{2, 3}},
+		{`drop([1, 2, 3], 3)`, []int64{}},
+		{`drop([1, 2, 3], 10)`, []int64{}},
+	}
+
+	for _, tt := range tests {
+		testIntegerArray(t, testEval(tt.input), tt.expected)
+	}
+
+	testObject(t, testEval(`take([1], -1)`), errorMessage("argument 2 to `take` must not be negative, got -1"))
+	testObject(t, testEval(`drop("abc", 1)`), errorMessage("argument 1 to `drop` must be ARRAY, got STRING"))
+}
+
+func TestDeferStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		result   interface{}
+	}{
+		{
+			`let f = fn() { defer log("first"); defer log("second"); log("body"); 1 }; f()`,
+			[]string{"body", "second", "first"},
+			1,
+		},
+		{
+			`let f = fn(x) { defer log("cleanup"); if (x > 0) { return "early"; } log("late"); "late" }; f(1)`,
+			[]string{"cleanup"},
+			"early",
+		},
+		{
+			`let f = fn() { defer log("cleanup"); 1 + true }; f()`,
+			[]string{"cleanup"},
+			errorMessage("type mismatch: INTEGER + BOOLEAN"),
+		},
+		{
+			`let f = fn() { defer 1 + true; 2 }; f()`,
+			nil,
+			errorMessage("type mismatch: INTEGER + BOOLEAN"),
+		},
+		{
+			`let inner = fn() { defer log("inner"); 1 }; let outer = fn() { defer log("outer"); inner() + 1 }; outer()`,
+			[]string{"inner", "outer"},
+			2,
+		},
+		{`defer log("x")`, nil, errorMessage("defer outside function")},
+	}
+
+	for _, tt := range tests {
+		var logged []string
+		e := New()
+		e.Register("log", func(args ...object.Object) object.Object {
+			logged = append(logged, args[0].Inspect())
+			return NULL
+		})
+
+		testObject(t, testEvalWith(e, tt.input), tt.result)
+		if strings.Join(logged, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("wrong deferred order for %q. expected=%v, got=%v", tt.input, tt.expected, logged)
+		}
+	}
+}
+
+func TestRegexBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match("(\w+)@(\w+)\.com", "mail bob@example.com now")`, "[bob@example.com, bob, example]"},
+		{`match("(a)|(b)", "b")`, "[b, null, b]"},
+		{`match("x+", "abc")`, "null"},
+		{`match_all("(\d)(\w)", "1a 2b 3")`, "[[1a, 1, a], [2b, 2, b]]"},
+		{`match_all("z", "abc")`, "[]"},
+		{`match("\x{41}+", "BAA")`, "[AA]"},
+		{`match("\\\\", "C:\\x")`, "[\\]"},
+		{`match("(", "abc")`, "ERROR: invalid pattern: error parsing regexp: missing closing ): `(`"},
+		{`match(1, "abc")`, "ERROR: argument 1 to `match` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %s. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	e := New()
+	input := `let count = fn(n) { if (n > 0) { match("a(b)", "ab"); count(n - 1) } }; count(5); match_all("c", "cc")`
+	testEvalWith(e, input)
+	if e.patterns.len() != 2 {
+		t.Errorf("wrong number of cached patterns. expected=2, got=%d", e.patterns.len())
+	}
+
+	e = New()
+	for i := 0; i < maxCachedPatterns+10; i++ {
+		e.compile(fmt.Sprintf("a{%d}", i))
+	}
+	testEvalWith(e, `match("1", "1")`)
+	if e.patterns.len() != maxCachedPatterns {
+		t.Errorf("pattern cache not bounded. expected=%d, got=%d", maxCachedPatterns, e.patterns.len())
+	}
+	if _, ok := e.patterns.get("1"); !ok {
+		t.Errorf("most recently used pattern was evicted")
+	}
+}
+
+func TestRegexReplaceBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`regex_replace("(\w+)@(\w+)", "bob@home", "$2 of $1")`, "home of bob"},
+		{`regex_replace("a+", "caaat baat", "o")`, "cot bot"},
+		{`regex_replace("(?P<first>\w+) (?P<last>\w+)", "Ada Lovelace", "${last}, ${first}")`, "Lovelace, Ada"},
+		{`regex_replace("x", "abc", "y")`, "abc"},
+		{`regex_replace("[", "abc", "y")`, errorMessage("invalid pattern: error parsing regexp: missing closing ]: `[`")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	e := New()
+	testEvalWith(e, `match("a", "a"); regex_replace("a", "aa", "b")`)
+	if e.patterns.len() != 1 {
+		t.Errorf("regex_replace did not reuse the cached pattern. got=%d patterns", e.patterns.len())
+	}
+}
+
+func TestUnsetBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let x = 1; unset("x")`, true},
+		{`let x = 1; unset("x"); x`, errorMessage("identifier not found: x")},
+		{`unset("missing")`, false},
+		{`let x = 1; let f = fn() { let x = 2; unset("x"); x }; f()`, 1},
+		{`let x = 1; let f = fn() { unset("x") }; f(); x`, 1},
+		{`let x = 1; map(["x"], unset)`, errorMessage("`unset` must be called directly")},
+		{`unset(1)`, errorMessage("argument 1 to `unset` must be STRING, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestShadowingBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = fn(s) { let len = fn(x) { 42 }; len(s) }; f("abc") + len("abc")`, 45},
+		{`let f = fn(len) { len }; f(7) + len("ab")`, 9},
+		{`let first = fn(arr) { arr[1] }; first([1, 2])`, 2},
+		{`let g = fn() { let len = 1; unset("len"); len("abc") }; g()`, 3},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestGlobalsBuiltin(t *testing.T) {
+	input := `let x = 1;
+fn double(n) { let local = n; n * 2 }
+let g = fn() { let hidden = 3; globals() };
+g()`
+
+	evaluated := testEval(input)
+	hash, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("object is not Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	names := []string{}
+	for _, pair := range hash.Pairs {
+		names = append(names, pair.Key.(*object.String).Value)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "double,g,x" {
+		t.Errorf("wrong globals. got=%v", names)
+	}
+
+	testIntegerObject(t, testEval(`let x = 1; fn double(n) { n * 2 } globals()["double"](globals()["x"] + 2)`), 6)
+}
+
+func TestChainedComparisons(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      interface{}
+		expectedCalls int
+	}{
+		{`1 < tick(2) < 3`, true, 1},
+		{`1 < tick(5) < 3`, false, 1},
+		{`3 > tick(2) > 1 < 4`, true, 1},
+		{`3 < 2 < tick(5)`, false, 0},
+		{`1 < 2 < tick(3) < 2 < tick(9)`, false, 1},
+		{`1 < "a" < 3`, errorMessage("type mismatch: INTEGER < STRING"), 0},
+		{`(1 < 2) < 3`, errorMessage("type mismatch: BOOLEAN < INTEGER"), 0},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		e := New()
+		e.Register("tick", func(args ...object.Object) object.Object {
+			calls++
+			return args[0]
+		})
+
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+		if calls != tt.expectedCalls {
+			t.Errorf("wrong number of evaluations for %q. expected=%d, got=%d", tt.input, tt.expectedCalls, calls)
+		}
+	}
+}
+
+func TestNullCoalescing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      interface{}
+		expectedCalls int
+	}{
+		{`1 ?? tick(2)`, 1, 0},
+		{`false ?? tick(2)`, false, 0},
+		{`{"a": 1}["b"] ?? tick(2)`, 2, 1},
+		{`{"a": 1}["a"] ?? tick(2)`, 1, 0},
+		{`let h = {}; h["x"] ?? h["y"] ?? tick(3)`, 3, 1},
+		{`missing ?? 1`, errorMessage("identifier not found: missing"), 0},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		e := New()
+		e.Register("tick", func(args ...object.Object) object.Object {
+			calls++
+			return args[0]
+		})
+
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+		if calls != tt.expectedCalls {
+			t.Errorf("wrong number of right operand evaluations for %q. expected=%d, got=%d", tt.input, tt.expectedCalls, calls)
+		}
+	}
+}
+
+func TestOptionalAccess(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = {}; a["missing"]?[0]`, nil},
+		{`let a = {}; a.missing?.name`, nil},
+		{`let a = {"user": {"tags": ["x", "y"]}}; a?.user?.tags?[1]`, "y"},
+		{`let a = {"user": {"name": "Ann"}}; a.user?.name`, "Ann"},
+		{`let a = {}; a.missing?.name ?? "anon"`, "anon"},
+		{`let a = {}; a.missing?[tick()]`, nil},
+		{`let a = {}; a.missing[0]`, errorMessage("index operator not supported: NULL")},
+		{`let a = {}; a.missing.name`, errorMessage("member access not supported: NULL")},
+		{`1?.x`, errorMessage("member access not supported: INTEGER")},
+	}
+
+	for _, tt := range tests {
+		e := New()
+		e.Register("tick", func(args ...object.Object) object.Object {
+			return newError("index evaluated")
+		})
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	input := `let count = fn() { yield 1; yield 2; yield 3; };
+let g = count();
+[next(g), next(g), next(g), next(g), next(g)]`
+
+	evaluated := testEval(input)
+	if evaluated.Inspect() != "[1, 2, 3, null, null]" {
+		t.Errorf("wrong generated values. got=%s", evaluated.Inspect())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let pair = fn(a, b) { yield a; yield b }; let g = pair("x", "y"); let h = pair(1, 2); [next(g), next(h), next(g), next(h)]`, "[x, 1, y, 2]"},
+		{`let g = fn(n) { if (n > 0) { yield "big"; return 0; } yield "small" }; let a = g(1); [next(a), next(a)]`, "[big, null]"},
+		{`let g = fn() { yield 1; 1 + true; yield 2 }; let a = g(); next(a); next(a)`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`let g = fn() { defer log("done"); yield 1; yield 2 }; let a = g(); [next(a), log("between"), next(a), next(a)]`, "[1, null, 2, null]"},
+		{`let inner = fn() { yield 1; yield 2 }; let outer = fn() { let i = inner(); yield next(i) * 10; yield next(i) * 10 }; let o = outer(); [next(o), next(o), next(o)]`, "[10, 20, null]"},
+		{`let g = fn() { let f = fn() { 5 }; yield f() }; let a = g(); next(a)`, "5"},
+		{`yield 1`, "ERROR: yield outside generator function"},
+		{`next(1)`, "ERROR: argument 1 to `next` must be GENERATOR, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		var logged []string
+		e := New()
+		e.Register("log", func(args ...object.Object) object.Object {
+			logged = append(logged, args[0].Inspect())
+			return NULL
+		})
+
+		evaluated := testEvalWith(e, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+		if strings.Contains(tt.input, "defer") && strings.Join(logged, ",") != "between,done" {
+			t.Errorf("deferred call in generator ran at the wrong time. got=%v", logged)
+		}
+	}
+
+	gen, ok := testEval(`let g = fn() { 1 + true; yield 2 }; g()`).(*object.Generator)
+	if !ok {
+		t.Fatalf("calling a generator function did not return a Generator")
+	}
+	if val, ok := gen.Next(); !ok || !isError(val) {
+		t.Errorf("first Next did not return the error. got=%v, %t", val, ok)
+	}
+	if val, ok := gen.Next(); ok {
+		t.Errorf("generator not exhausted after error. got=%v", val)
+	}
+
+	e := New()
+	gen = testEvalWith(e, `let g = fn() { yield 1; yield 2 }; g()`).(*object.Generator)
+	gen.Next()
+	gen.Stop()
+	if val, ok := gen.Next(); ok {
+		t.Errorf("stopped generator resumed. got=%v", val)
+	}
+	gen.Stop()
+
+	unstarted := testEval(`let g = fn() { yield 1 }; g()`).(*object.Generator)
+	unstarted.Stop()
+	if val, ok := unstarted.Next(); ok {
+		t.Errorf("generator stopped before starting resumed. got=%v", val)
+	}
+
+	for i := 0; i < maxGeneratorBodies+1; i++ {
+		e.isGenerator(&object.Function{Body: &ast.BlockStatement{}})
+	}
+	if len(e.generatorBodies) > maxGeneratorBodies {
+		t.Errorf("generator body cache not bounded. got=%d bodies", len(e.generatorBodies))
+	}
+}
+
+func TestTakeWhileAndDropWhileBuiltins(t *testing.T) {
+	small := `let small = fn(x) { x < 3 };`
+
+	tests := []struct {
+		input    string
+		expected []int64
+	}{
+		{small + `take_while([1, 2, 3, 1], small)`, []int64{1, 2}},
+		{small + `drop_while([1, 2, 3, 1], small)`, []int64{3, 1}},
+		{small + `take_while([5, 1], small)`, []int64{}},
+		{small + `drop_while([5, 1], small)`, []int64{5, 1}},
+		{small + `take_while([1, 2], small)`, []int64{1, 2}},
+		{small + `drop_while([1, 2], small)`, []int64{}},
+		{small + `take_while([], small)`, []int64{}},
+	}
+
+	for _, tt := range tests {
+		testIntegerArray(t, testEval(tt.input), tt.expected)
+	}
+
+	stops := `take_while([1, 5, "x"], fn(x) { x < 3 })`
+	testIntegerArray(t, testEval(stops), []int64{1})
+	testObject(t, testEval(`drop_while([1, "x"], fn(x) { x < 3 })`), errorMessage("type mismatch: STRING < INTEGER"))
+}
+
+func TestCountBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`count([1, 2, 3, 4, 6], fn(x) { x / 2 * 2 == x })`, 3},
+		{`count([1, 3], fn(x) { x / 2 * 2 == x })`, 0},
+		{`count([1, 2, 3])`, 3},
+		{`count([])`, 0},
+		{`count("abc")`, errorMessage("argument 1 to `count` must be ARRAY, got STRING")},
+		{`count([1], 2)`, errorMessage("argument 2 to `count` must be FUNCTION or BUILTIN, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSumAndProductBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`sum([1, 2, 3])`, 6},
+		{`product([2, 3, 4])`, 24},
+		{`sum([])`, 0},
+		{`product([])`, 1},
+		{`sum([1, "2"])`, errorMessage("element 1 of argument to `sum` must be INTEGER or FLOAT, got STRING")},
+		{`product(3)`, errorMessage("argument 1 to `product` must be ARRAY, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	floats := []struct {
+		input    string
+		expected float64
+	}{
+		{`sum([1, 2.5, 3])`, 6.5},
+		{`product([2, 0.5, 3])`, 3.0},
+		{`sum([0.5])`, 0.5},
+	}
+
+	for _, tt := range floats {
+		testFloatObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFlatMapBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`flat_map([1, 2, 3], fn(n) { [n, n] })`, []int64{1, 1, 2, 2, 3, 3}},
+		{`flat_map([1, 2, 3], fn(n) { if (n == 2) { [] } else { [n] } })`, []int64{1, 3}},
+		{`flat_map([], fn(n) { [n] })`, []int64{}},
+		{`flat_map([1], fn(n) { n })`, errorMessage("function passed to `flat_map` must return ARRAY, got INTEGER")},
+		{`flat_map([1], 2)`, errorMessage("argument 2 to `flat_map` must be FUNCTION or BUILTIN, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.([]int64); ok {
+			testIntegerArray(t, evaluated, expected)
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestShuffleBuiltin(t *testing.T) {
+	input := `let arr = [1, 2, 3, 4, 5, 6, 7, 8]; seed(7); let shuffled = shuffle(arr); [arr, shuffled, shuffle(arr)]`
+
+	first := testEvalWith(New(), input)
+	second := testEvalWith(New(), input)
+	if first.Inspect() != second.Inspect() {
+		t.Errorf("seeded shuffles differ. first=%s, second=%s", first.Inspect(), second.Inspect())
+	}
+
+	arr, ok := first.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", first, first)
+	}
+	testIntegerArray(t, arr.Elements[0], []int64{1, 2, 3, 4, 5, 6, 7, 8})
+
+	shuffled, ok := arr.Elements[1].(*object.Array)
+	if !ok {
+		t.Fatalf("shuffle result is not Array. got=%T (%+v)", arr.Elements[1], arr.Elements[1])
+	}
+	seen := map[int64]bool{}
+	for _, el := range shuffled.Elements {
+		seen[el.(*object.Integer).Value] = true
+	}
+	if len(shuffled.Elements) != 8 || len(seen) != 8 {
+		t.Errorf("shuffle is not a permutation. got=%s", shuffled.Inspect())
+	}
+
+	testIntegerArray(t, testEval(`shuffle([])`), []int64{})
+	testObject(t, testEval(`shuffle("abc")`), errorMessage("argument 1 to `shuffle` must be ARRAY, got STRING"))
+}
+
+func TestSampleBuiltin(t *testing.T) {
+	input := `let arr = [1, 2, 3, 4, 5, 6]; seed(3); [sample(arr), sample(arr, 3), sample(arr, 6)]`
+
+	first := testEvalWith(New(), input)
+	second := testEvalWith(New(), input)
+	if first.Inspect() != second.Inspect() {
+		t.Errorf("seeded samples differ. first=%s, second=%s", first.Inspect(), second.Inspect())
+	}
+
+	arr, ok := first.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", first, first)
+	}
+	if n, ok := arr.Elements[0].(*object.Integer); !ok || n.Value < 1 || n.Value > 6 {
+		t.Errorf("sample(arr) is not an element. got=%s", arr.Elements[0].Inspect())
+	}
+	for _, el := range arr.Elements[1:] {
+		sample := el.(*object.Array)
+		seen := map[int64]bool{}
+		for _, el := range sample.Elements {
+			seen[el.(*object.Integer).Value] = true
+		}
+		if len(seen) != len(sample.Elements) {
+			t.Errorf("sample has repeated elements. got=%s", sample.Inspect())
+		}
+	}
+	if got := len(arr.Elements[1].(*object.Array).Elements); got != 3 {
+		t.Errorf("sample(arr, 3) has wrong length. got=%d", got)
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`sample([7])`, 7},
+		{`sample([])`, errorMessage("cannot sample from an empty array")},
+		{`sample([1, 2], 3)`, errorMessage("argument 2 to `sample` must be between 0 and 2, got 3")},
+		{`sample([1, 2], -1)`, errorMessage("argument 2 to `sample` must be between 0 and 2, got -1")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+	testIntegerArray(t, testEval(`sample([], 0)`), []int64{})
+}
+
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     string
+		data     map[string]string
+		expected string
+	}{
+		{`1 + "a"`, object.TYPE_ERROR, map[string]string{"operator": "+", "left": "INTEGER", "right": "STRING"}, "type mismatch: INTEGER + STRING"},
+		{`true - false`, object.TYPE_ERROR, map[string]string{"operator": "-", "left": "BOOLEAN", "right": "BOOLEAN"}, "unknown operator: BOOLEAN - BOOLEAN"},
+		{`1[0]`, object.TYPE_ERROR, nil, "index operator not supported: INTEGER"},
+		{`{}[fn() {}]`, object.TYPE_ERROR, nil, "unusable as hash key: FUNCTION"},
+		{`take(1, 2)`, object.TYPE_ERROR, nil, "argument 1 to `take` must be ARRAY, got INTEGER"},
+		{`first(1)`, object.TYPE_ERROR, nil, "argument to `first` must be ARRAY, got INTEGER"},
+		{`sort([1], 2)`, object.TYPE_ERROR, nil, "second argument to `sort` must be FUNCTION or BUILTIN, got INTEGER"},
+		{`math.sqrt("a")`, object.TYPE_ERROR, nil, "argument to `sqrt` must be INTEGER or FLOAT, got STRING"},
+		{`take([1], -1)`, object.RANGE_ERROR, nil, "argument 2 to `take` must not be negative, got -1"},
+		{`chunk([1], 0)`, object.RANGE_ERROR, nil, "chunk size must be positive, got 0"},
+		{`sample([1], 2)`, object.RANGE_ERROR, nil, "argument 2 to `sample` must be between 0 and 1, got 2"},
+		{`"a" * -1`, object.RANGE_ERROR, nil, "negative repeat count: -1"},
+		{`1 / 0`, object.RANGE_ERROR, nil, "division by zero"},
+		{`1 // 0`, object.RANGE_ERROR, nil, "division by zero"},
+		{`let zero = 0; 5 // zero`, object.RANGE_ERROR, nil, "division by zero"},
+		{`let [a, b] = [1]`, object.ARITY_ERROR, nil, "wrong number of values to destructure. got=1, want=2"},
+		{`let {a} = {}`, object.KEY_ERROR, map[string]string{"key": "a"}, "key not found: a"},
+		{`help("nope")`, object.NAME_ERROR, map[string]string{"name": "nope"}, "no builtin named `nope`"},
+		{`missing`, object.NAME_ERROR, map[string]string{"name": "missing"}, "identifier not found: missing"},
+		{`len()`, object.ARITY_ERROR, nil, "wrong number of arguments. got=0, want=1"},
+		{`fn(x) { x }()`, object.ARITY_ERROR, nil, "wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		err, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error for %q", tt.input)
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("wrong message for %q. expected=%q, got=%q", tt.input, tt.expected, err.Message)
+		}
+		if err.Inspect() != "ERROR: "+tt.expected {
+			t.Errorf("wrong Inspect for %q. got=%q", tt.input, err.Inspect())
+		}
+		if err.Code != tt.code {
+			t.Errorf("wrong code for %q. expected=%q, got=%q", tt.input, tt.code, err.Code)
+		}
+		if tt.data == nil {
+			continue
+		}
+		if err.Data == nil {
+			t.Errorf("no data for %q", tt.input)
+			continue
+		}
+		if len(err.Data.Pairs) != len(tt.data) {
+			t.Errorf("wrong data for %q. got=%s", tt.input, err.Data.Inspect())
+		}
+		for name, value := range tt.data {
+			pair, ok := err.Data.Pairs[(&object.String{Value: name}).HashKey()]
+			if !ok || pair.Value.Inspect() != value {
+				t.Errorf("wrong data %s for %q. expected=%q, got=%v", name, tt.input, value, pair.Value)
+			}
+		}
+	}
+
+	// Out of range indexing is only an error with StrictIndexing.
+	testNullObject(t, testEval(`[1, 2][5]`))
+	e := New(StrictIndexing())
+	err, ok := testEvalWith(e, `let xs = [1, 2]; xs[5]`).(*object.Error)
+	if !ok {
+		t.Fatalf("no error for out of range index")
+	}
+	if err.Code != object.RANGE_ERROR || err.Message != "index out of range: 5, length 2" {
+		t.Errorf("wrong error for out of range index. got=%s (%s)", err.Message, err.Code)
+	}
+	if index, ok := err.Data.Pairs[(&object.String{Value: "index"}).HashKey()]; !ok || index.Value.Inspect() != "5" {
+		t.Errorf("wrong index data. got=%s", err.Data.Inspect())
+	}
+	if err, ok := testEvalWith(e, `[1][-1]`).(*object.Error); !ok || err.Code != object.RANGE_ERROR {
+		t.Errorf("negative index not a RANGE_ERROR. got=%v", err)
+	}
+	testNullObject(t, testEvalWith(e, `[1]?[5]`))
+	testIntegerObject(t, testEvalWith(e, `[1, 2][1]`), 2)
+}
+
+func TestBlockExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let x = { let a = 1; a + 1 }; x`, 2},
+		{`{ 1; 2; 3 }`, 3},
+		{`{ let a = 1; }`, nil},
+		{`let a = 1; let b = { let a = 10; a * 2 }; a + b`, 21},
+		{`let b = { let a = 10; a }; a`, errorMessage("identifier not found: a")},
+		{`let a = 1; { a + 1; } + { a + 2; }`, 5},
+		{`{ let a = missing; 1 }`, errorMessage("identifier not found: missing")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIfExpressionValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = 3; let b = 5; let max = if (a > b) { a } else { b }; max`, 5},
+		{`let a = 7; let b = 5; let max = if (a > b) { a } else { b }; max`, 7},
+		{`let x = if (false) { 1 }; x`, nil},
+		{`let x = if (true) { let y = 2; y * 3 }; x`, 6},
+		{`let x = if (true) { let y = 2; }; x`, nil},
+		{`(if (true) { 1 } else { 2 }) + 10`, 11},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrayDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let [a, b, c] = [1, 2, 3]; a * 100 + b * 10 + c`, 123},
+		{`let [head, ...tail] = [1, 2, 3]; head`, 1},
+		{`let [head, ...tail] = [1, 2, 3]; tail`, []int64{2, 3}},
+		{`let [head, ...tail] = [1]; tail`, []int64{}},
+		{`let [...all] = [4, 5]; all`, []int64{4, 5}},
+		{`let pair = fn() { [7, 8] }; let [x, y] = pair(); y - x`, 1},
+		{`let f = fn(arr) { let [a, b] = arr; a + b }; f([1, 2])`, 3},
+		{`let [a, b] = [1, 2, 3];`, errorMessage("wrong number of values to destructure. got=3, want=2")},
+		{`let [a, b] = [1];`, errorMessage("wrong number of values to destructure. got=1, want=2")},
+		{`let [a, b, ...c] = [1];`, errorMessage("wrong number of values to destructure. got=1, want at least 2")},
+		{`let [a] = 1;`, errorMessage("cannot destructure INTEGER with an array pattern")},
+		{`let [a, b] = [1]; a`, errorMessage("wrong number of values to destructure. got=1, want=2")},
+		{`let [a] = missing;`, errorMessage("identifier not found: missing")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.([]int64); ok {
+			testIntegerArray(t, evaluated, expected)
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestHashDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let person = {"name": "leo", "age": 4}; let {name, age} = person; name`, "leo"},
+		{`let person = {"name": "leo", "age": 4}; let {name, age} = person; age`, 4},
+		{`let {name: n} = {"name": "leo"}; n`, "leo"},
+		{`let {name: n} = {"name": "leo"}; name`, errorMessage("identifier not found: name")},
+		{`let {} = {"a": 1}; 1`, 1},
+		{`let {name, age} = {"name": "leo"};`, errorMessage("key not found: age")},
+		{`let {a} = [1];`, errorMessage("cannot destructure ARRAY with a hash pattern")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		logged   string
+		expected string
+	}{
+		{"for (x in [1, 2, 3]) { log(x * 10) }", "10,20,30", "null"},
+		{`for (k in {"b": 2, "c": 3, "a": 1}) { log(k) }`, "a,b,c", "null"},
+		{"for (x in {3, 1, 2}) { log(x) }", "1,2,3", "null"},
+		{`for (c in "héy") { log(c) }`, "h,é,y", "null"},
+		{"for (x in []) { log(x) }", "", "null"},
+		{"for (x in [1, 2, 3, 4, 5]) { if (x == 2) { continue } if (x == 4) { break } log(x) }", "1,3", "null"},
+		{"for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y > x) { break } log(x * 10 + y) } }", "11,21,22", "null"},
+		{"let find = fn(xs) { for (x in xs) { if (x > 1) { return x } } -1 }; [find([1, 5, 7]), find([0])]", "", "[5, -1]"},
+		{"let g = fn() { yield 1; yield 2 }; for (x in g()) { log(x) }", "1,2", "null"},
+		{"let g = fn() { for (x in [1, 2]) { yield x * 2 } }; let a = g(); [next(a), next(a), next(a)]", "", "[2, 4, null]"},
+		{"let x = 0; for (x in [1, 2]) { let y = x; } [x, y]", "", "ERROR: identifier not found: y"},
+		{"let x = 0; for (x in [1, 2]) { log(x) } x", "1,2", "0"},
+		{"for (x in [1, 2]) { log(x); x + true; log(0) }", "1", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`for (i, x in ["a", "b", "c"]) { log(i); log(x) }`, "0,a,1,b,2,c", "null"},
+		{`for (k, v in {"b": 2, "a": 1}) { log(k); log(v) }`, "a,1,b,2", "null"},
+		{"for (i, x in {30, 10, 20}) { log(i * 100 + x) }", "10,120,230", "null"},
+		{`for (i, c in "héy") { log(i); log(c) }`, "0,h,1,é,2,y", "null"},
+		{"let g = fn() { yield 5; yield 6 }; for (i, x in g()) { log(i + x) }", "5,7", "null"},
+		{`let g = fn() { defer log("stopped"); for (x in [1, 2, 3]) { yield x } }; for (x in g()) { log(x); if (x == 2) { break } }`, "1,2,stopped", "null"},
+		{`let g = fn() { defer log("stopped"); yield 1; yield 2 }; let a = g(); for (x in a) { return x } next(a)`, "stopped", "1"},
+		{"for (i, x in [7, 8]) { if (i == 0) { continue } log(x) }", "8", "null"},
+		{"for (x in 5) { log(x) }", "", "ERROR: cannot iterate over INTEGER"},
+		{"for (x in missing) { log(x) }", "", "ERROR: identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		var logged []string
+		e := New()
+		e.Register("log", func(args ...object.Object) object.Object {
+			logged = append(logged, args[0].Inspect())
+			return NULL
+		})
+
+		evaluated := testEvalWith(e, tt.input)
+		if evaluated == nil {
+			evaluated = NULL
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+		if strings.Join(logged, ",") != tt.logged {
+			t.Errorf("wrong iterations for %q. expected=%s, got=%s", tt.input, tt.logged, strings.Join(logged, ","))
+		}
+	}
+
+	// Each iteration binds the loop variable afresh, so closures keep the
+	// element of their own iteration.
+	input := `let fs = fn() { for (x in [1, 2, 3]) { yield fn() { x } } };
+let g = fs();
+let a = next(g);
+let b = next(g);
+[a(), b()]`
+	testIntegerArray(t, testEval(input), []int64{1, 2})
+}
+
+func TestChannels(t *testing.T) {
+	input := `let ch = channel();
+let producer = fn(n) { for (x in [1, 2, 3]) { send(ch, x * n) } };
+spawn(producer, 10);
+[receive(ch), receive(ch), receive(ch)]`
+	testIntegerArray(t, testEval(input), []int64{10, 20, 30})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"channel()", "channel"},
+		{"spawn(fn() { 1 })", "task"},
+		{"let ch = channel(); spawn(send, ch, 5); receive(ch)", 5},
+		{`let ch = channel(); spawn(fn() { defer send(ch, "deferred"); 1 }); receive(ch)`, "deferred"},
+		{"let ch = channel(); spawn(fn() { send(ch, map([1, 2], fn(x) { x + 1 })) }); receive(ch)", "[2, 3]"},
+		{"let ch = channel(); spawn(fn() { send(ch, double(4)) }); receive(ch)", 8},
+		{"spawn(1)", errorMessage("argument 1 to `spawn` must be FUNCTION or BUILTIN, got INTEGER")},
+		{"send(1, 2)", errorMessage("argument 1 to `send` must be CHANNEL, got INTEGER")},
+		{"receive([])", errorMessage("argument 1 to `receive` must be CHANNEL, got ARRAY")},
+	}
+
+	e := New()
+	e.Register("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+	for _, tt := range tests {
+		evaluated := testEvalWith(e, tt.input)
+		if s, ok := tt.expected.(string); ok && evaluated.Type() != object.STRING_OBJ {
+			if evaluated.Inspect() != s {
+				t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, s, evaluated.Inspect())
+			}
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestWait(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; wait(spawn(fib, 15))", 610},
+		{"let t = spawn(fn(a, b) { a * b }, 6, 7); [wait(t), wait(t)]", "[42, 42]"},
+		{"let a = spawn(fn() { 1 }); let b = spawn(fn() { 2 }); wait(b) - wait(a)", 1},
+		{"wait(spawn(fn() { return 3; 4 }))", 3},
+		{"wait(spawn(fn() {}))", nil},
+		{"wait(spawn(fn() { 1 + true }))", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{"let t = spawn(fn() { 1 + true }); wait(t); 5", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{"wait(1)", errorMessage("argument 1 to `wait` must be TASK, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if s, ok := tt.expected.(string); ok {
+			if evaluated.Inspect() != s {
+				t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, s, evaluated.Inspect())
+			}
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	// The slow producer only sends once the gate is opened, after select
+	// has returned the value of the fast one.
+	input := `let fast = channel();
+let slow = channel();
+let gate = channel();
+spawn(fn() { receive(gate); send(slow, "slow") });
+spawn(fn() { send(fast, "fast") });
+let first = select([slow, fast]);
+send(gate, true);
+let second = select([slow, fast]);
+[first, second]`
+	evaluated := testEval(input)
+	if evaluated.Inspect() != "[[1, fast], [0, slow]]" {
+		t.Errorf("wrong result. got=%s", evaluated.Inspect())
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"select([])", errorMessage("`select` needs at least one channel")},
+		{"select([channel(), 1])", errorMessage("element 1 of `select` must be CHANNEL, got INTEGER")},
+		{"select(channel())", errorMessage("argument 1 to `select` must be ARRAY, got CHANNEL")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMutexAndAtomic(t *testing.T) {
+	// Workers increment a host counter under a mutex and an atomic integer
+	// without one; run with -race.
+	counter := 0
+	e := New()
+	e.Register("increment", func(args ...object.Object) object.Object {
+		counter++
+		return NULL
+	})
+
+	input := `let m = mutex();
+let n = atomic();
+let done = channel();
+let worker = fn(times) {
+  if (times == 0) { send(done, true) } else {
+    lock(m);
+    increment();
+    unlock(m);
+    atomic_add(n, 1);
+    worker(times - 1)
+  }
+};
+for (i in [1, 2, 3, 4]) { spawn(worker, 50) }
+for (i in [1, 2, 3, 4]) { receive(done) }
+atomic_add(n, 0)`
+	testIntegerObject(t, testEvalWith(e, input), 200)
+	if counter != 200 {
+		t.Errorf("wrong counter. expected=200, got=%d", counter)
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"mutex()", "mutex"},
+		{"let m = mutex(); lock(m); unlock(m); lock(m); unlock(m)", nil},
+		{"atomic(5)", "atomic(5)"},
+		{"let n = atomic(5); atomic_add(n, -7); n", "atomic(-2)"},
+		{"unlock(mutex())", errorMessage("unlock of unlocked mutex")},
+		{"lock(1)", errorMessage("argument 1 to `lock` must be MUTEX, got INTEGER")},
+		{"atomic_add(atomic(), 1.5)", errorMessage("argument 2 to `atomic_add` must be INTEGER, got FLOAT")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if s, ok := tt.expected.(string); ok {
+			if evaluated.Inspect() != s {
+				t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, s, evaluated.Inspect())
+			}
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestThrowaway(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [_, x] = [1, 2]; x", 2},
+		{"let [_, _, x] = [1, 2, 3]; x", 3},
+		{`let {a: _, b} = {"a": 1, "b": 2}; b`, 2},
+		{"let [x, ..._] = [1, 2, 3]; x", 1},
+		{"let f = fn(_, y, _) { y }; f(1, 2, 3)", 2},
+		{"let n = 0; for (_ in [1, 2, 3]) { let n = 1 }; n", 0},
+		{"let f = fn() { for (i, _ in [5, 6]) { if (i == 1) { return i } } }; f()", 1},
+		{"let _ = 1; let _ = 2; _", errorMessage("cannot use _ as a value")},
+		{"let [_, x] = [1, 2]; _", errorMessage("cannot use _ as a value")},
+		{"fn(_) { _ }(1)", errorMessage("cannot use _ as a value")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// Hosts may bind _ themselves.
+	env := object.NewEnvironment()
+	env.Set("_", &object.Integer{Value: 7})
+	testIntegerObject(t, Eval(parser.New(lexer.New("let _ = 1; _")).ParseProgram(), env), 7)
+}
+
+func TestSmallIntegerCache(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		cached   bool
+	}{
+		{"-128", -128, true},
+		{"0", 0, true},
+		{"200 + 55", 255, true},
+		{"len([1, 2, 3])", 3, true},
+		{"256", 256, false},
+		{"-129", -129, false},
+		{"1000 * 1000", 1000000, false},
+	}
+
+	for _, tt := range tests {
+		first, second := testEval(tt.input), testEval(tt.input)
+		testIntegerObject(t, first, tt.expected)
+		testIntegerObject(t, second, tt.expected)
+		if (first == second) != tt.cached {
+			t.Errorf("%q evaluated to the same object twice: %t, expected %t", tt.input, first == second, tt.cached)
+		}
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { newInteger(42) }); allocs != 0 {
+		t.Errorf("newInteger(42) allocated %v times", allocs)
+	}
+}
+
+func BenchmarkSmallIntegerLoop(b *testing.B) {
+	program := parser.New(lexer.New(`let count = fn(n) { if (n > 0) { count(n - 1) } else { 0 } }; count(100)`)).ParseProgram()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
+	}
+}
+
+func TestStringBuilder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"to_string(string_builder())", ""},
+		{`let sb = string_builder(); append(sb, "a", "b"); append(sb, 1, true, [2]); to_string(sb)`, "ab1true[2]"},
+		{`to_string(append(append(string_builder(), "x"), "y"))`, "xy"},
+		{`let sb = string_builder(); for (c in "abc") { append(sb, c, c) } to_string(sb)`, "aabbcc"},
+		{"string_builder()", "string_builder"},
+		{`append("a", "b")`, errorMessage("argument 1 to `append` must be STRING_BUILDER, got STRING")},
+		{"to_string(1)", errorMessage("argument 1 to `to_string` must be STRING_BUILDER, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if s, ok := tt.expected.(string); ok && evaluated.Type() == object.BUILDER_OBJ {
+			if evaluated.Inspect() != s {
+				t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, s, evaluated.Inspect())
+			}
+			continue
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+// benchmarkConcat evaluates a program made of init followed by 10,000
+// copies of step.
+func benchmarkConcat(b *testing.B, init, step string) {
+	program := parser.New(lexer.New(init + strings.Repeat(step, 10000))).ParseProgram()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment())
+	}
+}
+
+func BenchmarkConcatPlus(b *testing.B) {
+	benchmarkConcat(b, `let s = "";`, `let s = s + "x";`)
+}
+
+func BenchmarkConcatStringBuilder(b *testing.B) {
+	benchmarkConcat(b, `let sb = string_builder();`, `append(sb, "x");`)
+}
+
+func TestSharedBuiltins(t *testing.T) {
+	overridden := New()
+	overridden.Register("len", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: -1}
+	})
+
+	testIntegerObject(t, testEvalWith(overridden, `len("abc")`), -1)
+	testIntegerObject(t, testEvalWith(New(), `len("abc")`), 3)
+	testObject(t, testEvalWith(New(Sandboxed()), `env("HOME")`), errorMessage("operation not permitted in sandbox: `env`"))
+
+	names := overridden.BuiltinNames()
+	count := 0
+	for _, name := range names {
+		if name == "len" {
+			count++
+		}
+	}
+	if count != 1 || len(names) != len(New().BuiltinNames()) {
+		t.Errorf("wrong builtin names after overriding len. got=%v", names)
+	}
+}
+
+func BenchmarkTinyPrograms(b *testing.B) {
+	program := parser.New(lexer.New("let x = 1; x + len([x])")).ParseProgram()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(Sandboxed()).Eval(program, object.NewEnvironment())
+	}
+}
+
+func TestSpawnSharesEnvironment(t *testing.T) {
+	// Spawned readers look up x and define bindings of their own while the
+	// program keeps rebinding x at the top level; run with -race.
+	input := `let x = 0;
+let done = channel();
+let reader = fn(n, seen) {
+  if (n == 0) { send(done, seen) } else { let last = x; reader(n - 1, seen + 1) }
+};
+spawn(reader, 100, 0);
+spawn(reader, 100, 0);
+` + strings.Repeat("let x = x + 1;\n", 100) + `receive(done) + receive(done) + x`
+
+	testIntegerObject(t, testEval(input), 300)
+
+	// The reader closes over a function's environment and reaches the task
+	// only inside an array, or over a channel.
+	input = `let call = fn(f) { f(100) };
+let run = fn(ch) {
+  let y = 0;
+  let reader = fn(n) { if (n == 0) { 1 } else { let last = y; reader(n - 1) } };
+  let task = spawn(map, [reader, reader], call);
+  send(ch, {"reader": reader});
+` + strings.Repeat("  let y = y + 1;\n", 100) + `  wait(task)
+};
+let ch = channel();
+let received = spawn(fn() { call(receive(ch)["reader"]) });
+run(ch) + [wait(received)]`
+
+	testIntegerArray(t, testEval(input), []int64{1, 1, 1})
+
+	// A generator made by the program is resumed by a spawned function
+	// while the program keeps deferring calls of its own.
+	input = `let gen = fn() { defer len([]); yield 1; yield 2 };
+let g = gen();
+let f = fn(n) { defer len([]); if (n == 0) { 0 } else { f(n - 1) + 1 } };
+let task = spawn(fn() { next(g) + next(g) });
+[f(300), wait(task)]`
+
+	testIntegerArray(t, testEval(input), []int64{300, 3})
+}
+
+func TestSpawnCallsRuntimeBuiltins(t *testing.T) {
+	// Builtins made by memoize, partial and compose call back into the
+	// evaluator of whichever task calls them; run with -race.
+	input := `let fib = memoize(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } });
+let add = partial(fn(a, b) { a + b }, 1);
+let inc = compose(add, fn(x) { x * 2 });
+let work = fn(n) { fib(n) + inc(n) };
+let tasks = map([20, 21, 22, 23], fn(n) { spawn(work, n) });
+map(tasks, wait)`
+
+	testIntegerArray(t, testEval(input), []int64{6806, 10989, 17756, 28704})
+}
+
+func TestConcurrentPackageEval(t *testing.T) {
+	// Each call of the package level Eval has an Evaluator of its own, so
+	// scripts running at the same time neither reseed each other's random
+	// source nor run each other's deferred calls; run with -race.
+	inputs := []string{
+		`seed(7); map([1, 2, 3, 4, 5, 6, 7, 8], fn(x) { rand_int(1000) })`,
+		`let f = fn(n) { let out = [n]; defer len(out); if (n == 0) { out } else { f(n - 1) + out } }; f(20)`,
+	}
+
+	for _, input := range inputs {
+		expected := testEval(input).Inspect()
+
+		results := make([]string, 8)
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = testEval(input).Inspect()
+			}(i)
+		}
+		wg.Wait()
+
+		for i, result := range results {
+			if result != expected {
+				t.Errorf("results[%d] of %q wrong. expected=%s, got=%s", i, input, expected, result)
+			}
+		}
+	}
+}
+
+func TestRunCachesPrograms(t *testing.T) {
+	e := New(CachePrograms(2))
+	env := object.NewEnvironment()
+
+	sources := []string{"let x = 1; x", "x + 1", "let x = 1; x", "x * 10", "x + 1", "let x = 1; x"}
+	expected := []int64{1, 2, 1, 10, 2, 1}
+	for i, source := range sources {
+		result, err := e.Run(source, env)
+		if err != nil {
+			t.Fatalf("Run(%q) returned error: %s", source, err)
+		}
+		testIntegerObject(t, result, expected[i])
+	}
+
+	// The third run is a hit, the fourth evicts "x + 1" and the sixth finds
+	// "let x = 1; x" evicted by the fifth.
+	if e.programs.misses != 5 {
+		t.Errorf("wrong number of parses. expected=5, got=%d", e.programs.misses)
+	}
+
+	if _, err := e.Run("let = 1", env); err == nil || !strings.HasPrefix(err.Error(), "parse error: ") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+	if _, err := e.Run("missing", env); err == nil || err.Error() != "identifier not found: missing" {
+		t.Errorf("expected evaluation error, got %v", err)
+	}
+	if len(e.programs.entries) != 2 || e.programs.order.Len() != 2 {
+		t.Errorf("cache exceeds its size. got %d entries", len(e.programs.entries))
+	}
+
+	if New().programs != nil {
+		t.Errorf("programs are cached without the CachePrograms option")
+	}
+}
@@ -0,0 +1,472 @@
+package evaluator
+
+import (
+	"leopard/object"
+	"sort"
+	"sync"
+)
+
+// functionalBuiltins returns the builtins that take or return functions.
+// They call back into the Evaluator to apply their function arguments.
+func (e *Evaluator) functionalBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"partial": &object.Builtin{
+			Name:        "partial",
+			Description: "Returns a function that calls fn with the given arguments followed by the arguments it is called with.",
+			MinArgs:     1,
+			MaxArgs:     -1,
+			Fn: func(args ...object.Object) object.Object {
+				if !isCallable(args[0]) {
+					return newCodedError(object.TYPE_ERROR, "first argument to `partial` must be FUNCTION or BUILTIN, got %s", args[0].Type())
+				}
+
+				fn := args[0]
+				bound := args[1:]
+
+				return &object.Builtin{
+					CallbackFn: func(apply func(object.Object, []object.Object) object.Object, args ...object.Object) object.Object {
+						allArgs := make([]object.Object, 0, len(bound)+len(args))
+						allArgs = append(allArgs, bound...)
+						allArgs = append(allArgs, args...)
+
+						return apply(fn, allArgs)
+					},
+				}
+			},
+		},
+
+		"map": &object.Builtin{
+			Name:        "map",
+			Description: "Returns a new array with fn applied to each element.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			Fn: func(args ...object.Object) object.Object {
+				if err := checkArrayAndCallableArgs("map", args); err != nil {
+					return err
+				}
+
+				arr := args[0].(*object.Array)
+				elements := make([]object.Object, len(arr.Elements))
+				for i, el := range arr.Elements {
+					result := e.applyFunction(args[1], []object.Object{el})
+					if isError(result) {
+						return result
+					}
+					elements[i] = result
+				}
+
+				return &object.Array{Elements: elements}
+			},
+		},
+
+		"filter": &object.Builtin{
+			Name:        "filter",
+			Description: "Returns a new array with the elements for which fn is truthy.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			Fn: func(args ...object.Object) object.Object {
+				if err := checkArrayAndCallableArgs("filter", args); err != nil {
+					return err
+				}
+
+				arr := args[0].(*object.Array)
+				elements := []object.Object{}
+				for _, el := range arr.Elements {
+					result := e.applyFunction(args[1], []object.Object{el})
+					if isError(result) {
+						return result
+					}
+					if e.isTruthy(result) {
+						elements = append(elements, el)
+					}
+				}
+
+				return &object.Array{Elements: elements}
+			},
+		},
+
+		"flat_map": &object.Builtin{
+			Name:        "flat_map",
+			Description: "Returns a new array with the elements of the arrays fn returns for each element, in order. It is an error for fn to return anything but an array.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}, {object.FUNCTION_OBJ, object.BUILTIN_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				elements := []object.Object{}
+				for _, el := range args[0].(*object.Array).Elements {
+					result := e.applyFunction(args[1], []object.Object{el})
+					if isError(result) {
+						return result
+					}
+
+					arr, ok := result.(*object.Array)
+					if !ok {
+						return newCodedError(object.TYPE_ERROR, "function passed to `flat_map` must return ARRAY, got %s", result.Type())
+					}
+					elements = append(elements, arr.Elements...)
+				}
+
+				return &object.Array{Elements: elements}
+			},
+		},
+
+		"count": &object.Builtin{
+			Name:        "count",
+			Description: "Returns the number of elements of the array for which fn is truthy, or the length of the array when fn is omitted.",
+			MinArgs:     1,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}, {object.FUNCTION_OBJ, object.BUILTIN_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				elements := args[0].(*object.Array).Elements
+				if len(args) == 1 {
+					return newInteger(int64(len(elements)))
+				}
+
+				count := 0
+				for _, el := range elements {
+					result := e.applyFunction(args[1], []object.Object{el})
+					if isError(result) {
+						return result
+					}
+					if e.isTruthy(result) {
+						count++
+					}
+				}
+
+				return newInteger(int64(count))
+			},
+		},
+
+		"take_while": &object.Builtin{
+			Name:        "take_while",
+			Description: "Returns a new array with the leading elements of the array for which fn is truthy, stopping at the first for which it is not.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}, {object.FUNCTION_OBJ, object.BUILTIN_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				elements := args[0].(*object.Array).Elements
+				n, err := e.leadingRun(elements, args[1])
+				if err != nil {
+					return err
+				}
+
+				return &object.Array{Elements: copyElements(elements[:n])}
+			},
+		},
+
+		"drop_while": &object.Builtin{
+			Name:        "drop_while",
+			Description: "Returns a new array without the leading elements of the array for which fn is truthy, starting at the first for which it is not.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}, {object.FUNCTION_OBJ, object.BUILTIN_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				elements := args[0].(*object.Array).Elements
+				n, err := e.leadingRun(elements, args[1])
+				if err != nil {
+					return err
+				}
+
+				return &object.Array{Elements: copyElements(elements[n:])}
+			},
+		},
+
+		"reduce": &object.Builtin{
+			Name:        "reduce",
+			Description: "Combines the elements of the array from left to right, starting from initial, by calling fn(acc, el) and returns the final accumulator.",
+			MinArgs:     3,
+			MaxArgs:     3,
+			ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}, {object.ANY_OBJ}, {object.FUNCTION_OBJ, object.BUILTIN_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				steps := e.accumulate(args[0].(*object.Array), args[1], args[2])
+				return steps[len(steps)-1]
+			},
+		},
+
+		"scan": &object.Builtin{
+			Name:        "scan",
+			Description: "Like reduce, but returns an array of every accumulator value, starting with initial.",
+			MinArgs:     3,
+			MaxArgs:     3,
+			ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}, {object.ANY_OBJ}, {object.FUNCTION_OBJ, object.BUILTIN_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				steps := e.accumulate(args[0].(*object.Array), args[1], args[2])
+				if last := steps[len(steps)-1]; isError(last) {
+					return last
+				}
+
+				return &object.Array{Elements: steps}
+			},
+		},
+
+		"each": &object.Builtin{
+			Name:        "each",
+			Description: "Calls fn with each element of the array in order and returns null. It stops at the first error fn returns.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}, {object.FUNCTION_OBJ, object.BUILTIN_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				for _, el := range args[0].(*object.Array).Elements {
+					result := e.applyFunction(args[1], []object.Object{el})
+					if isError(result) {
+						return result
+					}
+				}
+
+				return NULL
+			},
+		},
+
+		"sort": &object.Builtin{
+			Name:        "sort",
+			Description: "Returns a new array with the elements in ascending order. Without a comparison function the elements must all be numbers or all be strings. With one, less(a, b) must be truthy when a sorts before b. The sort is stable.",
+			MinArgs:     1,
+			MaxArgs:     2,
+			Fn: func(args ...object.Object) object.Object {
+				if args[0].Type() != object.ARRAY_OBJ {
+					return newCodedError(object.TYPE_ERROR, "first argument to `sort` must be ARRAY, got %s", args[0].Type())
+				}
+				if len(args) == 2 && !isCallable(args[1]) {
+					return newCodedError(object.TYPE_ERROR, "second argument to `sort` must be FUNCTION or BUILTIN, got %s", args[1].Type())
+				}
+
+				arr := args[0].(*object.Array)
+				elements := make([]object.Object, len(arr.Elements))
+				copy(elements, arr.Elements)
+
+				var less func(a, b object.Object) object.Object
+				if len(args) == 2 {
+					less = func(a, b object.Object) object.Object {
+						return e.applyFunction(args[1], []object.Object{a, b})
+					}
+				} else {
+					less = naturalLess
+				}
+
+				var err object.Object
+				sort.SliceStable(elements, func(i, j int) bool {
+					if err != nil {
+						return false
+					}
+					result := less(elements[i], elements[j])
+					if isError(result) {
+						err = result
+						return false
+					}
+					return e.isTruthy(result)
+				})
+				if err != nil {
+					return err
+				}
+
+				return &object.Array{Elements: elements}
+			},
+		},
+
+		"compose": &object.Builtin{
+			Name:        "compose",
+			Description: "Returns a function applying the given functions from right to left, so compose(f, g)(x) is f(g(x)).",
+			MinArgs:     1,
+			MaxArgs:     -1,
+			ArgTypes:    [][]object.ObjectType{{object.FUNCTION_OBJ, object.BUILTIN_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				fns := make([]object.Object, len(args))
+				for i, fn := range args {
+					fns[len(args)-1-i] = fn
+				}
+
+				return chain(fns)
+			},
+		},
+
+		"pipe": &object.Builtin{
+			Name:        "pipe",
+			Description: "Returns a function applying the given functions from left to right, so pipe(f, g)(x) is g(f(x)).",
+			MinArgs:     1,
+			MaxArgs:     -1,
+			ArgTypes:    [][]object.ObjectType{{object.FUNCTION_OBJ, object.BUILTIN_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				fns := make([]object.Object, len(args))
+				copy(fns, args)
+
+				return chain(fns)
+			},
+		},
+
+		"memoize": &object.Builtin{
+			Name:        "memoize",
+			Description: "Returns a function that caches the results of fn by its arguments. Calls with function arguments are not cached.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			Fn: func(args ...object.Object) object.Object {
+				if !isCallable(args[0]) {
+					return newCodedError(object.TYPE_ERROR, "argument to `memoize` must be FUNCTION or BUILTIN, got %s", args[0].Type())
+				}
+
+				fn := args[0]
+				cache := newMemoCache()
+
+				return &object.Builtin{
+					CallbackFn: func(apply func(object.Object, []object.Object) object.Object, args ...object.Object) object.Object {
+						key, ok := memoKey(args)
+						if !ok {
+							return apply(fn, args)
+						}
+						if result, ok := cache.get(key, args); ok {
+							return result
+						}
+
+						result := apply(fn, args)
+						if !isError(result) {
+							cache.put(key, args, result)
+						}
+						return result
+					},
+				}
+			},
+		},
+	}
+}
+
+// memoKey returns a cache key identifying args by their contents, or false
+// if any argument contains a function.
+func memoKey(args []object.Object) (uint64, bool) {
+	return object.HashAll(&object.Array{Elements: args})
+}
+
+// memoEntry is a call cached by memoize.
+type memoEntry struct {
+	args   []object.Object
+	result object.Object
+}
+
+// memoCache holds the results of a memoized function. Calls are found by
+// their memoKey and then compared argument by argument, so arguments whose
+// hashes collide do not share a result. It is safe for concurrent use, as
+// spawned functions may call the same memoized function.
+type memoCache struct {
+	mu      sync.Mutex
+	entries map[uint64][]memoEntry
+}
+
+func newMemoCache() *memoCache {
+	return &memoCache{entries: make(map[uint64][]memoEntry)}
+}
+
+func (c *memoCache) get(key uint64, args []object.Object) (object.Object, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, entry := range c.entries[key] {
+		if argsEqual(entry.args, args) {
+			return entry.result, true
+		}
+	}
+	return nil, false
+}
+
+func (c *memoCache) put(key uint64, args []object.Object, result object.Object) {
+	stored := make([]object.Object, len(args))
+	copy(stored, args)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = append(c.entries[key], memoEntry{args: stored, result: result})
+}
+
+// argsEqual reports whether two argument lists hold equal values.
+func argsEqual(a, b []object.Object) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !objectsEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// leadingRun returns the number of leading elements for which fn is truthy.
+// It does not call fn on any element after the first for which it is not.
+func (e *Evaluator) leadingRun(elements []object.Object, fn object.Object) (int, object.Object) {
+	for i, el := range elements {
+		result := e.applyFunction(fn, []object.Object{el})
+		if isError(result) {
+			return 0, result
+		}
+		if !e.isTruthy(result) {
+			return i, nil
+		}
+	}
+
+	return len(elements), nil
+}
+
+// accumulate applies fn to the accumulator and each element of arr in turn,
+// starting from initial, and returns every accumulator value. If fn returns
+// an error, it is the last value returned.
+func (e *Evaluator) accumulate(arr *object.Array, initial, fn object.Object) []object.Object {
+	steps := make([]object.Object, 1, len(arr.Elements)+1)
+	steps[0] = initial
+
+	acc := initial
+	for _, el := range arr.Elements {
+		acc = e.applyFunction(fn, []object.Object{acc, el})
+		steps = append(steps, acc)
+		if isError(acc) {
+			break
+		}
+	}
+
+	return steps
+}
+
+// chain returns a builtin that applies the first function to its arguments
+// and then each following function to the result of the previous one.
+func chain(fns []object.Object) *object.Builtin {
+	return &object.Builtin{
+		CallbackFn: func(apply func(object.Object, []object.Object) object.Object, args ...object.Object) object.Object {
+			result := apply(fns[0], args)
+
+			for _, fn := range fns[1:] {
+				if isError(result) {
+					return result
+				}
+				result = apply(fn, []object.Object{result})
+			}
+
+			return result
+		},
+	}
+}
+
+// naturalLess compares two numbers or two strings in their natural order.
+func naturalLess(a, b object.Object) object.Object {
+	switch {
+	case isNumber(a) && isNumber(b):
+		return nativeBoolToBooleanObject(toFloat(a) < toFloat(b))
+	case a.Type() == object.STRING_OBJ && b.Type() == object.STRING_OBJ:
+		return nativeBoolToBooleanObject(a.(*object.String).Value < b.(*object.String).Value)
+	default:
+		return newCodedError(object.TYPE_ERROR, "cannot compare %s with %s", a.Type(), b.Type())
+	}
+}
+
+// checkArrayAndCallableArgs returns an error unless the arguments are an
+// array followed by a callable.
+func checkArrayAndCallableArgs(name string, args []object.Object) *object.Error {
+	if args[0].Type() != object.ARRAY_OBJ {
+		return newCodedError(object.TYPE_ERROR, "first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newCodedError(object.TYPE_ERROR, "second argument to `%s` must be FUNCTION or BUILTIN, got %s", name, args[1].Type())
+	}
+
+	return nil
+}
+
+// isCallable checks whether the given object can be applied to arguments.
+func isCallable(obj object.Object) bool {
+	return obj.Type() == object.FUNCTION_OBJ || obj.Type() == object.BUILTIN_OBJ
+}
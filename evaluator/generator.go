@@ -0,0 +1,185 @@
+package evaluator
+
+import (
+	"leopard/ast"
+	"leopard/object"
+)
+
+// maxGeneratorBodies is how many function bodies isGenerator remembers.
+const maxGeneratorBodies = 1024
+
+// errGeneratorStopped unwinds the body of a generator that was stopped
+// while it waited at a yield.
+var errGeneratorStopped = &object.Error{Message: "generator stopped"}
+
+// generator is the state of a running generator call. Its body runs on its
+// own goroutine, but only while the caller waits in next or stop, so the
+// two never run at the same time. A generator that is abandoned before it
+// returns leaves its goroutine blocked until it is stopped; for-in loops
+// stop the generators they leave early.
+type generator struct {
+	resume chan struct{}
+	yield  chan object.Object
+	stop   chan struct{}
+	done   bool
+}
+
+// generatorBuiltins returns the builtins that drive generators.
+func (e *Evaluator) generatorBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"next": &object.Builtin{
+			Name:        "next",
+			Description: "Resumes a generator and returns the next value it yields, or null once it has returned. An error in the generator is returned once, after which it is exhausted.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.GENERATOR_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				val, ok := args[0].(*object.Generator).Next()
+				if !ok {
+					return NULL
+				}
+
+				return val
+			},
+		},
+	}
+}
+
+// newGenerator returns a generator for a call of fn with args. The body does
+// not start running until the first value is requested. It runs in an
+// Evaluator of its own, forked from e but keeping its profile, coverage and
+// tracer, so that the generator can be resumed from any spawned function
+// without touching the call frames of e. For the same reason the
+// environment the body runs in is shared.
+func (e *Evaluator) newGenerator(fn *object.Function, args []object.Object) *object.Generator {
+	g := &generator{
+		resume: make(chan struct{}),
+		yield:  make(chan object.Object),
+		stop:   make(chan struct{}),
+	}
+	started := false
+
+	body := e.fork()
+	body.profile, body.coverage, body.tracer = e.profile, e.coverage, e.tracer
+	body.generator = g
+	fn.Env.Share()
+
+	next := func() (object.Object, bool) {
+		if g.done {
+			return nil, false
+		}
+		if !started {
+			started = true
+			go body.runGenerator(g, fn, args)
+		}
+
+		g.resume <- struct{}{}
+		val, ok := <-g.yield
+		if !ok {
+			g.done = true
+			return nil, false
+		}
+		return val, true
+	}
+
+	// stop unwinds the body from the yield it waits at, running its
+	// deferred functions.
+	stop := func() {
+		if g.done {
+			return
+		}
+		g.done = true
+		if !started {
+			return
+		}
+
+		close(g.stop)
+		for range g.yield {
+		}
+	}
+
+	return &object.Generator{Next: next, Stop: stop}
+}
+
+// runGenerator evaluates the body of a generator call once it is first
+// resumed. When the body returns, the yield channel is closed; an error is
+// yielded first so that it reaches the caller.
+func (e *Evaluator) runGenerator(g *generator, fn *object.Function, args []object.Object) {
+	defer close(g.yield)
+
+	<-g.resume
+
+	e.frames = append(e.frames, &frame{})
+	result := e.runDeferred(unwrapReturnValue(e.Eval(fn.Body, extendFunctionEnv(fn, args))))
+	if isError(result) && result != errGeneratorStopped {
+		select {
+		case g.yield <- result:
+			g.wait()
+		case <-g.stop:
+		}
+	}
+}
+
+// wait blocks until the generator is resumed or stopped, and reports
+// whether it was resumed.
+func (g *generator) wait() bool {
+	select {
+	case <-g.resume:
+		return true
+	case <-g.stop:
+		return false
+	}
+}
+
+// evalYieldStatement hands the value to the caller of the current generator
+// and waits until the generator is resumed.
+func (e *Evaluator) evalYieldStatement(node *ast.YieldStatement, env *object.Environment) object.Object {
+	if e.generator == nil {
+		return newError("yield outside generator function")
+	}
+
+	val := e.Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	g := e.generator
+	select {
+	case g.yield <- val:
+	case <-g.stop:
+		return errGeneratorStopped
+	}
+	if !g.wait() {
+		return errGeneratorStopped
+	}
+
+	return nil
+}
+
+// isGenerator reports whether fn is a generator function, that is whether
+// its body contains a yield outside of any nested function. The answer is
+// remembered per function literal, by its body. Once maxGeneratorBodies
+// are remembered they are all forgotten, so programs that are no longer
+// run are not kept alive.
+func (e *Evaluator) isGenerator(fn *object.Function) bool {
+	if result, ok := e.generatorBodies[fn.Body]; ok {
+		return result
+	}
+
+	found := false
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.YieldStatement:
+			found = true
+		case *ast.FunctionLiteral, *ast.FunctionStatement:
+			return false
+		}
+		return !found
+	})
+	if len(e.generatorBodies) >= maxGeneratorBodies {
+		clear(e.generatorBodies)
+	}
+	e.generatorBodies[fn.Body] = found
+
+	return found
+}
@@ -0,0 +1,112 @@
+package evaluator
+
+import (
+	"fmt"
+	"leopard/object"
+	"sort"
+	"strings"
+)
+
+// helpBuiltins returns the builtins that describe the other builtins
+// registered with the Evaluator. They write to the Evaluator's output.
+func (e *Evaluator) helpBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"help": &object.Builtin{
+			Name:        "help",
+			Description: "Prints the available builtins with their arity and a short description, or the full description of the named builtin.",
+			MinArgs:     0,
+			MaxArgs:     1,
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) == 0 {
+					e.listBuiltins()
+					return NULL
+				}
+
+				if args[0].Type() != object.STRING_OBJ {
+					return newCodedError(object.TYPE_ERROR, "argument to `help` must be STRING, got %s", args[0].Type())
+				}
+
+				name := args[0].(*object.String).Value
+				builtin, ok := e.builtin(name)
+				if !ok {
+					err := newCodedError(object.NAME_ERROR, "no builtin named `%s`", name)
+					err.Data = errorData(map[string]string{"name": name})
+					return err
+				}
+
+				fmt.Fprintf(e.out, "%s: takes %s\n", name, arityText(builtin))
+				if builtin.Description != "" {
+					fmt.Fprintln(e.out, builtin.Description)
+				}
+
+				return NULL
+			},
+		},
+	}
+}
+
+// listBuiltins writes one line per builtin with its name, arity and the
+// first sentence of its description.
+func (e *Evaluator) listBuiltins() {
+	names := e.builtinNames()
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		builtin, _ := e.builtin(name)
+		line := fmt.Sprintf("%-*s  %-4s  %s", width, name, arity(builtin), summary(builtin.Description))
+		fmt.Fprintln(e.out, strings.TrimRight(line, " "))
+	}
+}
+
+// arity returns a compact form of the number of arguments a builtin takes,
+// such as "1", "1-2" or "1+".
+func arity(b *object.Builtin) string {
+	switch {
+	case b.MaxArgs < 0:
+		return fmt.Sprintf("%d+", b.MinArgs)
+	case b.MinArgs == b.MaxArgs:
+		return fmt.Sprintf("%d", b.MinArgs)
+	default:
+		return fmt.Sprintf("%d-%d", b.MinArgs, b.MaxArgs)
+	}
+}
+
+// arityText spells out the number of arguments a builtin takes.
+func arityText(b *object.Builtin) string {
+	switch {
+	case b.MaxArgs < 0 && b.MinArgs == 0:
+		return "any number of arguments"
+	case b.MaxArgs < 0:
+		return fmt.Sprintf("at least %s", pluralArguments(b.MinArgs))
+	case b.MinArgs == b.MaxArgs:
+		return pluralArguments(b.MinArgs)
+	case b.MaxArgs == b.MinArgs+1:
+		return fmt.Sprintf("%d or %s", b.MinArgs, pluralArguments(b.MaxArgs))
+	default:
+		return fmt.Sprintf("%d to %s", b.MinArgs, pluralArguments(b.MaxArgs))
+	}
+}
+
+// pluralArguments returns n followed by "argument" or "arguments".
+func pluralArguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// summary returns the first sentence of a description.
+func summary(description string) string {
+	if i := strings.Index(description, ". "); i >= 0 {
+		return description[:i+1]
+	}
+
+	return description
+}
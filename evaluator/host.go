@@ -0,0 +1,203 @@
+package evaluator
+
+import (
+	"bufio"
+	"io"
+	"leopard/object"
+	"os"
+	"strings"
+)
+
+// hostBuiltins returns the builtins that reach outside the interpreter into
+// the host process, such as the file system and environment variables.
+// A sandboxed Evaluator replaces each of them with sandboxedBuiltin.
+func hostBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"env": &object.Builtin{
+			Name:        "env",
+			Description: "Returns the value of an environment variable, or the given default (null when omitted) if the variable is unset.",
+			MinArgs:     1,
+			MaxArgs:     2,
+			Fn: func(args ...object.Object) object.Object {
+				if args[0].Type() != object.STRING_OBJ {
+					return newCodedError(object.TYPE_ERROR, "argument to `env` must be STRING, got %s", args[0].Type())
+				}
+
+				value, ok := os.LookupEnv(args[0].(*object.String).Value)
+				if ok {
+					return &object.String{Value: value}
+				}
+				if len(args) == 2 {
+					return args[1]
+				}
+
+				return NULL
+			},
+		},
+
+		"read_file": &object.Builtin{
+			Name:        "read_file",
+			Description: "Returns the contents of the file at the given path.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			Fn: func(args ...object.Object) object.Object {
+				if args[0].Type() != object.STRING_OBJ {
+					return newCodedError(object.TYPE_ERROR, "argument to `read_file` must be STRING, got %s", args[0].Type())
+				}
+
+				content, err := os.ReadFile(args[0].(*object.String).Value)
+				if err != nil {
+					return newError("could not read file: %s", err)
+				}
+
+				return &object.String{Value: string(content)}
+			},
+		},
+
+		"write_file": &object.Builtin{
+			Name:        "write_file",
+			Description: "Replaces the contents of the file at the given path.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			Fn: func(args ...object.Object) object.Object {
+				if args[0].Type() != object.STRING_OBJ {
+					return newCodedError(object.TYPE_ERROR, "first argument to `write_file` must be STRING, got %s", args[0].Type())
+				}
+				if args[1].Type() != object.STRING_OBJ {
+					return newCodedError(object.TYPE_ERROR, "second argument to `write_file` must be STRING, got %s", args[1].Type())
+				}
+
+				path := args[0].(*object.String).Value
+				content := args[1].(*object.String).Value
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					return newError("could not write file: %s", err)
+				}
+
+				return NULL
+			},
+		},
+
+		"open": &object.Builtin{
+			Name:        "open",
+			Description: "Opens the file at the given path for reading (\"r\"), writing (\"w\"), which truncates it, or appending (\"a\"), and returns a file to pass to read_line, write and close.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.STRING_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				path := args[0].(*object.String).Value
+				mode := args[1].(*object.String).Value
+
+				flags, ok := fileModes[mode]
+				if !ok {
+					return newCodedError(object.RANGE_ERROR, "argument 2 to `open` must be \"r\", \"w\" or \"a\", got %q", mode)
+				}
+
+				f, err := os.OpenFile(path, flags, 0644)
+				if err != nil {
+					return newError("could not open file: %s", err)
+				}
+
+				file := &object.File{Path: path, File: f}
+				if mode == "r" {
+					file.Reader = bufio.NewReader(f)
+				}
+
+				return file
+			},
+		},
+
+		"read_line": &object.Builtin{
+			Name:        "read_line",
+			Description: "Returns the next line of a file opened for reading without its line ending, or null at the end of the file.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.FILE_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				file := args[0].(*object.File)
+				if file.Closed {
+					return newError("file %s is closed", file.Path)
+				}
+				if file.Reader == nil {
+					return newError("file %s is not open for reading", file.Path)
+				}
+
+				line, err := file.Reader.ReadString('\n')
+				if err == io.EOF && line == "" {
+					return NULL
+				}
+				if err != nil && err != io.EOF {
+					return newError("could not read file: %s", err)
+				}
+
+				line = strings.TrimSuffix(line, "\n")
+				line = strings.TrimSuffix(line, "\r")
+
+				return &object.String{Value: line}
+			},
+		},
+
+		"write": &object.Builtin{
+			Name:        "write",
+			Description: "Writes the string to a file opened for writing or appending.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.FILE_OBJ}, {object.STRING_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				file := args[0].(*object.File)
+				if file.Closed {
+					return newError("file %s is closed", file.Path)
+				}
+				if file.Reader != nil {
+					return newError("file %s is not open for writing", file.Path)
+				}
+
+				if _, err := file.File.WriteString(args[1].(*object.String).Value); err != nil {
+					return newError("could not write file: %s", err)
+				}
+
+				return NULL
+			},
+		},
+
+		"close": &object.Builtin{
+			Name:        "close",
+			Description: "Closes a file. Closing a file twice is an error.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.FILE_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				file := args[0].(*object.File)
+				if file.Closed {
+					return newError("file %s is already closed", file.Path)
+				}
+
+				file.Closed = true
+				if err := file.File.Close(); err != nil {
+					return newError("could not close file: %s", err)
+				}
+
+				return NULL
+			},
+		},
+	}
+}
+
+// fileModes maps the modes accepted by `open` to the flags they open a file
+// with.
+var fileModes = map[string]int{
+	"r": os.O_RDONLY,
+	"w": os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+	"a": os.O_WRONLY | os.O_CREATE | os.O_APPEND,
+}
+
+// sandboxedBuiltin returns a stand-in for the given host builtin that
+// always fails, so sandboxed scripts get a clear error instead of an
+// unknown identifier. The stand-in keeps the builtin's description.
+func sandboxedBuiltin(builtin *object.Builtin) *object.Builtin {
+	stub := *builtin
+	stub.Fn = func(args ...object.Object) object.Object {
+		return newError("operation not permitted in sandbox: `%s`", builtin.Name)
+	}
+
+	return &stub
+}
@@ -0,0 +1,141 @@
+package evaluator
+
+import (
+	"leopard/ast"
+	"leopard/object"
+	"sort"
+)
+
+// The signals of break and continue statements.
+var (
+	BREAK    = &object.LoopControl{}
+	CONTINUE = &object.LoopControl{Continue: true}
+)
+
+// evalForInStatement runs the body of a for-in loop once for each element
+// of the iterable, in an environment of its own in which the loop variables
+// are bound. Closures created by the body therefore see the element of their
+// own iteration. A single variable is bound to the element, or to the key
+// when iterating over a hash; with two, the first is bound to the key or
+// index and the second to the element. A generator is stopped when the
+// loop is left before it is exhausted. The loop has no value.
+func (e *Evaluator) evalForInStatement(node *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := e.Eval(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	if gen, ok := iterable.(*object.Generator); ok {
+		defer gen.Stop()
+	}
+
+	next, err := iterate(iterable)
+	if err != nil {
+		return err
+	}
+
+	for {
+		key, value, ok := next()
+		if !ok {
+			return nil
+		}
+		if isError(value) {
+			return value
+		}
+
+		loopEnv := object.NewEnclosedEnvironment(env)
+		switch {
+		case node.Key != nil:
+			bind(loopEnv, node.Key.Value, key)
+			bind(loopEnv, node.Variable.Value, value)
+		case iterable.Type() == object.HASH_OBJ:
+			bind(loopEnv, node.Variable.Value, key)
+		default:
+			bind(loopEnv, node.Variable.Value, value)
+		}
+
+		result := e.evalBlockStatement(node.Body, loopEnv)
+		switch result := result.(type) {
+		case *object.ReturnValue, *object.Error:
+			return result
+		case *object.LoopControl:
+			if !result.Continue {
+				return nil
+			}
+		}
+	}
+}
+
+// iterate returns a function that steps through the elements of obj,
+// returning each with its key, or false once there are none left. Hashes
+// are keyed by their keys, in order as for `entries`. Everything else is
+// keyed by a 0-based index: strings step through their characters rather
+// than their bytes, sets through their elements in sorted order, and
+// generators through the values they yield, resuming them lazily.
+func iterate(obj object.Object) (func() (object.Object, object.Object, bool), *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Array:
+		return iterateSlice(obj.Elements), nil
+
+	case *object.String:
+		runes := []rune(obj.Value)
+		elements := make([]object.Object, len(runes))
+		for i, r := range runes {
+			elements[i] = &object.String{Value: string(r)}
+		}
+		return iterateSlice(elements), nil
+
+	case *object.Hash:
+		pairs := make([]object.HashPair, 0, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, pair)
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			return keyLess(pairs[i].Key, pairs[j].Key)
+		})
+
+		i := 0
+		return func() (object.Object, object.Object, bool) {
+			if i >= len(pairs) {
+				return nil, nil, false
+			}
+			i++
+			return pairs[i-1].Key, pairs[i-1].Value, true
+		}, nil
+
+	case *object.Set:
+		elements := make([]object.Object, 0, len(obj.Elements))
+		for _, el := range obj.Elements {
+			elements = append(elements, el)
+		}
+		sort.Slice(elements, func(i, j int) bool {
+			return keyLess(elements[i], elements[j])
+		})
+		return iterateSlice(elements), nil
+
+	case *object.Generator:
+		var i int64
+		return func() (object.Object, object.Object, bool) {
+			val, ok := obj.Next()
+			if !ok {
+				return nil, nil, false
+			}
+			i++
+			return newInteger(i - 1), val, true
+		}, nil
+
+	default:
+		return nil, newCodedError(object.TYPE_ERROR, "cannot iterate over %s", obj.Type())
+	}
+}
+
+// iterateSlice steps through elements, keyed by their index.
+func iterateSlice(elements []object.Object) func() (object.Object, object.Object, bool) {
+	i := 0
+	return func() (object.Object, object.Object, bool) {
+		if i >= len(elements) {
+			return nil, nil, false
+		}
+		i++
+		return newInteger(int64(i - 1)), elements[i-1], true
+	}
+}
@@ -0,0 +1,59 @@
+package evaluator
+
+import (
+	"leopard/object"
+	"math"
+)
+
+// namespaces maps the names of built-in namespaces to the hashes holding
+// their members. Namespaces are resolved after the environment and builtins,
+// so a script can shadow them with its own bindings.
+var namespaces = map[string]*object.Hash{
+	"math": newNamespace(map[string]object.Object{
+		"pi":    &object.Float{Value: math.Pi},
+		"e":     &object.Float{Value: math.E},
+		"sqrt":  mathFunction("sqrt", "Returns the square root of x.", math.Sqrt),
+		"sin":   mathFunction("sin", "Returns the sine of x in radians.", math.Sin),
+		"cos":   mathFunction("cos", "Returns the cosine of x in radians.", math.Cos),
+		"floor": mathFunction("floor", "Returns the greatest integer value less than or equal to x.", math.Floor),
+		"ceil":  mathFunction("ceil", "Returns the least integer value greater than or equal to x.", math.Ceil),
+		"round": mathFunction("round", "Returns x rounded to the nearest integer, rounding half away from zero.", math.Round),
+	}),
+}
+
+// newNamespace builds a hash with string keys from the given members.
+func newNamespace(members map[string]object.Object) *object.Hash {
+	pairs := make(map[object.HashKey]object.HashPair, len(members))
+
+	for name, member := range members {
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: member}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// mathFunction wraps a unary function from Go's math package as a builtin.
+// The argument may be an integer or a float and the result is always a float.
+// Results that fall outside the real numbers, such as the square root of a
+// negative number, are reported as errors rather than NaN.
+func mathFunction(name, description string, fn func(float64) float64) *object.Builtin {
+	return &object.Builtin{
+		Name:        "math." + name,
+		Description: description,
+		MinArgs:     1,
+		MaxArgs:     1,
+		Fn: func(args ...object.Object) object.Object {
+			if !isNumber(args[0]) {
+				return newCodedError(object.TYPE_ERROR, "argument to `%s` must be INTEGER or FLOAT, got %s", name, args[0].Type())
+			}
+
+			result := fn(toFloat(args[0]))
+			if math.IsNaN(result) {
+				return newCodedError(object.RANGE_ERROR, "argument to `%s` out of domain, got %s", name, args[0].Inspect())
+			}
+
+			return &object.Float{Value: result}
+		},
+	}
+}
@@ -0,0 +1,86 @@
+package evaluator
+
+import (
+	"bytes"
+	"fmt"
+	"leopard/ast"
+	"leopard/object"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profile records how often each kind of AST node was evaluated and how long
+// evaluation took. Durations per node kind exclude the time spent evaluating
+// child nodes, so they add up to Total.
+type Profile struct {
+	Counts    map[string]int
+	Durations map[string]time.Duration
+	Total     time.Duration
+
+	depth    int
+	children time.Duration
+}
+
+// Profiling makes the Evaluator record a Profile of everything it evaluates,
+// available from Profile. Without it evaluation carries no profiling cost.
+func Profiling() Option {
+	return func(e *Evaluator) {
+		e.profile = &Profile{
+			Counts:    make(map[string]int),
+			Durations: make(map[string]time.Duration),
+		}
+	}
+}
+
+// Profile returns the profile collected so far, or nil if the Evaluator was
+// not created with the Profiling option.
+func (e *Evaluator) Profile() *Profile {
+	return e.profile
+}
+
+// evalProfiled evaluates node while recording its kind and duration.
+func (e *Evaluator) evalProfiled(node ast.Node, env *object.Environment) object.Object {
+	p := e.profile
+	outer := p.children
+	p.children = 0
+	start := e.now()
+
+	p.depth++
+	result := e.eval(node, env)
+	p.depth--
+
+	elapsed := e.now().Sub(start)
+	kind := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	p.Counts[kind]++
+	p.Durations[kind] += elapsed - p.children
+	p.children = outer + elapsed
+	if p.depth == 0 {
+		p.Total += elapsed
+	}
+
+	return result
+}
+
+// String formats the profile as a table sorted by descending count.
+func (p *Profile) String() string {
+	var out bytes.Buffer
+
+	kinds := make([]string, 0, len(p.Counts))
+	for kind := range p.Counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if p.Counts[kinds[i]] != p.Counts[kinds[j]] {
+			return p.Counts[kinds[i]] > p.Counts[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+
+	for _, kind := range kinds {
+		fmt.Fprintf(&out, "%-20s %8d %12s\n", kind, p.Counts[kind], p.Durations[kind])
+	}
+	fmt.Fprintf(&out, "%-20s %8s %12s\n", "total", "", p.Total)
+
+	return out.String()
+}
@@ -0,0 +1,101 @@
+package evaluator
+
+import "leopard/object"
+
+// randomBuiltins returns the builtins backed by the Evaluator's random source.
+// Seeding affects only this Evaluator, so separate interpreters can draw
+// reproducible sequences independently of each other.
+func (e *Evaluator) randomBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"rand": &object.Builtin{
+			Name:        "rand",
+			Description: "Returns a random float in the range [0, 1).",
+			MinArgs:     0,
+			MaxArgs:     0,
+			Fn: func(args ...object.Object) object.Object {
+				return &object.Float{Value: e.rand.Float64()}
+			},
+		},
+
+		"rand_int": &object.Builtin{
+			Name:        "rand_int",
+			Description: "Returns a random integer in the range [0, n).",
+			MinArgs:     1,
+			MaxArgs:     1,
+			Fn: func(args ...object.Object) object.Object {
+				if args[0].Type() != object.INTEGER_OBJ {
+					return newCodedError(object.TYPE_ERROR, "argument to `rand_int` must be INTEGER, got %s", args[0].Type())
+				}
+
+				n := args[0].(*object.Integer).Value
+				if n <= 0 {
+					return newCodedError(object.RANGE_ERROR, "argument to `rand_int` must be positive, got %d", n)
+				}
+
+				return newInteger(e.rand.Int63n(n))
+			},
+		},
+
+		"seed": &object.Builtin{
+			Name:        "seed",
+			Description: "Reseeds the random source so subsequent draws are reproducible.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			Fn: func(args ...object.Object) object.Object {
+				if args[0].Type() != object.INTEGER_OBJ {
+					return newCodedError(object.TYPE_ERROR, "argument to `seed` must be INTEGER, got %s", args[0].Type())
+				}
+
+				e.rand.Seed(args[0].(*object.Integer).Value)
+
+				return NULL
+			},
+		},
+
+		"shuffle": &object.Builtin{
+			Name:        "shuffle",
+			Description: "Returns a new array with the elements of the array in random order.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				elements := copyElements(args[0].(*object.Array).Elements)
+				e.rand.Shuffle(len(elements), func(i, j int) {
+					elements[i], elements[j] = elements[j], elements[i]
+				})
+
+				return &object.Array{Elements: elements}
+			},
+		},
+
+		"sample": &object.Builtin{
+			Name:        "sample",
+			Description: "Returns a random element of the array, or with n a new array of n elements at distinct random positions.",
+			MinArgs:     1,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.ARRAY_OBJ}, {object.INTEGER_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				elements := args[0].(*object.Array).Elements
+				if len(args) == 1 {
+					if len(elements) == 0 {
+						return newCodedError(object.RANGE_ERROR, "cannot sample from an empty array")
+					}
+
+					return elements[e.rand.Intn(len(elements))]
+				}
+
+				n := args[1].(*object.Integer).Value
+				if n < 0 || n > int64(len(elements)) {
+					return newCodedError(object.RANGE_ERROR, "argument 2 to `sample` must be between 0 and %d, got %d", len(elements), n)
+				}
+
+				sample := make([]object.Object, n)
+				for i, j := range e.rand.Perm(len(elements))[:n] {
+					sample[i] = elements[j]
+				}
+
+				return &object.Array{Elements: sample}
+			},
+		},
+	}
+}
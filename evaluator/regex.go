@@ -0,0 +1,151 @@
+package evaluator
+
+import (
+	"container/list"
+	"leopard/object"
+	"regexp"
+)
+
+// maxCachedPatterns is how many compiled patterns an Evaluator keeps.
+// Scripts building patterns from data would otherwise grow the cache
+// without limit.
+const maxCachedPatterns = 64
+
+// patternCache holds the most recently compiled patterns and evicts the
+// least recently used one when full.
+type patternCache struct {
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // of *regexp.Regexp, most recently used first
+}
+
+func newPatternCache(size int) *patternCache {
+	return &patternCache{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// len returns the number of cached patterns.
+func (c *patternCache) len() int {
+	return c.order.Len()
+}
+
+func (c *patternCache) get(pattern string) (*regexp.Regexp, bool) {
+	el, ok := c.entries[pattern]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*regexp.Regexp), true
+}
+
+func (c *patternCache) put(pattern string, re *regexp.Regexp) {
+	c.entries[pattern] = c.order.PushFront(re)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*regexp.Regexp).String())
+	}
+}
+
+// regexBuiltins returns the builtins for regular expressions. They
+// share the Evaluator's cache of compiled patterns.
+func (e *Evaluator) regexBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"match": &object.Builtin{
+			Name:        "match",
+			Description: "Returns the first match of the pattern in the string as an array of the whole match followed by its capture groups, or null if there is none. Groups that did not take part in the match are null.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.STRING_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				re, err := e.compile(args[0].(*object.String).Value)
+				if err != nil {
+					return err
+				}
+
+				s := args[1].(*object.String).Value
+				indices := re.FindStringSubmatchIndex(s)
+				if indices == nil {
+					return NULL
+				}
+
+				return submatches(s, indices)
+			},
+		},
+
+		"match_all": &object.Builtin{
+			Name:        "match_all",
+			Description: "Returns every non-overlapping match of the pattern in the string, each in the form returned by match.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgTypes:    [][]object.ObjectType{{object.STRING_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				re, err := e.compile(args[0].(*object.String).Value)
+				if err != nil {
+					return err
+				}
+
+				s := args[1].(*object.String).Value
+				all := re.FindAllStringSubmatchIndex(s, -1)
+
+				matches := make([]object.Object, len(all))
+				for i, indices := range all {
+					matches[i] = submatches(s, indices)
+				}
+
+				return &object.Array{Elements: matches}
+			},
+		},
+
+		"regex_replace": &object.Builtin{
+			Name:        "regex_replace",
+			Description: "Returns a copy of the string with every match of the pattern replaced by the replacement, in which $1 or ${name} refer to capture groups.",
+			MinArgs:     3,
+			MaxArgs:     3,
+			ArgTypes:    [][]object.ObjectType{{object.STRING_OBJ}},
+			Fn: func(args ...object.Object) object.Object {
+				re, err := e.compile(args[0].(*object.String).Value)
+				if err != nil {
+					return err
+				}
+
+				s := args[1].(*object.String).Value
+				replacement := args[2].(*object.String).Value
+
+				return &object.String{Value: re.ReplaceAllString(s, replacement)}
+			},
+		},
+	}
+}
+
+// compile returns the compiled form of pattern, reusing the one from a
+// recent call with the same pattern, so scripts matching in a loop do not
+// compile it every time.
+func (e *Evaluator) compile(pattern string) (*regexp.Regexp, *object.Error) {
+	if re, ok := e.patterns.get(pattern); ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, newError("invalid pattern: %s", err)
+	}
+	e.patterns.put(pattern, re)
+
+	return re, nil
+}
+
+// submatches converts the index pairs of a match in s to an array of the
+// matched strings, with null for groups that did not participate.
+func submatches(s string, indices []int) *object.Array {
+	groups := make([]object.Object, len(indices)/2)
+	for i := range groups {
+		start, end := indices[2*i], indices[2*i+1]
+		if start < 0 {
+			groups[i] = NULL
+			continue
+		}
+		groups[i] = &object.String{Value: s[start:end]}
+	}
+
+	return &object.Array{Elements: groups}
+}
@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"leopard/ast"
+	"leopard/lexer"
+	"leopard/object"
+	"leopard/parser"
+	"strings"
+)
+
+// programCache holds the most recently parsed programs, keyed by a hash of
+// their source, and evicts the least recently used one when full.
+type programCache struct {
+	size    int
+	entries map[uint64]*list.Element
+	order   *list.List // of *cachedProgram, most recently used first
+	misses  int
+}
+
+// cachedProgram is a program in a programCache with the source it was
+// parsed from, which tells programs whose sources hash alike apart.
+type cachedProgram struct {
+	key     uint64
+	source  string
+	program *ast.Program
+}
+
+// CachePrograms makes Run keep the last n programs it parsed, so running
+// the same source again skips lexing and parsing. Programs are not changed
+// by evaluation, so a cached program can be run any number of times.
+func CachePrograms(n int) Option {
+	return func(e *Evaluator) {
+		if n > 0 {
+			e.programs = &programCache{size: n, entries: make(map[uint64]*list.Element), order: list.New()}
+		}
+	}
+}
+
+// Run parses source and evaluates it in env, returning the value of the
+// last statement. Parse and evaluation errors are returned as errors.
+func (e *Evaluator) Run(source string, env *object.Environment) (object.Object, error) {
+	program, err := e.parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	result := e.Eval(program, env)
+	if err, ok := result.(*object.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+
+	return result, nil
+}
+
+// parse parses source, using the program cache if there is one. Programs
+// with parse errors are not cached.
+func (e *Evaluator) parse(source string) (*ast.Program, error) {
+	c := e.programs
+	if c == nil {
+		return parseSource(source)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(source))
+	key := h.Sum64()
+
+	if el, ok := c.entries[key]; ok && el.Value.(*cachedProgram).source == source {
+		c.order.MoveToFront(el)
+		return el.Value.(*cachedProgram).program, nil
+	}
+
+	c.misses++
+	program, err := parseSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&cachedProgram{key: key, source: source, program: program})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedProgram).key)
+	}
+
+	return program, nil
+}
+
+// parseSource lexes and parses source, returning its parse errors as one
+// error.
+func parseSource(source string) (*ast.Program, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parse error: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	return program, nil
+}
@@ -0,0 +1,45 @@
+package evaluator
+
+import "leopard/object"
+
+// scopeBuiltins returns the builtins that inspect or change the scope they
+// are called from. They receive the environment of the call in place of a
+// closure over the Evaluator.
+func scopeBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"unset": &object.Builtin{
+			Name:        "unset",
+			Description: "Removes the binding of the named variable from the current scope and reports whether it existed. Bindings of the same name in outer scopes are left in place. Read-only bindings cannot be removed.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgTypes:    [][]object.ObjectType{{object.STRING_OBJ}},
+			ScopedFn: func(env *object.Environment, args ...object.Object) object.Object {
+				name := args[0].(*object.String).Value
+				if env.IsReadOnly(name) {
+					err := newCodedError(object.NAME_ERROR, "cannot unset read-only binding: %s", name)
+					err.Data = errorData(map[string]string{"name": name})
+					return err
+				}
+				return nativeBoolToBooleanObject(env.Delete(name))
+			},
+		},
+
+		"globals": &object.Builtin{
+			Name:        "globals",
+			Description: "Returns a hash from the names of the top-level variables and functions to their values. Builtins are not included.",
+			MinArgs:     0,
+			MaxArgs:     0,
+			ScopedFn: func(env *object.Environment, args ...object.Object) object.Object {
+				bindings := env.Outermost().Bindings()
+
+				pairs := make(map[object.HashKey]object.HashPair, len(bindings))
+				for name, val := range bindings {
+					key := &object.String{Value: name}
+					pairs[key.HashKey()] = object.HashPair{Key: key, Value: val}
+				}
+
+				return &object.Hash{Pairs: pairs}
+			},
+		},
+	}
+}
@@ -0,0 +1,163 @@
+package evaluator
+
+import (
+	"fmt"
+	"leopard/object"
+)
+
+// testResult records the outcome of a single call to the `test` builtin.
+type testResult struct {
+	name    string
+	failure string
+}
+
+// testingBuiltins returns the builtins for writing test suites in Leopard.
+// Results of `test` are collected on the Evaluator and reported when the
+// program that ran them ends.
+func (e *Evaluator) testingBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"assert_eq": &object.Builtin{
+			Name:        "assert_eq",
+			Description: "Returns an error unless both arguments are equal.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			Fn: func(args ...object.Object) object.Object {
+				if !objectsEqual(args[0], args[1]) {
+					a, b := assertionOperands(args[0], args[1])
+					return newError("assertion failed: %s != %s", a, b)
+				}
+
+				return NULL
+			},
+		},
+
+		"assert_ne": &object.Builtin{
+			Name:        "assert_ne",
+			Description: "Returns an error if both arguments are equal.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			Fn: func(args ...object.Object) object.Object {
+				if objectsEqual(args[0], args[1]) {
+					a, b := assertionOperands(args[0], args[1])
+					return newError("assertion failed: %s == %s", a, b)
+				}
+
+				return NULL
+			},
+		},
+
+		"test": &object.Builtin{
+			Name:        "test",
+			Description: "Calls fn and records it as failed if it returns an error, which does not stop the program.",
+			MinArgs:     2,
+			MaxArgs:     2,
+			Fn: func(args ...object.Object) object.Object {
+				if args[0].Type() != object.STRING_OBJ {
+					return newCodedError(object.TYPE_ERROR, "first argument to `test` must be STRING, got %s", args[0].Type())
+				}
+				if !isCallable(args[1]) {
+					return newCodedError(object.TYPE_ERROR, "second argument to `test` must be FUNCTION or BUILTIN, got %s", args[1].Type())
+				}
+
+				result := testResult{name: args[0].(*object.String).Value}
+				if err, ok := e.applyFunction(args[1], nil).(*object.Error); ok {
+					result.failure = err.Message
+				}
+				e.tests = append(e.tests, result)
+
+				return NULL
+			},
+		},
+	}
+}
+
+// reportTests writes a summary of the tests run so far to the Evaluator's
+// output and clears them. Nothing is written if no tests ran.
+func (e *Evaluator) reportTests() {
+	if len(e.tests) == 0 {
+		return
+	}
+
+	failed := 0
+	for _, result := range e.tests {
+		if result.failure != "" {
+			failed++
+			fmt.Fprintf(e.out, "FAIL %s: %s\n", result.name, result.failure)
+		} else {
+			fmt.Fprintf(e.out, "PASS %s\n", result.name)
+		}
+	}
+	fmt.Fprintf(e.out, "%d passed, %d failed\n", len(e.tests)-failed, failed)
+
+	e.tests = nil
+}
+
+// objectsEqual reports whether two objects have the same type and contents.
+// Collections are compared element by element, and values that have no
+// contents to compare, such as functions and channels, by identity.
+func objectsEqual(a, b object.Object) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *object.Integer:
+		return a.Value == b.(*object.Integer).Value
+	case *object.Float:
+		return a.Value == b.(*object.Float).Value
+	case *object.Boolean:
+		return a.Value == b.(*object.Boolean).Value
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Null:
+		return true
+	case *object.Error:
+		other := b.(*object.Error)
+		return a.Message == other.Message && a.Code == other.Code
+	case *object.Array:
+		other := b.(*object.Array)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i, el := range a.Elements {
+			if !objectsEqual(el, other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		other := b.(*object.Hash)
+		if len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			otherPair, ok := other.Pairs[key]
+			if !ok || !objectsEqual(pair.Value, otherPair.Value) {
+				return false
+			}
+		}
+		return true
+	case *object.Set:
+		other := b.(*object.Set)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for key := range a.Elements {
+			if _, ok := other.Elements[key]; !ok {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// assertionOperands returns how a failed assertion shows a and b: as they
+// print, unless they print the same, in which case with their types.
+func assertionOperands(a, b object.Object) (string, string) {
+	if a.Inspect() == b.Inspect() && !objectsEqual(a, b) {
+		return object.Describe(a), object.Describe(b)
+	}
+	return a.Inspect(), b.Inspect()
+}
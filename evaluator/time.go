@@ -0,0 +1,43 @@
+package evaluator
+
+import (
+	"leopard/object"
+	"time"
+)
+
+// timeBuiltins returns the builtins backed by the Evaluator's clock. The clock
+// functions are fields on the Evaluator so tests can replace them.
+func (e *Evaluator) timeBuiltins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"now": &object.Builtin{
+			Name:        "now",
+			Description: "Returns the current Unix time in milliseconds.",
+			MinArgs:     0,
+			MaxArgs:     0,
+			Fn: func(args ...object.Object) object.Object {
+				return newInteger(e.now().UnixMilli())
+			},
+		},
+
+		"sleep": &object.Builtin{
+			Name:        "sleep",
+			Description: "Pauses execution for the given number of milliseconds.",
+			MinArgs:     1,
+			MaxArgs:     1,
+			Fn: func(args ...object.Object) object.Object {
+				if args[0].Type() != object.INTEGER_OBJ {
+					return newCodedError(object.TYPE_ERROR, "argument to `sleep` must be INTEGER, got %s", args[0].Type())
+				}
+
+				ms := args[0].(*object.Integer).Value
+				if ms < 0 {
+					return newCodedError(object.RANGE_ERROR, "argument to `sleep` must not be negative, got %d", ms)
+				}
+
+				e.sleep(time.Duration(ms) * time.Millisecond)
+
+				return NULL
+			},
+		},
+	}
+}
@@ -0,0 +1,22 @@
+package evaluator
+
+import (
+	"leopard/ast"
+	"leopard/object"
+)
+
+// Tracer is notified by an Evaluator before it evaluates each node, with
+// the environment the node is evaluated in. Evaluation waits for
+// BeforeEval to return, so a debugger can pause at a breakpoint by
+// blocking until the user continues, inspecting env in the meantime.
+// Breakpoints can be matched against the node's token position.
+type Tracer interface {
+	BeforeEval(node ast.Node, env *object.Environment)
+}
+
+// Trace makes the Evaluator call t before evaluating each node.
+func Trace(t Tracer) Option {
+	return func(e *Evaluator) {
+		e.tracer = t
+	}
+}
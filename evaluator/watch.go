@@ -0,0 +1,45 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"leopard/ast"
+	"leopard/object"
+)
+
+// EvalWatch evaluates a single expression against env without changing it,
+// using a new Evaluator with the default configuration, as Eval does. It is
+// meant for debugger watch expressions.
+func EvalWatch(expr string, env *object.Environment) (object.Object, error) {
+	return New().EvalWatch(expr, env)
+}
+
+// EvalWatch parses expr, which must be a single expression, and evaluates
+// it in a deep clone of env, so any bindings it makes are discarded and
+// appending to a builder or changing an array, hash or set bound in env
+// does not affect the program. Generators, files, channels, tasks, mutexes
+// and atomics are shared, as are objects only reachable from a function's
+// environment, so a watch that calls next, write, send or the like does
+// change the program's state. Parse and evaluation errors are returned as
+// errors.
+func (e *Evaluator) EvalWatch(expr string, env *object.Environment) (object.Object, error) {
+	program, err := parseSource(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(program.Statements) != 1 {
+		return nil, fmt.Errorf("watch must be a single expression, got %d statements", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil, fmt.Errorf("watch must be an expression, got %s statement", program.Statements[0].TokenLiteral())
+	}
+
+	result := unwrapReturnValue(e.Eval(stmt.Expression, env.DeepClone()))
+	if err, ok := result.(*object.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+
+	return result, nil
+}
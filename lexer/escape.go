@@ -0,0 +1,69 @@
+package lexer
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// unescape decodes the escape sequences in the text of a string literal:
+// \\ and \" for a backslash and a quote, \xNN for the byte with the two
+// hex digits NN, and \u{N...} for the UTF-8 encoding of the code point with
+// up to six hex digits. Other backslashes are kept as they are, so regular
+// expressions such as "\d+" need no doubling, and so is \x{...}, which
+// regular expressions use for a code point. If an escape sequence is
+// invalid, unescape returns it as bad.
+func unescape(raw string) (s string, bad string) {
+	if !strings.Contains(raw, `\`) {
+		return raw, ""
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' || i+1 == len(raw) {
+			out.WriteByte(raw[i])
+			continue
+		}
+
+		switch raw[i+1] {
+		case '\\', '"':
+			out.WriteByte(raw[i+1])
+			i++
+
+		case 'x':
+			if i+2 < len(raw) && raw[i+2] == '{' {
+				out.WriteString(raw[i : i+2])
+				i++
+				continue
+			}
+			if i+4 > len(raw) {
+				return "", raw[i:]
+			}
+			b, err := strconv.ParseUint(raw[i+2:i+4], 16, 8)
+			if err != nil {
+				return "", raw[i : i+4]
+			}
+			out.WriteByte(byte(b))
+			i += 3
+
+		case 'u':
+			end := strings.IndexByte(raw[i:], '}')
+			if i+2 >= len(raw) || raw[i+2] != '{' || end < 0 {
+				return "", raw[i:min(i+2, len(raw))]
+			}
+			seq := raw[i : i+end+1]
+			digits := seq[3 : len(seq)-1]
+			r, err := strconv.ParseUint(digits, 16, 32)
+			if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(r)) {
+				return "", seq
+			}
+			out.WriteRune(rune(r))
+			i += len(seq) - 1
+
+		default:
+			out.WriteByte(raw[i])
+		}
+	}
+
+	return out.String(), ""
+}
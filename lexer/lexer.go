@@ -8,10 +8,44 @@ import "leopard/token"
 
 // NextToken returns the next token in the input and advances the lexer
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	if len(l.peeked) > 0 {
+		tok := l.peeked[0]
+		l.peeked = l.peeked[1:]
+		return tok
+	}
+	return l.scan()
+}
+
+// PeekToken returns the token n tokens ahead without consuming it, so
+// PeekToken(1) is the token the next call to NextToken returns. Values of
+// n less than 1 are treated as 1. Past the end of the input it returns EOF.
+func (l *Lexer) PeekToken(n int) token.Token {
+	if n < 1 {
+		n = 1
+	}
+	for len(l.peeked) < n {
+		l.peeked = append(l.peeked, l.scan())
+	}
+	return l.peeked[n-1]
+}
 
+// scan reads the token after the ones already peeked at.
+func (l *Lexer) scan() token.Token {
 	l.skipWhitespace()
 
+	line, column, offset := l.line, l.column, l.position
+	tok := l.readToken()
+	tok.Line = line
+	tok.Column = column
+	tok.Offset = offset
+
+	return tok
+}
+
+// readToken reads the token starting at the current character.
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -36,7 +70,11 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '/' {
+			tok = l.readTwoCharToken(token.FLOOR_SLASH)
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '<':
@@ -56,14 +94,41 @@ func (l *Lexer) NextToken() token.Token {
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		start := l.position
+		raw := l.readString()
+		literal, bad := unescape(raw)
+		tok = token.Token{Type: token.STRING, Literal: literal}
+		if bad != "" {
+			tok = token.Token{Type: token.ILLEGAL, Literal: bad}
+		}
+		if bad != "" || literal != raw {
+			tok.Raw = l.input[start:min(l.position+1, len(l.input))]
+		}
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
+	case '?':
+		switch l.peekChar() {
+		case '?':
+			tok = l.readTwoCharToken(token.COALESCE)
+		case '.':
+			tok = l.readTwoCharToken(token.QUESTION_DOT)
+		case '[':
+			tok = l.readTwoCharToken(token.QUESTION_LBRACKET)
+		default:
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -73,9 +138,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
-			return tok
+			return l.readNumber()
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
@@ -85,6 +148,14 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
+// readTwoCharToken returns a token of type t made of the current and the
+// next character, advancing the lexer onto the second one.
+func (l *Lexer) readTwoCharToken(t token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: t, Literal: string(ch) + string(l.ch)}
+}
+
 // peekChar returns the next character without advancing the lexer.
 func (l *Lexer) peekChar() byte {
 	if l.readPosition >= len(l.input) {
@@ -94,13 +165,25 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
-// readNumber reads a sequence of digits as a number literal.
-func (l *Lexer) readNumber() string {
+// readNumber reads a sequence of digits as a number literal. A single '.'
+// followed by a digit turns the literal into a float.
+func (l *Lexer) readNumber() token.Token {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	return token.Token{Type: tokenType, Literal: l.input[position:l.position]}
 }
 
 // isDigit checks if a character is a numeric digit
@@ -115,10 +198,11 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-// readIdentifier reads a sequence of letters as an identifier.
+// readIdentifier reads an identifier: a letter followed by letters and
+// digits.
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
@@ -140,17 +224,27 @@ type Lexer struct {
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+	line         int  // line of the current char, starting at 1
+	column       int  // column of the current char, starting at 1
+
+	peeked []token.Token // tokens read ahead by PeekToken, in order
 }
 
 // New creates a new Lexer for the given input.
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 // readChar advances to the next character in the input.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -160,11 +254,16 @@ func (l *Lexer) readChar() {
 	l.readPosition += 1
 }
 
-// readString reads a string literal enclosed in double quotes.
+// readString reads a string literal enclosed in double quotes. A quote
+// after a backslash does not end it.
 func (l *Lexer) readString() string {
 	position := l.position + 1
 	for {
 		l.readChar()
+		if l.ch == '\\' && l.peekChar() != 0 {
+			l.readChar()
+			continue
+		}
 		if l.ch == '"' || l.ch == 0 {
 			break
 		}
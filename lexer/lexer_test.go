@@ -29,6 +29,14 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+3.14;
+math.sqrt
+x ?? y ? z
+a?.b?[0]
+_1 x2y 3z
+[a, ...b] ..
+7 // 2 / 1
+x in xs
 `
 
 	tests := []struct {
@@ -121,6 +129,42 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.FLOAT, "3.14"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "math"},
+		{token.DOT, "."},
+		{token.IDENT, "sqrt"},
+		{token.IDENT, "x"},
+		{token.COALESCE, "??"},
+		{token.IDENT, "y"},
+		{token.ILLEGAL, "?"},
+		{token.IDENT, "z"},
+		{token.IDENT, "a"},
+		{token.QUESTION_DOT, "?."},
+		{token.IDENT, "b"},
+		{token.QUESTION_LBRACKET, "?["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.IDENT, "_1"},
+		{token.IDENT, "x2y"},
+		{token.INT, "3"},
+		{token.IDENT, "z"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "b"},
+		{token.RBRACKET, "]"},
+		{token.DOT, "."},
+		{token.DOT, "."},
+		{token.INT, "7"},
+		{token.FLOOR_SLASH, "//"},
+		{token.INT, "2"},
+		{token.SLASH, "/"},
+		{token.INT, "1"},
+		{token.IDENT, "x"},
+		{token.IN, "in"},
+		{token.IDENT, "xs"},
 		{token.EOF, ""},
 	}
 
@@ -137,3 +181,191 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"a b\"\n\t[1]"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"a b", 2, 7},
+		{"[", 3, 2},
+		{"1", 3, 3},
+		{"]", 3, 4},
+		{"", 3, 5},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%d:%d, got=%d:%d",
+				i, tok.Literal, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestPeekToken(t *testing.T) {
+	l := New("let x = 5;")
+
+	peeks := []struct {
+		n        int
+		expected token.TokenType
+	}{
+		{2, token.IDENT},
+		{1, token.LET},
+		{0, token.LET},
+		{4, token.INT},
+		{7, token.EOF},
+	}
+	for _, tt := range peeks {
+		if tok := l.PeekToken(tt.n); tok.Type != tt.expected {
+			t.Errorf("PeekToken(%d) wrong. expected=%q, got=%q", tt.n, tt.expected, tok.Type)
+		}
+	}
+
+	expected := Tokens("let x = 5;")
+	for i, want := range expected {
+		if i == 2 {
+			if tok := l.PeekToken(2); tok != expected[3] {
+				t.Errorf("PeekToken(2) after %d tokens wrong. expected=%+v, got=%+v", i, expected[3], tok)
+			}
+		}
+		if tok := l.NextToken(); tok != want {
+			t.Errorf("tokens[%d] wrong. expected=%+v, got=%+v", i, want, tok)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected token.Token
+	}{
+		{`"\u{1F600}!"`, token.Token{Type: token.STRING, Literal: "\U0001F600!", Raw: `"\u{1F600}!"`}},
+		{`"\x41\x62c"`, token.Token{Type: token.STRING, Literal: "Abc", Raw: `"\x41\x62c"`}},
+		{`"\xff"`, token.Token{Type: token.STRING, Literal: "\xff", Raw: `"\xff"`}},
+		{`"\u{e9}t\u{E9}"`, token.Token{Type: token.STRING, Literal: "été", Raw: `"\u{e9}t\u{E9}"`}},
+		{`"\d+\w"`, token.Token{Type: token.STRING, Literal: `\d+\w`}},
+		{`"\\x41"`, token.Token{Type: token.STRING, Literal: `\x41`, Raw: `"\\x41"`}},
+		{`"C:\\users\\x"`, token.Token{Type: token.STRING, Literal: `C:\users\x`, Raw: `"C:\\users\\x"`}},
+		{`"say \"hi\""`, token.Token{Type: token.STRING, Literal: `say "hi"`, Raw: `"say \"hi\""`}},
+		{`"\\"`, token.Token{Type: token.STRING, Literal: `\`, Raw: `"\\"`}},
+		{`"\x{41}\x41"`, token.Token{Type: token.STRING, Literal: `\x{41}A`, Raw: `"\x{41}\x41"`}},
+		{`"C:\users"`, token.Token{Type: token.ILLEGAL, Literal: `\u`, Raw: `"C:\users"`}},
+		{`"\u{110000}"`, token.Token{Type: token.ILLEGAL, Literal: `\u{110000}`, Raw: `"\u{110000}"`}},
+		{`"\u{D800}"`, token.Token{Type: token.ILLEGAL, Literal: `\u{D800}`, Raw: `"\u{D800}"`}},
+		{`"\u{0000041}"`, token.Token{Type: token.ILLEGAL, Literal: `\u{0000041}`, Raw: `"\u{0000041}"`}},
+		{`"\u{}"`, token.Token{Type: token.ILLEGAL, Literal: `\u{}`, Raw: `"\u{}"`}},
+		{`"\u41"`, token.Token{Type: token.ILLEGAL, Literal: `\u`, Raw: `"\u41"`}},
+		{`"a\xZZ"`, token.Token{Type: token.ILLEGAL, Literal: `\xZZ`, Raw: `"a\xZZ"`}},
+		{`"\x4"`, token.Token{Type: token.ILLEGAL, Literal: `\x4`, Raw: `"\x4"`}},
+	}
+
+	for _, tt := range tests {
+		tokens := Tokens(tt.input + " x")
+		tok, next := tokens[0], tokens[1]
+		tok.Line, tok.Column, tok.Offset = 0, 0, 0
+		if tok != tt.expected {
+			t.Errorf("wrong token for %s. expected=%+v, got=%+v", tt.input, tt.expected, tok)
+		}
+		if tokens[0].Len() != len(tt.input) || next.Offset != len(tt.input)+1 {
+			t.Errorf("wrong length for %s. got=%d, next at %d", tt.input, tokens[0].Len(), next.Offset)
+		}
+	}
+
+	relexTests := []struct {
+		input string
+		edit  Edit
+	}{
+		{`let s = "\u{1F600}"; puts(s);`, Edit{Start: 23, End: 27, Text: "print"}},
+		// Removing the backslash lets the escaped quote end the string.
+		{`let s = "a\"b"; let t = "c";`, Edit{Start: 10, End: 11, Text: ""}},
+		// Adding one makes the closing quote part of the string.
+		{`let s = "a"; let t = "c";`, Edit{Start: 10, End: 10, Text: `\`}},
+	}
+
+	for _, tt := range relexTests {
+		updated := tt.input[:tt.edit.Start] + tt.edit.Text + tt.input[tt.edit.End:]
+		tokens, _ := Relex(Tokens(tt.input), updated, tt.edit)
+		expected := Tokens(updated)
+		if len(tokens) != len(expected) {
+			t.Fatalf("relexed tokens of %s wrong. expected=%+v, got=%+v", updated, expected, tokens)
+		}
+		for i := range expected {
+			if tokens[i] != expected[i] {
+				t.Fatalf("relexed tokens of %s wrong. expected=%+v, got=%+v", updated, expected, tokens)
+			}
+		}
+	}
+}
+
+func TestRelex(t *testing.T) {
+	input := "let alpha = 1;\nlet beta = alpha + 2;\nlet s = \"text\";\nputs(beta, s);"
+
+	tests := []struct {
+		name       string
+		edit       Edit
+		maxRelexed int
+	}{
+		{"inside identifier", Edit{Start: 9, End: 9, Text: "bet"}, 3},
+		{"replace number", Edit{Start: 12, End: 13, Text: "100"}, 4},
+		{"insert line", Edit{Start: 14, End: 14, Text: "\nlet gamma = 3;"}, 8},
+		{"join lines", Edit{Start: 14, End: 15, Text: " "}, 4},
+		{"merge into float", Edit{Start: 13, End: 14, Text: ".5"}, 4},
+		{"inside string", Edit{Start: 47, End: 47, Text: "more "}, 3},
+		{"remove quote", Edit{Start: 45, End: 46, Text: ""}, 100},
+		{"insert quote", Edit{Start: 4, End: 4, Text: `"`}, 100},
+	}
+
+	old := Tokens(input)
+
+	for _, tt := range tests {
+		updated := input[:tt.edit.Start] + tt.edit.Text + input[tt.edit.End:]
+
+		tokens, relexed := Relex(old, updated, tt.edit)
+
+		expected := Tokens(updated)
+		if len(tokens) != len(expected) {
+			t.Errorf("%s: wrong number of tokens. expected=%d, got=%d", tt.name, len(expected), len(tokens))
+			continue
+		}
+		for i := range expected {
+			if tokens[i] != expected[i] {
+				t.Errorf("%s: tokens[%d] wrong. expected=%+v, got=%+v", tt.name, i, expected[i], tokens[i])
+			}
+		}
+		if relexed > tt.maxRelexed {
+			t.Errorf("%s: lexed %d tokens again, want at most %d", tt.name, relexed, tt.maxRelexed)
+		}
+	}
+}
+
+func TestRelexUnterminatedString(t *testing.T) {
+	input := `let a = 1; let b = "open; let c = 3;`
+	edit := Edit{Start: 8, End: 9, Text: "2"}
+	updated := input[:edit.Start] + edit.Text + input[edit.End:]
+
+	tokens, relexed := Relex(Tokens(input), updated, edit)
+
+	expected := Tokens(updated)
+	if len(tokens) != len(expected) || tokens[len(tokens)-2] != expected[len(expected)-2] {
+		t.Fatalf("wrong tokens. expected=%+v, got=%+v", expected, tokens)
+	}
+	if relexed > 3 {
+		t.Errorf("lexed %d tokens again, want at most 3", relexed)
+	}
+}
@@ -0,0 +1,133 @@
+package lexer
+
+import (
+	"leopard/token"
+	"strings"
+)
+
+// Edit describes a change to source: the bytes from Start up to End in the
+// old source were replaced by Text.
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Tokens lexes input and returns all of its tokens, ending with EOF.
+func Tokens(input string) []token.Token {
+	l := New(input)
+
+	tokens := []token.Token{}
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
+
+// Relex returns the tokens of input, the source that results from applying
+// edit to the source old was lexed from, along with the number of tokens it
+// lexed again. Instead of lexing all of input, it lexes from just before the
+// edit until the new tokens line up with old ones again, and reuses the rest
+// of old with their positions shifted.
+//
+// Lexing restarts one token before the first token ending at or after the
+// edit, since a token can merge with the one before it, as in 1. and 5. If
+// the edit inserts a quote or a backslash, touches the quotes of a string
+// literal or changes one with escape sequences, which may escape a quote,
+// the strings after it may open and close at different places, so
+// everything up to the end of input is lexed again.
+func Relex(old []token.Token, input string, edit Edit) ([]token.Token, int) {
+	delta := len(edit.Text) - (edit.End - edit.Start)
+
+	first := 0
+	for first < len(old)-1 && tokenEnd(old[first]) < edit.Start {
+		first++
+	}
+	if first > 0 {
+		first--
+	}
+
+	toEnd := strings.ContainsAny(edit.Text, `"\`)
+	for _, tok := range old[first:] {
+		if tok.Offset > edit.End {
+			break
+		}
+		if isString(tok) && (touchesQuotes(tok, edit) || strings.Contains(tok.Raw, `\`) && edit.Start < tokenEnd(tok)) {
+			toEnd = true
+		}
+	}
+
+	start := old[first]
+	l := &Lexer{input: input, readPosition: start.Offset, line: start.Line, column: start.Column - 1}
+	l.readChar()
+
+	tokens := append([]token.Token{}, old[:first]...)
+	relexed := 0
+	next := first
+
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		relexed++
+
+		if tok.Type == token.EOF {
+			return tokens, relexed
+		}
+		if toEnd || tok.Offset < edit.Start+len(edit.Text) {
+			continue
+		}
+
+		for next < len(old) && old[next].Offset+delta < tok.Offset {
+			next++
+		}
+		if next < len(old) && old[next].Offset >= edit.End && sameToken(old[next], tok, delta) {
+			return append(tokens, shift(old[next+1:], old[next], tok)...), relexed
+		}
+	}
+}
+
+// tokenEnd returns the offset just after the source of tok, assuming string
+// literals are terminated.
+func tokenEnd(tok token.Token) int {
+	return tok.Offset + tok.Len()
+}
+
+// isString reports whether tok is a string literal, including one with an
+// invalid escape sequence.
+func isString(tok token.Token) bool {
+	return tok.Type == token.STRING || strings.HasPrefix(tok.Raw, `"`)
+}
+
+// touchesQuotes reports whether edit overlaps or adjoins either quote of
+// the string literal tok.
+func touchesQuotes(tok token.Token, edit Edit) bool {
+	closing := tokenEnd(tok) - 1
+	return edit.Start <= tok.Offset+1 && edit.End >= tok.Offset ||
+		edit.Start <= closing+1 && edit.End >= closing
+}
+
+// sameToken reports whether the new token tok is the old token moved by
+// delta bytes.
+func sameToken(old, tok token.Token, delta int) bool {
+	return old.Offset+delta == tok.Offset && old.Type == tok.Type && old.Literal == tok.Literal && old.Raw == tok.Raw
+}
+
+// shift returns the tokens following from, which was lexed again as to,
+// with their positions moved the same way.
+func shift(tokens []token.Token, from, to token.Token) []token.Token {
+	shifted := make([]token.Token, len(tokens))
+
+	for i, tok := range tokens {
+		if tok.Line == from.Line {
+			tok.Column += to.Column - from.Column
+		}
+		tok.Line += to.Line - from.Line
+		tok.Offset += to.Offset - from.Offset
+		shifted[i] = tok
+	}
+
+	return shifted
+}
@@ -1,13 +1,32 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"leopard/repl"
 	"os"
 	"os/user"
 )
 
 func main() {
+	printAST := flag.Bool("ast", false, "print how the program read from standard input parses instead of running the REPL")
+	printTokens := flag.Bool("tokens", false, "print the tokens of the program read from standard input instead of running the REPL")
+	flag.Parse()
+
+	if *printAST || *printTokens {
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			panic(err)
+		}
+		if *printTokens {
+			repl.PrintTokens(os.Stdout, string(source))
+		} else {
+			repl.PrintAST(os.Stdout, string(source))
+		}
+		return
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
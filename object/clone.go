@@ -0,0 +1,59 @@
+package object
+
+// Clone methods. Values that cannot change once created, which includes
+// scalars, strings, errors, functions, builtins, files, generators,
+// channels, tasks and loop signals, return themselves. So do mutexes and
+// atomic integers, which are only useful when shared.
+// Arrays and hashes are copied deeply, so changes to the clone never reach
+// the original. Set elements are always immutable, so only the set itself
+// is copied.
+
+func (i *Integer) Clone() Object      { return i }
+func (f *Float) Clone() Object        { return f }
+func (b *Boolean) Clone() Object      { return b }
+func (n *Null) Clone() Object         { return n }
+func (s *String) Clone() Object       { return s }
+func (e *Error) Clone() Object        { return e }
+func (f *Function) Clone() Object     { return f }
+func (b *Builtin) Clone() Object      { return b }
+func (g *Generator) Clone() Object    { return g }
+func (c *Channel) Clone() Object      { return c }
+func (t *Task) Clone() Object         { return t }
+func (m *Mutex) Clone() Object        { return m }
+func (a *Atomic) Clone() Object       { return a }
+func (f *File) Clone() Object         { return f }
+func (lc *LoopControl) Clone() Object { return lc }
+func (rv *ReturnValue) Clone() Object { return &ReturnValue{Value: rv.Value.Clone()} }
+
+func (ao *Array) Clone() Object {
+	elements := make([]Object, len(ao.Elements))
+	for i, el := range ao.Elements {
+		elements[i] = el.Clone()
+	}
+
+	return &Array{Elements: elements}
+}
+
+func (sb *StringBuilder) Clone() Object {
+	clone := &StringBuilder{}
+	clone.Builder.WriteString(sb.Builder.String())
+	return clone
+}
+
+func (h *Hash) Clone() Object {
+	pairs := make(map[HashKey]HashPair, len(h.Pairs))
+	for key, pair := range h.Pairs {
+		pairs[key] = HashPair{Key: pair.Key, Value: pair.Value.Clone()}
+	}
+
+	return &Hash{Pairs: pairs}
+}
+
+func (s *Set) Clone() Object {
+	elements := make(map[HashKey]Object, len(s.Elements))
+	for key, el := range s.Elements {
+		elements[key] = el
+	}
+
+	return &Set{Elements: elements}
+}
@@ -0,0 +1,163 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// FromGo converts a Go value into the corresponding Leopard object so that
+// hosts can pass data to scripts. Integers, floats, strings, booleans and
+// nil map directly; slices and arrays become Arrays and maps become Hashes,
+// converted recursively. Values that are already Objects are returned as is.
+func FromGo(v interface{}) (Object, error) {
+	if v == nil {
+		return NULL, nil
+	}
+	if obj, ok := v.(Object); ok {
+		return obj, nil
+	}
+
+	return fromReflectValue(reflect.ValueOf(v))
+}
+
+// fromReflectValue converts a single reflected Go value.
+func fromReflectValue(v reflect.Value) (Object, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d overflows INTEGER", v.Uint())
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return FromGo(v.Elem().Interface())
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			element, err := fromReflectValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return &Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		pairs := make(map[HashKey]HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := fromReflectValue(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := fromReflectValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashKey.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		return &Hash{Pairs: pairs}, nil
+
+	default:
+		return nil, fmt.Errorf("cannot convert Go value of type %s", v.Type())
+	}
+}
+
+// ToGo converts a Leopard object into a plain Go value. Integers become
+// int64, floats float64, null nil, and arrays and sets []interface{}, with
+// set elements in sorted order. Hashes become map[string]interface{} when
+// all their keys are strings and map[interface{}]interface{} otherwise.
+// Other objects, such as functions, are returned unchanged.
+func ToGo(obj Object) interface{} {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value
+	case *Float:
+		return obj.Value
+	case *String:
+		return obj.Value
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return nil
+
+	case *Array:
+		result := make([]interface{}, len(obj.Elements))
+		for i, element := range obj.Elements {
+			result[i] = ToGo(element)
+		}
+		return result
+
+	case *Set:
+		elements := make([]Object, 0, len(obj.Elements))
+		for _, element := range obj.Elements {
+			elements = append(elements, element)
+		}
+		sort.Slice(elements, func(i, j int) bool {
+			return elements[i].Inspect() < elements[j].Inspect()
+		})
+		result := make([]interface{}, len(elements))
+		for i, element := range elements {
+			result[i] = ToGo(element)
+		}
+		return result
+
+	case *Hash:
+		if stringKeys(obj) {
+			result := make(map[string]interface{}, len(obj.Pairs))
+			for _, pair := range obj.Pairs {
+				result[pair.Key.(*String).Value] = ToGo(pair.Value)
+			}
+			return result
+		}
+		result := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			result[ToGo(pair.Key)] = ToGo(pair.Value)
+		}
+		return result
+
+	default:
+		return obj
+	}
+}
+
+// stringKeys reports whether every key of hash is a String.
+func stringKeys(hash *Hash) bool {
+	for _, pair := range hash.Pairs {
+		if _, ok := pair.Key.(*String); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Describe returns a multi-line, indented representation of obj that shows
+// the type of every value alongside it, for inspecting nested collections.
+// Functions are described by their parameters only, so the environments they
+// capture are never walked, and a collection nested inside itself is printed
+// as <cycle> instead of recursing forever.
+func Describe(obj Object) string {
+	var out bytes.Buffer
+	d := describer{out: &out, visiting: make(map[Object]bool)}
+	d.describe(obj, 0)
+	return out.String()
+}
+
+// describer accumulates the output of Describe.
+type describer struct {
+	out      *bytes.Buffer
+	visiting map[Object]bool
+}
+
+// describe writes obj at the given indentation depth.
+func (d *describer) describe(obj Object, depth int) {
+	if d.visiting[obj] {
+		d.out.WriteString("<cycle>")
+		return
+	}
+
+	switch obj := obj.(type) {
+	case *String:
+		fmt.Fprintf(d.out, "%s %q", obj.Type(), obj.Value)
+	case *Null:
+		d.out.WriteString(string(obj.Type()))
+	case *Function:
+		params := []string{}
+		for _, p := range obj.Parameters {
+			params = append(params, p.String())
+		}
+		fmt.Fprintf(d.out, "%s fn(%s)", obj.Type(), strings.Join(params, ", "))
+	case *Builtin:
+		d.out.WriteString(string(obj.Type()))
+	case *Array:
+		entries := []func(){}
+		for _, el := range obj.Elements {
+			entries = append(entries, func() { d.describe(el, depth+1) })
+		}
+		d.collection(obj, "[", "]", depth, entries)
+	case *Hash:
+		pairs := make([]HashPair, 0, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, pair)
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+		})
+
+		entries := []func(){}
+		for _, pair := range pairs {
+			entries = append(entries, func() {
+				d.describe(pair.Key, depth+1)
+				d.out.WriteString(": ")
+				d.describe(pair.Value, depth+1)
+			})
+		}
+		d.collection(obj, "{", "}", depth, entries)
+	case *Set:
+		elements := make([]Object, 0, len(obj.Elements))
+		for _, el := range obj.Elements {
+			elements = append(elements, el)
+		}
+		sort.Slice(elements, func(i, j int) bool {
+			return elements[i].Inspect() < elements[j].Inspect()
+		})
+
+		entries := []func(){}
+		for _, el := range elements {
+			entries = append(entries, func() { d.describe(el, depth+1) })
+		}
+		d.collection(obj, "{", "}", depth, entries)
+	default:
+		fmt.Fprintf(d.out, "%s %s", obj.Type(), obj.Inspect())
+	}
+}
+
+// collection writes a collection header with its size followed by each
+// entry on its own line, indented one level deeper than depth.
+func (d *describer) collection(obj Object, open, close string, depth int, entries []func()) {
+	fmt.Fprintf(d.out, "%s(%d) %s", obj.Type(), len(entries), open)
+	if len(entries) == 0 {
+		d.out.WriteString(close)
+		return
+	}
+
+	d.visiting[obj] = true
+	defer delete(d.visiting, obj)
+
+	indent := strings.Repeat("  ", depth+1)
+	for _, entry := range entries {
+		d.out.WriteString("\n" + indent)
+		entry()
+	}
+
+	d.out.WriteString("\n" + strings.Repeat("  ", depth) + close)
+}
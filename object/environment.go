@@ -1,9 +1,15 @@
 package object
 
+import "sync"
+
 // NewEnclosedEnvironment creates a new environment with an outer environment for variable scoping.
+// The new environment is guarded if the outer one is shared.
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	if outer.mu != nil {
+		env.mu = &sync.RWMutex{}
+	}
 	return env
 }
 
@@ -14,14 +20,53 @@ func NewEnvironment() *Environment {
 }
 
 // Environment represents a scope for storing variables, with optional outer scope support.
+//
+// An environment is not safe for concurrent use until it is shared with
+// Share. From then on its bindings are guarded by a lock, as are those of
+// the environments enclosed by it afterwards.
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    map[string]Object
+	readOnly map[string]bool
+	outer    *Environment
+	mu       *sync.RWMutex
+}
+
+// Share makes the environment and all of its outer environments safe to
+// read and write from several goroutines at once. It must be called before
+// the environment is handed to another goroutine.
+func (e *Environment) Share() {
+	for ; e != nil; e = e.outer {
+		if e.mu == nil {
+			e.mu = &sync.RWMutex{}
+		}
+	}
+}
+
+// lock and rlock acquire the lock of a shared environment for writing or
+// reading, and return the function that releases it. They do nothing for
+// an environment that is not shared.
+func (e *Environment) lock() func() {
+	if e.mu == nil {
+		return func() {}
+	}
+	e.mu.Lock()
+	return e.mu.Unlock
+}
+
+func (e *Environment) rlock() func() {
+	if e.mu == nil {
+		return func() {}
+	}
+	e.mu.RLock()
+	return e.mu.RUnlock
 }
 
 // Get retrieves the value of a variable by its name, checking outer environments if needed.
 func (e *Environment) Get(name string) (Object, bool) {
+	unlock := e.rlock()
 	obj, ok := e.store[name]
+	unlock()
+
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
@@ -30,6 +75,100 @@ func (e *Environment) Get(name string) (Object, bool) {
 
 // Set assigns a value to a variable in the current environment.
 func (e *Environment) Set(name string, val Object) Object {
+	defer e.lock()()
 	e.store[name] = val
 	return val
 }
+
+// SetReadOnly binds name to val in the current environment and marks the
+// binding read-only, so scripts cannot rebind or unset it in this scope.
+// It is meant for values injected by the host, such as configuration.
+// Inner scopes may still shadow the name.
+func (e *Environment) SetReadOnly(name string, val Object) Object {
+	defer e.lock()()
+	if e.readOnly == nil {
+		e.readOnly = make(map[string]bool)
+	}
+	e.readOnly[name] = true
+	e.store[name] = val
+	return val
+}
+
+// IsReadOnly reports whether name is bound read-only in the current
+// environment, without looking at outer environments.
+func (e *Environment) IsReadOnly(name string) bool {
+	defer e.rlock()()
+	return e.readOnly[name]
+}
+
+// Outermost returns the environment at the end of the chain of outer
+// environments, which holds the top-level bindings of a program.
+func (e *Environment) Outermost() *Environment {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+// Bindings returns a copy of the bindings in the current environment,
+// without those of outer environments.
+func (e *Environment) Bindings() map[string]Object {
+	defer e.rlock()()
+	bindings := make(map[string]Object, len(e.store))
+	for name, val := range e.store {
+		bindings[name] = val
+	}
+	return bindings
+}
+
+// Delete removes the binding of name from the current environment, leaving
+// any binding of the same name in outer environments in place. It reports
+// whether the binding existed. Deleting a read-only binding also clears its
+// read-only mark.
+func (e *Environment) Delete(name string) bool {
+	defer e.lock()()
+	_, ok := e.store[name]
+	delete(e.store, name)
+	delete(e.readOnly, name)
+	return ok
+}
+
+// Clone returns a snapshot of the environment and all of its outer
+// environments. Bindings added to either copy afterwards are not visible
+// in the other, while the bound objects themselves are shared. The copy is
+// not shared, whether or not the original is.
+func (e *Environment) Clone() *Environment {
+	return e.cloneWith(func(val Object) Object { return val })
+}
+
+// DeepClone returns a snapshot of the environment as Clone does, except
+// that each bound object is replaced by its Clone, so changes made through
+// the copy to builders, arrays, hashes and sets bound in it do not reach
+// the original. Objects whose Clone returns themselves, and those only
+// reachable through function environments, are still shared.
+func (e *Environment) DeepClone() *Environment {
+	return e.cloneWith(Object.Clone)
+}
+
+// cloneWith returns a snapshot of the environment and its outer
+// environments, binding each name to cloneValue applied to its object.
+func (e *Environment) cloneWith(cloneValue func(Object) Object) *Environment {
+	unlock := e.rlock()
+	clone := NewEnvironment()
+	for name, val := range e.store {
+		clone.store[name] = cloneValue(val)
+	}
+	for name := range e.readOnly {
+		if clone.readOnly == nil {
+			clone.readOnly = make(map[string]bool, len(e.readOnly))
+		}
+		clone.readOnly[name] = true
+	}
+	unlock()
+
+	if e.outer != nil {
+		clone.outer = e.outer.cloneWith(cloneValue)
+	}
+
+	return clone
+}
@@ -0,0 +1,83 @@
+package object
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// HashAll returns a structural hash of obj. Unlike HashKey, it also hashes
+// null, arrays, hashes and sets by their contents, so equal collections hash
+// equal. It returns false if obj is or contains a value without a stable
+// identity, such as a function or builtin.
+//
+// HashAll is meant for caches inside the interpreter; collections still
+// cannot be used as hash keys in the language.
+func HashAll(obj Object) (uint64, bool) {
+	h := fnv.New64a()
+	h.Write([]byte(obj.Type()))
+
+	var buf [8]byte
+	write := func(v uint64) {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+
+	switch obj := obj.(type) {
+	case Hashable:
+		write(obj.HashKey().Value)
+	case *Null:
+	case *Array:
+		write(uint64(len(obj.Elements)))
+		for _, el := range obj.Elements {
+			sum, ok := HashAll(el)
+			if !ok {
+				return 0, false
+			}
+			write(sum)
+		}
+	case *Hash:
+		// Pairs are combined with addition so the result does not depend
+		// on map iteration order.
+		var combined uint64
+		for _, pair := range obj.Pairs {
+			key, ok := HashAll(pair.Key)
+			if !ok {
+				return 0, false
+			}
+			value, ok := HashAll(pair.Value)
+			if !ok {
+				return 0, false
+			}
+			combined += mix(key, value)
+		}
+		write(uint64(len(obj.Pairs)))
+		write(combined)
+	case *Set:
+		var combined uint64
+		for _, el := range obj.Elements {
+			sum, ok := HashAll(el)
+			if !ok {
+				return 0, false
+			}
+			combined += sum
+		}
+		write(uint64(len(obj.Elements)))
+		write(combined)
+	default:
+		return 0, false
+	}
+
+	return h.Sum64(), true
+}
+
+// mix combines the hashes of a key and its value into the hash of the pair.
+func mix(key, value uint64) uint64 {
+	h := fnv.New64a()
+
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], key)
+	binary.LittleEndian.PutUint64(buf[8:], value)
+	h.Write(buf[:])
+
+	return h.Sum64()
+}
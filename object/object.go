@@ -8,11 +8,18 @@ and string representation.
 package object
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"hash/fnv"
 	"leopard/ast"
+	"math"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // ObjectType represents the type of an object in the language.
@@ -21,21 +28,54 @@ type ObjectType string
 // Supported object types
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	LOOP_CONTROL_OBJ = "LOOP_CONTROL"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	SET_OBJ          = "SET"
+	FILE_OBJ         = "FILE"
+	GENERATOR_OBJ    = "GENERATOR"
+	CHANNEL_OBJ      = "CHANNEL"
+	TASK_OBJ         = "TASK"
+	MUTEX_OBJ        = "MUTEX"
+	ATOMIC_OBJ       = "ATOMIC"
+	BUILDER_OBJ      = "STRING_BUILDER"
+
+	// ANY_OBJ is not the type of any object. It is used in a builtin's
+	// ArgTypes to accept an argument of every type.
+	ANY_OBJ = "ANY"
 )
 
-// Object is an interface for all objects in the language.
+// Error codes set by the evaluator on the errors it creates.
+const (
+	TYPE_ERROR  = "TYPE_ERROR"
+	ARITY_ERROR = "ARITY_ERROR"
+	NAME_ERROR  = "NAME_ERROR"
+	KEY_ERROR   = "KEY_ERROR"
+	RANGE_ERROR = "RANGE_ERROR" // a value of the right type outside the allowed range
+)
+
+// The single instances of null, true and false. The evaluator compares
+// these by identity, so they must not be allocated anew.
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// Object is an interface for all objects in the language. Clone returns a
+// copy of the object that shares no mutable state with it.
 type Object interface {
 	Type() ObjectType
 	Inspect() string
+	Clone() Object
 }
 
 // Integer represents an integer value.
@@ -47,6 +87,22 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// Float represents a floating point value.
+type Float struct {
+	Value float64
+}
+
+// Type and Inspect methods for Float. Whole numbers keep a trailing ".0"
+// so they can be told apart from integers.
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEnN") {
+		s += ".0"
+	}
+	return s
+}
+
 // Boolean represents a boolean value
 type Boolean struct {
 	Value bool
@@ -72,16 +128,37 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
-// Error represents an error message.
+// LoopControl signals a break or continue statement to the innermost
+// enclosing loop, which stops or skips to its next iteration.
+type LoopControl struct {
+	Continue bool
+}
+
+// Type and Inspect methods for LoopControl.
+func (lc *LoopControl) Type() ObjectType { return LOOP_CONTROL_OBJ }
+func (lc *LoopControl) Inspect() string {
+	if lc.Continue {
+		return "continue"
+	}
+	return "break"
+}
+
+// Error represents an error message. Code optionally names the kind of
+// error, such as TYPE_ERROR, and Data optionally holds details about it for
+// code that handles the error; neither is shown by Inspect.
 type Error struct {
 	Message string
+	Code    string
+	Data    *Hash
 }
 
 // Type and Inspect methods for Error.
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
-// Function represents a user-defined function
+// Function represents a user-defined function. It captures the environment
+// it was defined in by reference, so bindings made in that environment after
+// the function was created are visible when it is called.
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
@@ -117,9 +194,32 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 
-// Builtin represents a built-in function
+// Builtin represents a built-in function. Name, Description and the arity
+// bounds describe the builtin; the evaluator checks the number of arguments
+// against MinArgs and MaxArgs before calling Fn. They are empty for builtins
+// created at runtime, such as the results of partial or memoize.
+//
+// ScopedFn is set instead of Fn by builtins that act on the scope they are
+// called from, such as `unset`. They can only be called directly by name.
+//
+// CallbackFn is set instead of Fn by builtins that call functions back,
+// such as the results of partial or memoize. The evaluator calling one
+// passes it a function that applies callables in that evaluator, so they
+// can be called from any spawned function.
+//
+// ArgTypes optionally lists the types each argument may have, which the
+// evaluator also checks before calling Fn. An argument may have any of the
+// types in its entry, or any type at all if the entry is ANY_OBJ. When there
+// are more arguments than entries, the last entry applies to the rest.
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn          BuiltinFunction
+	Name        string
+	Description string
+	MinArgs     int
+	MaxArgs     int // -1 means no upper bound
+	ArgTypes    [][]ObjectType
+	ScopedFn    ScopedFunction
+	CallbackFn  CallbackFunction
 }
 
 // Type and Inspect methods for Builtin.
@@ -129,6 +229,14 @@ func (b *Builtin) Inspect() string  { return "builtin function" }
 // BuiltinFunction defines a function signature for built-in functions.
 type BuiltinFunction func(args ...Object) Object
 
+// ScopedFunction defines a function signature for built-in functions that
+// receive the environment they are called from.
+type ScopedFunction func(env *Environment, args ...Object) Object
+
+// CallbackFunction defines a function signature for built-in functions that
+// call functions back with apply.
+type CallbackFunction func(apply func(fn Object, args []Object) Object, args ...Object) Object
+
 // Array represents a collection of objects
 type Array struct {
 	Elements []Object
@@ -185,6 +293,111 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// Set represents an unordered collection of distinct hashable objects.
+type Set struct {
+	Elements map[HashKey]Object
+}
+
+// Type and Inspect methods for Set. Elements are listed in sorted order
+// so that equal sets print identically.
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range s.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	sort.Strings(elements)
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// File represents a file opened with the `open` builtin. Reader buffers
+// reads of files opened for reading and is nil otherwise.
+type File struct {
+	Path   string
+	File   *os.File
+	Reader *bufio.Reader
+	Closed bool
+}
+
+// Type and Inspect methods for File.
+func (f *File) Type() ObjectType { return FILE_OBJ }
+func (f *File) Inspect() string  { return fmt.Sprintf("<file %s>", f.Path) }
+
+// Generator represents a call of a generator function, a function whose
+// body contains yield. Next resumes the call and returns the next value it
+// yields, or false once the call has returned. Stop ends a call that has
+// not returned, running its deferred functions; Next then returns false.
+type Generator struct {
+	Next func() (Object, bool)
+	Stop func()
+}
+
+// Type and Inspect methods for Generator.
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string  { return "generator" }
+
+// Channel represents a channel created with the `channel` builtin, over
+// which spawned functions pass values. C is unbuffered, so a send waits
+// for a matching receive.
+type Channel struct {
+	C chan Object
+}
+
+// Type and Inspect methods for Channel.
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return "channel" }
+
+// Task represents a function call started on its own goroutine with the
+// `spawn` builtin. Done is closed once the call has returned and Result
+// holds its value, which `wait` returns.
+type Task struct {
+	Done   chan struct{}
+	Result Object
+}
+
+// Type and Inspect methods for Task.
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string  { return "task" }
+
+// Mutex represents a lock created with the `mutex` builtin, which spawned
+// functions take with `lock` and release with `unlock`.
+type Mutex struct {
+	Mu sync.Mutex
+}
+
+// Type and Inspect methods for Mutex.
+func (m *Mutex) Type() ObjectType { return MUTEX_OBJ }
+func (m *Mutex) Inspect() string  { return "mutex" }
+
+// Atomic represents an integer created with the `atomic` builtin, which
+// spawned functions can change at the same time with `atomic_add`.
+type Atomic struct {
+	Value atomic.Int64
+}
+
+// Type and Inspect methods for Atomic.
+func (a *Atomic) Type() ObjectType { return ATOMIC_OBJ }
+func (a *Atomic) Inspect() string  { return fmt.Sprintf("atomic(%d)", a.Value.Load()) }
+
+// StringBuilder represents a string built up in place with the `append`
+// builtin, which avoids copying the string so far on every step as
+// repeated `+` does. It is not safe for use by several spawned functions
+// at once.
+type StringBuilder struct {
+	Builder strings.Builder
+}
+
+// Type and Inspect methods for StringBuilder.
+func (sb *StringBuilder) Type() ObjectType { return BUILDER_OBJ }
+func (sb *StringBuilder) Inspect() string  { return "string_builder" }
+
 // Hashable is an interface for objects that can be used as hash keys.
 type Hashable interface {
 	HashKey() HashKey
@@ -207,6 +420,11 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// HashKey generates a hash key for Float.
+func (f *Float) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 // HashKey generates a hash key for String.
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"reflect"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +24,325 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestEnvironmentClone(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("b", &Integer{Value: 2})
+
+	clone := inner.Clone()
+
+	outer.Set("a", &Integer{Value: 10})
+	inner.Set("c", &Integer{Value: 3})
+	clone.Set("d", &Integer{Value: 4})
+
+	if val, ok := clone.Get("a"); !ok || val.(*Integer).Value != 1 {
+		t.Errorf("clone sees rebinding in outer environment. got=%v", val)
+	}
+	if val, ok := clone.Get("b"); !ok || val.(*Integer).Value != 2 {
+		t.Errorf("clone lost binding b. got=%v", val)
+	}
+	if _, ok := clone.Get("c"); ok {
+		t.Errorf("clone sees binding added to original")
+	}
+	if _, ok := inner.Get("d"); ok {
+		t.Errorf("original sees binding added to clone")
+	}
+}
+
+func TestEnvironmentDeepClone(t *testing.T) {
+	sb := &StringBuilder{}
+	outer := NewEnvironment()
+	outer.Set("sb", sb)
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("n", &Integer{Value: 1})
+
+	clone := inner.DeepClone()
+
+	val, ok := clone.Get("sb")
+	if !ok {
+		t.Fatalf("clone lost binding sb")
+	}
+	val.(*StringBuilder).Builder.WriteString("x")
+	if sb.Builder.Len() != 0 {
+		t.Errorf("write to cloned builder reached the original. got=%q", sb.Builder.String())
+	}
+	if val, ok := clone.Get("n"); !ok || val.(*Integer).Value != 1 {
+		t.Errorf("clone lost binding n. got=%v", val)
+	}
+}
+
+func TestEnvironmentDelete(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("a", &Integer{Value: 2})
+
+	if !inner.Delete("a") {
+		t.Errorf("Delete of existing binding returned false")
+	}
+	if val, ok := inner.Get("a"); !ok || val.(*Integer).Value != 1 {
+		t.Errorf("outer binding not visible after Delete. got=%v", val)
+	}
+	if inner.Delete("a") {
+		t.Errorf("Delete reached the outer environment")
+	}
+	if _, ok := outer.Get("a"); !ok {
+		t.Errorf("outer binding was removed")
+	}
+}
+
+func TestEnvironmentReadOnly(t *testing.T) {
+	env := NewEnvironment()
+	env.SetReadOnly("a", &Integer{Value: 1})
+	env.Set("b", &Integer{Value: 2})
+
+	if !env.IsReadOnly("a") || env.IsReadOnly("b") {
+		t.Errorf("wrong read-only marks. a=%t, b=%t", env.IsReadOnly("a"), env.IsReadOnly("b"))
+	}
+	if !env.Clone().IsReadOnly("a") {
+		t.Errorf("Clone did not keep read-only mark")
+	}
+	if NewEnclosedEnvironment(env).IsReadOnly("a") {
+		t.Errorf("read-only mark reached an inner environment")
+	}
+
+	env.Delete("a")
+	if env.IsReadOnly("a") {
+		t.Errorf("Delete did not clear read-only mark")
+	}
+}
+
+func TestEnvironmentShare(t *testing.T) {
+	outer := NewEnvironment()
+	inner := NewEnclosedEnvironment(outer)
+	inner.Share()
+
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			for j := 0; j < 100; j++ {
+				outer.Set("a", &Integer{Value: int64(j)})
+				inner.Get("a")
+				NewEnclosedEnvironment(inner).Set("b", &Integer{Value: int64(i)})
+			}
+			done <- true
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+
+	if _, ok := outer.Get("a"); !ok {
+		t.Errorf("a is not bound")
+	}
+	if NewEnclosedEnvironment(inner).mu == nil {
+		t.Errorf("environment enclosed by a shared one is not guarded")
+	}
+	if inner.Clone().mu != nil {
+		t.Errorf("clone of a shared environment is guarded")
+	}
+}
+
+func TestEnvironmentOutermostBindings(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(NewEnclosedEnvironment(outer))
+	inner.Set("b", &Integer{Value: 2})
+
+	if inner.Outermost() != outer {
+		t.Fatalf("Outermost did not return the outer environment")
+	}
+
+	bindings := inner.Bindings()
+	if len(bindings) != 1 || bindings["b"] == nil {
+		t.Errorf("wrong bindings. got=%v", bindings)
+	}
+	bindings["c"] = NULL
+	if _, ok := inner.Get("c"); ok {
+		t.Errorf("changing Bindings result changed the environment")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	inner := &Array{Elements: []Object{&Integer{Value: 1}, &Float{Value: 2}}}
+	name := &String{Value: "name"}
+	tags := &String{Value: "tags"}
+	hash := &Hash{Pairs: map[HashKey]HashPair{
+		name.HashKey(): {Key: name, Value: &String{Value: "leo"}},
+		tags.HashKey(): {Key: tags, Value: inner},
+	}}
+	obj := &Array{Elements: []Object{hash, &Null{}, &Array{}}}
+
+	expected := `ARRAY(3) [
+  HASH(2) {
+    STRING "name": STRING "leo"
+    STRING "tags": ARRAY(2) [
+      INTEGER 1
+      FLOAT 2.0
+    ]
+  }
+  NULL
+  ARRAY(0) []
+]`
+
+	if got := Describe(obj); got != expected {
+		t.Errorf("Describe wrong.\nexpected=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+func TestDescribeCycle(t *testing.T) {
+	arr := &Array{}
+	arr.Elements = []Object{&Integer{Value: 1}, arr}
+
+	expected := "ARRAY(2) [\n  INTEGER 1\n  <cycle>\n]"
+	if got := Describe(arr); got != expected {
+		t.Errorf("Describe wrong.\nexpected=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+func TestGoConversionRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected interface{}
+	}{
+		{42, int64(42)},
+		{uint8(7), int64(7)},
+		{2.5, 2.5},
+		{"leopard", "leopard"},
+		{true, true},
+		{nil, nil},
+		{[]int{1, 2, 3}, []interface{}{int64(1), int64(2), int64(3)}},
+		{
+			map[string]interface{}{"name": "app", "ports": []interface{}{80, 443}, "debug": false},
+			map[string]interface{}{"name": "app", "ports": []interface{}{int64(80), int64(443)}, "debug": false},
+		},
+		{
+			map[int][]string{1: {"a"}, 2: nil},
+			map[interface{}]interface{}{int64(1): []interface{}{"a"}, int64(2): nil},
+		},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%v) returned error: %s", tt.input, err)
+			continue
+		}
+
+		got := ToGo(obj)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("round trip of %v wrong. expected=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFromGoBooleansAreShared(t *testing.T) {
+	obj, _ := FromGo(true)
+	if obj != TRUE {
+		t.Errorf("FromGo(true) is not TRUE. got=%p", obj)
+	}
+	obj, _ = FromGo(nil)
+	if obj != NULL {
+		t.Errorf("FromGo(nil) is not NULL. got=%p", obj)
+	}
+}
+
+func TestFromGoUnsupported(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{make(chan int), "cannot convert Go value of type chan int"},
+		{[]interface{}{1, func() {}}, "cannot convert Go value of type func()"},
+		{map[string]complex128{"z": 1i}, "cannot convert Go value of type complex128"},
+		{uint64(math.MaxUint64), "integer 18446744073709551615 overflows INTEGER"},
+	}
+
+	for _, tt := range tests {
+		_, err := FromGo(tt.input)
+		if err == nil {
+			t.Errorf("expected error converting %T", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestCloneCollectionsAreIndependent(t *testing.T) {
+	inner := &Array{Elements: []Object{&Integer{Value: 1}}}
+	key := &String{Value: "list"}
+	hash := &Hash{Pairs: map[HashKey]HashPair{key.HashKey(): {Key: key, Value: inner}}}
+	original := &Array{Elements: []Object{hash, &String{Value: "x"}}}
+
+	clone := original.Clone().(*Array)
+	if clone.Inspect() != original.Inspect() {
+		t.Fatalf("clone differs. expected=%s, got=%s", original.Inspect(), clone.Inspect())
+	}
+
+	clonedHash := clone.Elements[0].(*Hash)
+	clonedInner := clonedHash.Pairs[key.HashKey()].Value.(*Array)
+	clonedInner.Elements[0] = &Integer{Value: 2}
+	clone.Elements[1] = NULL
+	delete(clonedHash.Pairs, key.HashKey())
+
+	if original.Inspect() != "[{list: [1]}, x]" {
+		t.Errorf("original changed through clone: %s", original.Inspect())
+	}
+
+	set := &Set{Elements: map[HashKey]Object{key.HashKey(): key}}
+	clonedSet := set.Clone().(*Set)
+	delete(clonedSet.Elements, key.HashKey())
+	if len(set.Elements) != 1 {
+		t.Errorf("original set changed through clone")
+	}
+}
+
+func TestCloneScalarsReturnThemselves(t *testing.T) {
+	fn := &Function{Env: NewEnvironment()}
+	objects := []Object{&Integer{Value: 1}, &Float{Value: 1.5}, TRUE, NULL, &String{Value: "s"}, &Error{Message: "e"}, fn, &Builtin{}}
+
+	for _, obj := range objects {
+		if obj.Clone() != obj {
+			t.Errorf("%s clone is a copy, want the same object", obj.Type())
+		}
+	}
+}
+
+func TestHashAll(t *testing.T) {
+	nested := func(n int64) Object {
+		key := &String{Value: "k"}
+		return &Array{Elements: []Object{
+			&Integer{Value: 1},
+			&Array{Elements: []Object{&String{Value: "a"}, NULL}},
+			&Hash{Pairs: map[HashKey]HashPair{key.HashKey(): {Key: key, Value: &Integer{Value: n}}}},
+		}}
+	}
+
+	a, ok := HashAll(nested(2))
+	if !ok {
+		t.Fatalf("nested array is not hashable")
+	}
+	b, _ := HashAll(nested(2))
+	if a != b {
+		t.Errorf("equal nested arrays hash differently: %d != %d", a, b)
+	}
+	c, _ := HashAll(nested(3))
+	if a == c {
+		t.Errorf("different nested arrays hash equal")
+	}
+
+	one, _ := HashAll(&Array{Elements: []Object{&Integer{Value: 1}}})
+	oneString, _ := HashAll(&Array{Elements: []Object{&String{Value: "1"}}})
+	if one == oneString {
+		t.Errorf("arrays with elements of different types hash equal")
+	}
+
+	withFunction := &Array{Elements: []Object{&Function{Env: NewEnvironment()}}}
+	if _, ok := HashAll(withFunction); ok {
+		t.Errorf("array containing a function is hashable")
+	}
+}
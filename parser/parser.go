@@ -18,7 +18,9 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	COALESCE
 	EQUALS
+	MEMBERSHIP
 	LESSGREATER
 	SUM
 	PRODUCT
@@ -29,86 +31,272 @@ const (
 
 // Token precedences are used to determine the order in which expressions are parsed.
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
+	token.COALESCE:    COALESCE,
+	token.EQ:          EQUALS,
+	token.NOT_EQ:      EQUALS,
+	token.IN:          MEMBERSHIP,
+	token.LT:          LESSGREATER,
+	token.GT:          LESSGREATER,
+	token.PLUS:        SUM,
+	token.MINUS:       SUM,
+	token.SLASH:       PRODUCT,
+	token.ASTERISK:    PRODUCT,
+	token.FLOOR_SLASH: PRODUCT,
+
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+
+	token.QUESTION_LBRACKET: INDEX,
+	token.QUESTION_DOT:      INDEX,
 }
 
 // Parser represents a parser for the Leopard programming language.
 // It uses a stream of tokens to build an AST
 type Parser struct {
 	l              *lexer.Lexer
-	errors         []string
+	errors         []Message
+	warnings       []Message
 	curToken       token.Token
 	peekToken      token.Token
-	prefixParseFns map[token.TokenType]prefixParseFn
-	infixParseFns  map[token.TokenType]infixParseFn
+	prefixParseFns map[token.TokenType]PrefixParseFn
+	infixParseFns  map[token.TokenType]InfixParseFn
+
+	customPrecedences map[token.TokenType]int // set with SetPrecedence
+
+	maxTokens int  // the maximum number of tokens to read, or 0 for no limit
+	tokens    int  // the number of tokens read so far
+	maxDepth  int  // the maximum nesting depth of expressions, or 0 for no limit
+	depth     int  // the nesting depth of the expression being parsed
+	maxErrors int  // the maximum number of errors to report, or 0 for no limit
+	halted    bool // parsing stopped early because a limit was exceeded
+	loops     int  // the number of loops enclosing the current statement
+
+	recovering bool // an error was found in the current statement
+}
+
+// DefaultMaxDepth is the nesting depth of expressions at which parsing
+// stops unless configured otherwise with MaxDepth.
+const DefaultMaxDepth = 1000
+
+// DefaultMaxErrors is the number of errors after which parsing stops unless
+// configured otherwise with MaxErrors.
+const DefaultMaxErrors = 50
+
+// Option configures a Parser created by New.
+type Option func(*Parser)
+
+// MaxTokens limits the input to n tokens. Once the limit is exceeded the
+// parser records an error and stops reading, as if the input had ended, so
+// that untrusted input cannot make it use unbounded memory.
+func MaxTokens(n int) Option {
+	return func(p *Parser) {
+		p.maxTokens = n
+	}
 }
 
-// New creates a new instance of Parser.
-func New(l *lexer.Lexer) *Parser {
+// MaxDepth limits how deeply expressions may be nested, counting every
+// operand, grouping, literal and block that contains another expression.
+// Deeper input is reported as an error instead of exhausting the stack.
+// A limit of 0 disables the check.
+func MaxDepth(n int) Option {
+	return func(p *Parser) {
+		p.maxDepth = n
+	}
+}
+
+// MaxErrors stops parsing once n errors have been found, adding a final
+// error saying there were too many, so that badly malformed input does not
+// produce an error for every statement. A limit of 0 disables the check.
+func MaxErrors(n int) Option {
+	return func(p *Parser) {
+		p.maxErrors = n
+	}
+}
+
+// New creates a new instance of Parser, configured by the given options.
+func New(l *lexer.Lexer, opts ...Option) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		maxDepth:  DefaultMaxDepth,
+		maxErrors: DefaultMaxErrors,
+	}
+
+	for _, opt := range opts {
+		opt(p)
 	}
 
 	// Register prefix and infix parsing functions
-	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
-	p.registerPrefix(token.IDENT, p.parseIdentifier)
-	p.registerPrefix(token.INT, p.parseIntegerLiteral)
-	p.registerPrefix(token.BANG, p.parsePrefixExpression)
-	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
-	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
-	p.registerPrefix(token.TRUE, p.parseBoolean)
-	p.registerPrefix(token.FALSE, p.parseBoolean)
-	p.registerPrefix(token.IF, p.parseIfExpression)
-	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
-	p.registerPrefix(token.STRING, p.parseStringLiteral)
-	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
-	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
-
-	p.infixParseFns = make(map[token.TokenType]infixParseFn)
-	p.registerInfix(token.PLUS, p.parseInfixExpression)
-	p.registerInfix(token.MINUS, p.parseInfixExpression)
-	p.registerInfix(token.SLASH, p.parseInfixExpression)
-	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
-	p.registerInfix(token.EQ, p.parseInfixExpression)
-	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
-	p.registerInfix(token.LT, p.parseInfixExpression)
-	p.registerInfix(token.GT, p.parseInfixExpression)
-	p.registerInfix(token.LPAREN, p.parseCallExpression)
-	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.prefixParseFns = make(map[token.TokenType]PrefixParseFn)
+	p.RegisterPrefix(token.IDENT, p.parseIdentifier)
+	p.RegisterPrefix(token.INT, p.parseIntegerLiteral)
+	p.RegisterPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.RegisterPrefix(token.BANG, p.parsePrefixExpression)
+	p.RegisterPrefix(token.MINUS, p.parsePrefixExpression)
+	p.RegisterPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.RegisterPrefix(token.TRUE, p.parseBoolean)
+	p.RegisterPrefix(token.FALSE, p.parseBoolean)
+	p.RegisterPrefix(token.IF, p.parseIfExpression)
+	p.RegisterPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.RegisterPrefix(token.STRING, p.parseStringLiteral)
+	p.RegisterPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.RegisterPrefix(token.LBRACE, p.parseBraceLiteral)
+
+	p.infixParseFns = make(map[token.TokenType]InfixParseFn)
+	p.RegisterInfix(token.PLUS, p.parseInfixExpression)
+	p.RegisterInfix(token.MINUS, p.parseInfixExpression)
+	p.RegisterInfix(token.SLASH, p.parseInfixExpression)
+	p.RegisterInfix(token.ASTERISK, p.parseInfixExpression)
+	p.RegisterInfix(token.FLOOR_SLASH, p.parseInfixExpression)
+	p.RegisterInfix(token.EQ, p.parseInfixExpression)
+	p.RegisterInfix(token.NOT_EQ, p.parseInfixExpression)
+	p.RegisterInfix(token.COALESCE, p.parseInfixExpression)
+	p.RegisterInfix(token.IN, p.parseInfixExpression)
+	p.RegisterInfix(token.LT, p.parseComparison)
+	p.RegisterInfix(token.GT, p.parseComparison)
+	p.RegisterInfix(token.LPAREN, p.parseCallExpression)
+	p.RegisterInfix(token.LBRACKET, p.parseIndexExpression)
+	p.RegisterInfix(token.DOT, p.parseMemberExpression)
+	p.RegisterInfix(token.QUESTION_LBRACKET, p.parseIndexExpression)
+	p.RegisterInfix(token.QUESTION_DOT, p.parseMemberExpression)
+
+	p.Reset(l)
+
+	return p
+}
+
+// Reset prepares the parser to parse the input of l, as if it had just been
+// created for it. Errors and warnings from earlier input are discarded,
+// while options and registered parse functions are kept. Slices returned by
+// earlier calls to methods such as Errors are not affected.
+func (p *Parser) Reset(l *lexer.Lexer) {
+	p.l = l
+	p.errors = []Message{}
+	p.warnings = []Message{}
+	p.curToken = token.Token{}
+	p.peekToken = token.Token{}
+	p.tokens = 0
+	p.depth = 0
+	p.halted = false
+	p.loops = 0
+	p.recovering = false
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
 	p.nextToken()
+}
 
-	return p
+// Message is an error or warning found during parsing, together with the
+// token it refers to.
+type Message struct {
+	Token token.Token
+	Text  string
+}
+
+// String formats the message prefixed with the line and column it refers to.
+func (m Message) String() string {
+	return fmt.Sprintf("line %d, column %d: %s", m.Token.Line, m.Token.Column, m.Text)
 }
 
 // Errors returns a slice of error messages encountered during parsing.
 func (p *Parser) Errors() []string {
+	errors := make([]string, len(p.errors))
+	for i, msg := range p.errors {
+		errors[i] = msg.Text
+	}
+	return errors
+}
+
+// ErrorMessages returns the errors encountered during parsing together
+// with the tokens they were found at.
+func (p *Parser) ErrorMessages() []Message {
 	return p.errors
 }
 
+// Warnings returns non-fatal style issues found during parsing, such as
+// empty blocks, statements after a return and parameters shadowed by let.
+// Each warning starts with the line and column it refers to.
+func (p *Parser) Warnings() []string {
+	warnings := make([]string, len(p.warnings))
+	for i, msg := range p.warnings {
+		warnings[i] = msg.String()
+	}
+	return warnings
+}
+
+// WarningMessages returns the warnings found during parsing together with
+// the tokens they refer to.
+func (p *Parser) WarningMessages() []Message {
+	return p.warnings
+}
+
+// addError adds an error about the source at the position of tok. Only the
+// first error in a statement is added, as later ones usually follow from it;
+// parsing resumes with the next statement, as described at synchronize.
+func (p *Parser) addError(tok token.Token, format string, a ...interface{}) {
+	if p.halted || p.recovering {
+		return
+	}
+	p.errors = append(p.errors, Message{Token: tok, Text: fmt.Sprintf(format, a...)})
+	p.recovering = true
+
+	if p.maxErrors > 0 && len(p.errors) >= p.maxErrors {
+		p.halt(tok, "too many errors, stopped after %d", p.maxErrors)
+	}
+}
+
+// warn adds a warning about the source at the position of tok.
+func (p *Parser) warn(tok token.Token, format string, a ...interface{}) {
+	p.warnings = append(p.warnings, Message{Token: tok, Text: fmt.Sprintf(format, a...)})
+}
+
 // peekError adds an error message indicating that the expected token type
 // did not match the actual type of the next token.
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	if p.peekToken.Type == token.ILLEGAL {
+		p.illegalError(p.peekToken)
+		return
+	}
+	p.addError(p.peekToken, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
+}
+
+// illegalError adds an error for a character the lexer did not recognize.
+func (p *Parser) illegalError(tok token.Token) {
+	if tok.Raw != "" {
+		p.addError(tok, "invalid escape sequence %s in string at %d:%d", tok.Literal, tok.Line, tok.Column)
+		return
+	}
+	p.addError(tok, "unexpected character '%s' at %d:%d", tok.Literal, tok.Line, tok.Column)
 }
 
 // nextToken advances the parser to the next token by updating curToken and peekToken.
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
+
+	if p.halted {
+		// peekToken stays the EOF set by halt.
+		return
+	}
+
 	p.peekToken = p.l.NextToken()
+	if p.peekToken.Type == token.EOF {
+		return
+	}
+
+	p.tokens++
+	if p.maxTokens > 0 && p.tokens > p.maxTokens {
+		p.halt(p.peekToken, "input exceeds the maximum of %d tokens", p.maxTokens)
+	}
+}
+
+// halt records an error at tok and stops parsing by making the input end
+// after the current token. Errors caused by the input ending early are not
+// recorded, so the given error is the last one.
+func (p *Parser) halt(tok token.Token, format string, a ...interface{}) {
+	if !p.halted {
+		p.errors = append(p.errors, Message{Token: tok, Text: fmt.Sprintf(format, a...)})
+	}
+	p.halted = true
+	p.peekToken = token.Token{Type: token.EOF, Line: tok.Line, Column: tok.Column, Offset: tok.Offset}
 }
 
 // ParseProgram parses the entire input as a sequence of statements
@@ -117,25 +305,92 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
+	reach := &reachability{}
 	for p.curToken.Type != token.EOF {
+		start := p.curToken
 		stmt := p.parseStatement()
 		if stmt != nil {
+			p.checkReachable(reach, start, stmt)
 			program.Statements = append(program.Statements, stmt)
 		}
+		if p.recovering {
+			p.synchronize()
+		}
 		p.nextToken()
 	}
 
 	return program
 }
 
+// synchronize skips the rest of a statement that had an error, so that
+// parsing resumes with the next statement and can report its errors too.
+// It stops at a semicolon, or before a closing brace or a keyword that
+// starts a statement, ignoring those inside braces it skips.
+func (p *Parser) synchronize() {
+	depth := 0
+	for !p.curTokenIs(token.EOF) && !p.peekTokenIs(token.EOF) {
+		if depth == 0 && (p.curTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || isStatementKeyword(p.peekToken.Type)) {
+			break
+		}
+
+		p.nextToken()
+		if p.curTokenIs(token.LBRACE) {
+			depth++
+		} else if p.curTokenIs(token.RBRACE) && depth > 0 {
+			depth--
+		}
+	}
+
+	p.recovering = false
+}
+
+// isStatementKeyword checks whether t is a keyword that starts a statement.
+func isStatementKeyword(t token.TokenType) bool {
+	switch t {
+	case token.LET, token.RETURN, token.DEFER, token.YIELD, token.FOR, token.BREAK, token.CONTINUE:
+		return true
+	default:
+		return false
+	}
+}
+
 // parseStatement parses a single statement based on the current token.
 // It returns the parsed statement as an ast.Statement
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		// Return an untyped nil on failure so callers can check for it.
+		if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+			if stmt := p.parseDestructuringStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		}
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.DEFER:
+		return p.parseDeferStatement()
+	case token.YIELD:
+		return p.parseYieldStatement()
+	case token.FOR:
+		// Return an untyped nil on failure so callers can check for it.
+		if stmt := p.parseForInStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -167,6 +422,110 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// parseDestructuringStatement parses a "let" statement whose left-hand side
+// is a pattern and returns an *ast.DestructuringStatement representing it.
+func (p *Parser) parseDestructuringStatement() *ast.DestructuringStatement {
+	stmt := &ast.DestructuringStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	if p.curTokenIs(token.LBRACKET) {
+		pattern := p.parseArrayPattern()
+		if pattern == nil {
+			return nil
+		}
+		stmt.Pattern = pattern
+	} else {
+		pattern := p.parseHashPattern()
+		if pattern == nil {
+			return nil
+		}
+		stmt.Pattern = pattern
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseArrayPattern parses an array pattern such as [a, b, ...rest] and
+// returns it as an *ast.ArrayPattern. A rest element must come last.
+func (p *Parser) parseArrayPattern() *ast.ArrayPattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	pattern.Rbracket = p.curToken.Offset
+
+	return pattern
+}
+
+// parseHashPattern parses a hash pattern such as {name, age: years} and
+// returns it as an *ast.HashPattern.
+func (p *Parser) parseHashPattern() *ast.HashPattern {
+	pattern := &ast.HashPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		key := p.curToken.Literal
+		value := &ast.Identifier{Token: p.curToken, Value: key}
+
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		}
+		pattern.Keys = append(pattern.Keys, key)
+		pattern.Values = append(pattern.Values, value)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	pattern.Rbrace = p.curToken.Offset
+
+	return pattern
+}
+
 // parseReturnStatement parses a "return" statement and returns
 // an *ast.ReturnStatement representing it.
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
@@ -183,6 +542,117 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// parseDeferStatement parses a "defer" statement and returns
+// an *ast.DeferStatement representing it.
+func (p *Parser) parseDeferStatement() *ast.DeferStatement {
+	stmt := &ast.DeferStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Expression = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseYieldStatement parses a "yield" statement and returns
+// an *ast.YieldStatement representing it.
+func (p *Parser) parseYieldStatement() *ast.YieldStatement {
+	stmt := &ast.YieldStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseForInStatement parses a "for (x in xs) { ... }" loop, or one with
+// two variables such as "for (i, x in xs) { ... }", and returns an
+// *ast.ForInStatement representing it.
+func (p *Parser) parseForInStatement() *ast.ForInStatement {
+	stmt := &ast.ForInStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Variable
+		stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.loops++
+	stmt.Body = p.parseBlockStatement()
+	p.loops--
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseBreakStatement parses a "break" statement, which must be inside a
+// loop, and returns an *ast.BreakStatement representing it.
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	if p.loops == 0 {
+		p.addError(p.curToken, "break outside loop")
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseContinueStatement parses a "continue" statement, which must be
+// inside a loop, and returns an *ast.ContinueStatement representing it.
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	if p.loops == 0 {
+		p.addError(p.curToken, "continue outside loop")
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // curTokenIs checks if the current token matches the given type.
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
@@ -205,21 +675,63 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
+// A PrefixParseFn parses an expression that starts with the current token.
+// An InfixParseFn parses an expression in which the current token follows
+// the expression given to it. Both leave the last token of the expression
+// as the current token.
 type (
-	prefixParseFn func() ast.Expression
-	infixParseFn  func(expression ast.Expression) ast.Expression
+	PrefixParseFn func() ast.Expression
+	InfixParseFn  func(expression ast.Expression) ast.Expression
 )
 
-// registerPrefix registers a prefix parsing function for a given token type.
-func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
+// RegisterPrefix registers a prefix parsing function for a given token type,
+// replacing any previous one. Embedders can use it to extend the syntax
+// with tokens the parser does not otherwise accept, such as the ILLEGAL
+// tokens of characters the language does not use.
+func (p *Parser) RegisterPrefix(tokenType token.TokenType, fn PrefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
 
-// registerInfix registers an infix parsing function for a given token type.
-func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
+// RegisterInfix registers an infix parsing function for a given token type,
+// replacing any previous one. The function is only called for tokens that
+// bind more tightly than LOWEST, so a new infix token also needs a
+// precedence set with SetPrecedence.
+func (p *Parser) RegisterInfix(tokenType token.TokenType, fn InfixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+// SetPrecedence sets how tightly tokens of the given type bind as infix
+// operators in this parser, from LOWEST to INDEX.
+func (p *Parser) SetPrecedence(tokenType token.TokenType, precedence int) {
+	if p.customPrecedences == nil {
+		p.customPrecedences = make(map[token.TokenType]int)
+	}
+	p.customPrecedences[tokenType] = precedence
+}
+
+// CurToken returns the current token, for use by registered parse functions.
+func (p *Parser) CurToken() token.Token {
+	return p.curToken
+}
+
+// NextToken advances to the next token, for use by registered parse functions.
+func (p *Parser) NextToken() {
+	p.nextToken()
+}
+
+// ExpectPeek advances if the next token is of the given type and records an
+// error otherwise, for use by registered parse functions.
+func (p *Parser) ExpectPeek(t token.TokenType) bool {
+	return p.expectPeek(t)
+}
+
+// ParseExpression parses the expression starting at the current token,
+// stopping before any infix operator that binds no more tightly than
+// precedence. It is for use by registered parse functions.
+func (p *Parser) ParseExpression(precedence int) ast.Expression {
+	return p.parseExpression(precedence)
+}
+
 // parseExpressionStatement parses an expression as an *ast.ExpressionStatement
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
@@ -235,6 +747,14 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 // parseExpression parses an expression using a specified precedence level.
 // It returns the parsed expression as an ast.Expression.
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	p.depth++
+	defer func() { p.depth-- }()
+
+	if p.maxDepth > 0 && p.depth > p.maxDepth {
+		p.halt(p.curToken, "expression nested too deeply, the maximum depth is %d", p.maxDepth)
+		return nil
+	}
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
@@ -268,8 +788,23 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, "could not parse %q as integer", p.curToken.Literal)
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+// parseFloatLiteral parses a float literal and returns it as an *ast.FloatLiteral
+// If the literal cannot be parsed, it records an error.
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.addError(p.curToken, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 
@@ -281,8 +816,11 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 // noPrefixParseFnError records an error indicating that no prefix parse
 // function was found for the given token type.
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	if t == token.ILLEGAL {
+		p.illegalError(p.curToken)
+		return
+	}
+	p.addError(p.curToken, "no prefix parse function for %s found", t)
 }
 
 // parsePrefixExpression parses a prefix expression and returns
@@ -302,17 +840,22 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 // peekPrecedence returns the precedence of the next token.
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
-	}
-
-	return LOWEST
+	return p.precedence(p.peekToken.Type)
 }
 
 // curPrecedence returns the precedence of the current token.
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
-		return p
+	return p.precedence(p.curToken.Type)
+}
+
+// precedence returns the precedence of tokens of type t, as set with
+// SetPrecedence or else from precedences.
+func (p *Parser) precedence(t token.TokenType) int {
+	if prec, ok := p.customPrecedences[t]; ok {
+		return prec
+	}
+	if prec, ok := precedences[t]; ok {
+		return prec
 	}
 
 	return LOWEST
@@ -334,6 +877,31 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseComparison parses a relational operator. If further relational
+// operators follow, as in a < b < c, it returns an *ast.ChainedComparison
+// so that each operand is compared with its neighbours rather than with the
+// boolean result of the previous comparison.
+func (p *Parser) parseComparison(left ast.Expression) ast.Expression {
+	expression := p.parseInfixExpression(left).(*ast.InfixExpression)
+	if !p.peekTokenIs(token.LT) && !p.peekTokenIs(token.GT) {
+		return expression
+	}
+
+	chain := &ast.ChainedComparison{
+		Token:     expression.Token,
+		Operands:  []ast.Expression{expression.Left, expression.Right},
+		Operators: []string{expression.Operator},
+	}
+	for p.peekTokenIs(token.LT) || p.peekTokenIs(token.GT) {
+		p.nextToken()
+		chain.Operators = append(chain.Operators, p.curToken.Literal)
+		p.nextToken()
+		chain.Operands = append(chain.Operands, p.parseExpression(LESSGREATER))
+	}
+
+	return chain
+}
+
 // parseBoolean parses a boolean literal and returns it as an *ast.Boolean
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
@@ -394,16 +962,85 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block.Statements = []ast.Statement{}
 
 	p.nextToken()
+	p.parseBlockBody(block)
+
+	return block
+}
 
+// parseBlockBody parses statements into block up to the closing brace,
+// starting at the current token, and warns if the block is empty.
+func (p *Parser) parseBlockBody(block *ast.BlockStatement) {
+	reach := &reachability{}
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		start := p.curToken
 		stmt := p.parseStatement()
 		if stmt != nil {
+			p.checkReachable(reach, start, stmt)
 			block.Statements = append(block.Statements, stmt)
 		}
+		if p.recovering {
+			p.synchronize()
+		}
 		p.nextToken()
 	}
 
-	return block
+	block.Rbrace = p.curToken.Offset
+
+	if len(block.Statements) == 0 {
+		p.warn(block.Token, "empty block")
+	}
+}
+
+// reachability tracks whether the statements of a single program or block
+// can still be reached as they are parsed.
+type reachability struct {
+	terminated bool   // a statement that never falls through was seen
+	reported   bool   // the first unreachable statement was warned about
+	terminator string // the keyword of the terminating statement
+}
+
+// checkReachable warns about stmt, which starts at start, if it cannot be
+// reached. The rules are deliberately simple and never flag reachable code:
+//
+//   - A statement following a return, break or continue in the same block,
+//     or at the top level of the program, is unreachable. Only the first such statement in each
+//     block is reported, as it marks the start of the dead code.
+//   - A return inside a nested block, such as an if branch, only makes the
+//     rest of that block unreachable. Code after the if expression is
+//     considered reachable even if every branch returns.
+//   - Function bodies are checked on their own, so a return inside a
+//     function literal does not affect the code around it.
+func (p *Parser) checkReachable(reach *reachability, start token.Token, stmt ast.Statement) {
+	if reach.terminated && !reach.reported {
+		p.warn(start, "unreachable statement after %s", reach.terminator)
+		reach.reported = true
+	}
+
+	switch stmt.(type) {
+	case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		if !reach.terminated {
+			reach.terminated = true
+			reach.terminator = stmt.TokenLiteral()
+		}
+	}
+}
+
+// checkShadowedParameters warns about let statements at the top level of
+// a function body that rebind one of the function's parameters. The
+// throwaway identifier _ binds nothing, so it is not checked.
+func (p *Parser) checkShadowedParameters(lit *ast.FunctionLiteral) {
+	params := make(map[string]bool, len(lit.Parameters))
+	for _, param := range lit.Parameters {
+		if param.Value != "_" {
+			params[param.Value] = true
+		}
+	}
+
+	for _, stmt := range lit.Body.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok && params[let.Name.Value] {
+			p.warn(let.Token, "let %s shadows parameter %s", let.Name.Value, let.Name.Value)
+		}
+	}
 }
 
 // parseFunctionLiteral parses a function literal and returns it
@@ -421,11 +1058,55 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
+	p.checkShadowedParameters(lit)
 
 	return lit
 }
 
+// parseFunctionBody parses the body of a function. Loops around the
+// function do not enclose its body, so break and continue in it must be
+// inside a loop of their own.
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	loops := p.loops
+	p.loops = 0
+	body := p.parseBlockStatement()
+	p.loops = loops
+
+	return body
+}
+
+// parseFunctionStatement parses a named function declaration and returns
+// it as an *ast.FunctionStatement.
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmt := &ast.FunctionStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	lit := &ast.FunctionLiteral{Token: stmt.Token}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseFunctionBody()
+	p.checkShadowedParameters(lit)
+	stmt.Function = lit
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // parseFunctionParameters parses function parameters and returns a slice
 // of *ast.CallExpression.
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
@@ -460,6 +1141,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Rparen = p.curToken.Offset
 	return exp
 }
 
@@ -500,6 +1182,7 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.curToken.Offset
 
 	return array
 }
@@ -533,7 +1216,7 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 // parseIndexExpression parseIndexExpression parses an index expression and returns it
 // as an *ast.IndexExpression
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left, Optional: p.curTokenIs(token.QUESTION_LBRACKET)}
 
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
@@ -541,20 +1224,76 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Rbracket = p.curToken.Offset
 
 	return exp
 }
 
-// parseHashLiteral parses a hash literal and returns it as an *ast.HashLiteral.
-// It continues parsing key-value pairs until a closing brace is found.
-func (p *Parser) parseHashLiteral() ast.Expression {
-	hash := &ast.HashLiteral{Token: p.curToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
+// parseMemberExpression parses a member access and returns it
+// as an *ast.MemberExpression
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Object: object, Optional: p.curTokenIs(token.QUESTION_DOT)}
 
-	for !p.peekTokenIs(token.RBRACE) {
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
+// parseBraceLiteral parses a literal enclosed in braces. The first element
+// decides its kind: a key followed by a colon starts a hash literal, and a
+// statement keyword or an expression followed by a semicolon starts a block
+// expression. Anything else starts a set literal, so { x } is a set and
+// { x; } a block. Empty braces are an empty hash.
+func (p *Parser) parseBraceLiteral() ast.Expression {
+	tok := p.curToken
+
+	if p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		return &ast.HashLiteral{Token: tok, Pairs: make(map[ast.Expression]ast.Expression), Rbrace: p.curToken.Offset}
+	}
+
+	if isStatementKeyword(p.peekToken.Type) {
+		return &ast.BlockExpression{Token: tok, Block: p.parseBlockStatement()}
+	}
+
+	p.nextToken()
+	start := p.curToken
+	first := p.parseExpression(LOWEST)
+
+	switch {
+	case p.peekTokenIs(token.COLON):
+		return p.parseHashLiteral(tok, first)
+	case p.peekTokenIs(token.SEMICOLON):
 		p.nextToken()
-		key := p.parseExpression(LOWEST)
+		return p.parseBlockExpression(tok, &ast.ExpressionStatement{Token: start, Expression: first})
+	default:
+		return p.parseSetLiteral(tok, first)
+	}
+}
 
+// parseBlockExpression parses the rest of a block expression whose first
+// statement has already been parsed.
+func (p *Parser) parseBlockExpression(tok token.Token, first ast.Statement) ast.Expression {
+	block := &ast.BlockStatement{Token: tok, Statements: []ast.Statement{first}}
+
+	p.nextToken()
+	p.parseBlockBody(block)
+
+	return &ast.BlockExpression{Token: tok, Block: block}
+}
+
+// parseHashLiteral parses a hash literal whose first key has already been
+// parsed and returns it as an *ast.HashLiteral.
+// It continues parsing key-value pairs until a closing brace is found.
+func (p *Parser) parseHashLiteral(tok token.Token, key ast.Expression) ast.Expression {
+	hash := &ast.HashLiteral{Token: tok}
+	hash.Pairs = make(map[ast.Expression]ast.Expression)
+
+	for {
 		if !p.expectPeek(token.COLON) {
 			return nil
 		}
@@ -567,11 +1306,37 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
+		if p.peekTokenIs(token.RBRACE) {
+			break
+		}
+
+		p.nextToken()
+		key = p.parseExpression(LOWEST)
 	}
 
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.curToken.Offset
 
 	return hash
 }
+
+// parseSetLiteral parses a set literal whose first element has already been
+// parsed and returns it as an *ast.SetLiteral.
+func (p *Parser) parseSetLiteral(tok token.Token, first ast.Expression) ast.Expression {
+	set := &ast.SetLiteral{Token: tok, Elements: []ast.Expression{first}}
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		set.Elements = append(set.Elements, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	set.Rbrace = p.curToken.Offset
+
+	return set
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"leopard/ast"
 	"leopard/lexer"
+	"leopard/token"
+	"strings"
 	"testing"
 )
 
@@ -77,6 +79,53 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	t.FailNow()
 }
 
+func TestDestructuringStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		names    []string
+	}{
+		{"let [a, b] = pair;", "let [a, b] = pair;", []string{"a", "b"}},
+		{"let [head, ...tail] = f(x)", "let [head, ...tail] = f(x);", []string{"head", "tail"}},
+		{"let [...all] = xs;", "let [...all] = xs;", []string{"all"}},
+		{"let [] = xs;", "let [] = xs;", []string{}},
+		{"let {name, age} = person;", "let {name, age} = person;", []string{"name", "age"}},
+		{"let {name: n, age} = person;", "let {name: n, age} = person;", []string{"n", "age"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.DestructuringStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.DestructuringStatement. got=%T", program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+
+		names := []string{}
+		for _, name := range stmt.Pattern.Names() {
+			names = append(names, name.Value)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+			t.Errorf("wrong names for %q. expected=%v, got=%v", tt.input, tt.names, names)
+		}
+	}
+
+	invalid := []string{"let [a, ...b, c] = xs;", "let [1] = xs;", "let [a b] = xs;", `let {"a"} = h;`, "let {a: 1} = h;"}
+	for _, input := range invalid {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -111,6 +160,122 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestDeferStatement(t *testing.T) {
+	input := "defer close(f);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.DeferStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.DeferStatement. got=%T", program.Statements[0])
+	}
+	if stmt.TokenLiteral() != "defer" {
+		t.Fatalf("stmt.TokenLiteral not 'defer', got %q", stmt.TokenLiteral())
+	}
+	if stmt.String() != "defer close(f);" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+	if _, ok := stmt.Expression.(*ast.CallExpression); !ok {
+		t.Errorf("stmt.Expression not *ast.CallExpression. got=%T", stmt.Expression)
+	}
+}
+
+func TestYieldStatement(t *testing.T) {
+	l := lexer.New("fn() { yield x + 1; }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	stmt, ok := fn.Body.Statements[0].(*ast.YieldStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.YieldStatement. got=%T", fn.Body.Statements[0])
+	}
+	if stmt.String() != "yield (x + 1);" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	l := lexer.New("for (x in [1, 2]) { if (x) { continue; } puts(x); break; }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ForInStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ForInStatement. got=%T", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+	if stmt.Key != nil {
+		t.Errorf("stmt.Key not nil. got=%s", stmt.Key)
+	}
+	if stmt.String() != "for (x in [1, 2]) ifx continue;puts(x)break;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	p = New(lexer.New("for (i, x in xs) { puts(i, x) }"))
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt = program.Statements[0].(*ast.ForInStatement)
+	if !testIdentifier(t, stmt.Key, "i") || !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+	if stmt.String() != "for (i, x in xs) puts(i, x)" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	semicolons := []struct {
+		input    string
+		expected string
+	}{
+		{"for (x in [1]) { x }; 1", "for (x in [1]) x1"},
+		{"fn() { for (x in [1]) { x }; 2 }", "fn() for (x in [1]) x2"},
+	}
+
+	for _, tt := range semicolons {
+		p = New(lexer.New(tt.input))
+		program = p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "break outside loop"},
+		{"if (true) { continue }", "continue outside loop"},
+		{"for (x in xs) { fn() { break; } }", "break outside loop"},
+		{"for (x of xs) { x }", "expected next token to be IN, got IDENT instead"},
+		{"for x in xs { x }", "expected next token to be (, got IDENT instead"},
+		{"for (i, in xs) { i }", "expected next token to be IDENT, got IN instead"},
+		{"for (i, x, y in xs) { i }", "expected next token to be IN, got , instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -168,6 +333,34 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "3.14;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 3.14 {
+		t.Errorf("literal.Value not %f. got=%f", 3.14, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.14" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "3.14", literal.TokenLiteral())
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -308,6 +501,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * b / c",
 			"((a * b) / c)",
 		},
+		{
+			"a + b // c * d",
+			"(a + ((b // c) * d))",
+		},
+		{
+			"a + 1 in b",
+			"((a + 1) in b)",
+		},
+		{
+			"a < b in c",
+			"((a < b) in c)",
+		},
+		{
+			"a in b == c in d",
+			"((a in b) == (c in d))",
+		},
+		{
+			"!a in b ?? c",
+			"(((!a) in b) ?? c)",
+		},
 		{
 			"a + b / c",
 			"(a + (b / c))",
@@ -347,6 +560,30 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{
 			"3 < 5 == true",
 			"((3 < 5) == true)",
+		},
+		{
+			"a < b < c",
+			"(a < b < c)",
+		},
+		{
+			"a ?? b == c",
+			"(a ?? (b == c))",
+		},
+		{
+			"a?.b?[c + 1].d",
+			"(((a?.b)?[(c + 1)]).d)",
+		},
+		{
+			"a ?? b ?? c + 1",
+			"((a ?? b) ?? (c + 1))",
+		},
+		{
+			"1 + 2 < x > y * 2 == true",
+			"(((1 + 2) < x > (y * 2)) == true)",
+		},
+		{
+			"(a < b) < c",
+			"((a < b) < c)",
 		}, {
 			"1 + (2 + 3) + 4",
 			"((1 + (2 + 3)) + 4)",
@@ -391,6 +628,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"-math.pi * 2",
+			"((-(math.pi)) * 2)",
+		},
+		{
+			"math.sqrt(a + b)",
+			"(math.sqrt)((a + b))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -738,6 +983,29 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingMemberExpressions(t *testing.T) {
+	input := "math.sqrt"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	memberExp, ok := stmt.Expression.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MemberExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, memberExp.Object, "math") {
+		return
+	}
+
+	if !testIdentifier(t, memberExp.Property, "sqrt") {
+		return
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -819,3 +1087,550 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestParsingSetLiterals(t *testing.T) {
+	input := "{1, 2 * 2, 3 + 3}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	set, ok := stmt.Expression.(*ast.SetLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.SetLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(set.Elements) != 3 {
+		t.Fatalf("len(set.Elements) not 3. got=%d", len(set.Elements))
+	}
+
+	testIntegerLiteral(t, set.Elements[0], 1)
+	testInfixExpression(t, set.Elements[1], 2, "*", 2)
+	testInfixExpression(t, set.Elements[2], 3, "+", 3)
+}
+
+func TestParsingBraceLiteralKinds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{}", "*ast.HashLiteral"},
+		{"{1}", "*ast.SetLiteral"},
+		{"{1: 2}", "*ast.HashLiteral"},
+		{`{"a": 1,}`, "*ast.HashLiteral"},
+		{"{a, b}", "*ast.SetLiteral"},
+		{"{a;}", "*ast.BlockExpression"},
+		{"{let a = 1; a}", "*ast.BlockExpression"},
+		{"{f(); g()}", "*ast.BlockExpression"},
+		{"{return 1}", "*ast.BlockExpression"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if kind := fmt.Sprintf("%T", stmt.Expression); kind != tt.expected {
+			t.Errorf("wrong literal kind for %q. expected=%s, got=%s", tt.input, tt.expected, kind)
+		}
+	}
+}
+
+func TestFunctionStatementParsing(t *testing.T) {
+	input := `fn add(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Name, "add") {
+		return
+	}
+
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d", len(stmt.Function.Parameters))
+	}
+
+	testLiteralExpression(t, stmt.Function.Parameters[0], "x")
+	testLiteralExpression(t, stmt.Function.Parameters[1], "y")
+
+	if stmt.String() != "fn add(x, y) (x + y)" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestProgramToJSONIsStable(t *testing.T) {
+	input := `let h = {"b": 1, "a": fn(x) { if (x) { [x] } }}; h.a(true)`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	first, err := ast.ToJSON(program)
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		again, _ := ast.ToJSON(program)
+		if string(again) != string(first) {
+			t.Fatalf("ToJSON output is not stable.\nfirst=%s\nagain=%s", first, again)
+		}
+	}
+
+	expectedPairs := `"pairs":[{"key":{"end":20,"kind":"StringLiteral","pos":17,"value":"a"}`
+	if !strings.Contains(string(first), expectedPairs) {
+		t.Errorf("hash pairs not ordered by key. got=%s", first)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"fn f(x) {\n  return x;\n  x + 1;\n}",
+			[]string{"line 3, column 3: unreachable statement after return"},
+		},
+		{
+			"fn(x) { return x; let y = 1; y; }",
+			[]string{"line 1, column 19: unreachable statement after return"},
+		},
+		{
+			"if (x) { return 1; } x",
+			[]string{},
+		},
+		{
+			"if (x) { }",
+			[]string{"line 1, column 8: empty block"},
+		},
+		{
+			"let f = fn(x, y) { let y = 2; x + y };",
+			[]string{"line 1, column 20: let y shadows parameter y"},
+		},
+		{
+			"fn(x) { x }",
+			[]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		checkParserErrors(t, p)
+
+		warnings := p.Warnings()
+		if len(warnings) != len(tt.expected) {
+			t.Errorf("wrong number of warnings for %q. expected=%q, got=%q", tt.input, tt.expected, warnings)
+			continue
+		}
+		for i, msg := range tt.expected {
+			if warnings[i] != msg {
+				t.Errorf("warning %d wrong for %q. expected=%q, got=%q", i, tt.input, msg, warnings[i])
+			}
+		}
+	}
+}
+
+func TestUnreachableCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			// Only the rest of the branch is dead, not the code after the if.
+			"fn f(x) {\n  if (x) {\n    return 1;\n    puts(x);\n  }\n  x + 1;\n}",
+			[]string{"line 4, column 5: unreachable statement after return"},
+		},
+		{
+			"fn f(x) {\n  if (x) { return 1; } else { return 2; }\n  x;\n}",
+			[]string{},
+		},
+		{
+			"return 1;\nlet a = 2;\na;\nreturn a;\na",
+			[]string{"line 2, column 1: unreachable statement after return"},
+		},
+		{
+			"let f = fn() { return 1; };\nf();",
+			[]string{},
+		},
+		{
+			"for (x in xs) {\n  break;\n  puts(x);\n}\nputs(1);",
+			[]string{"line 3, column 3: unreachable statement after break"},
+		},
+		{
+			"for (x in xs) {\n  if (x) { continue; x }\n  x\n}",
+			[]string{"line 2, column 22: unreachable statement after continue"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		checkParserErrors(t, p)
+
+		warnings := p.Warnings()
+		if len(warnings) != len(tt.expected) {
+			t.Errorf("wrong warnings for %q. expected=%q, got=%q", tt.input, tt.expected, warnings)
+			continue
+		}
+		for i, msg := range tt.expected {
+			if warnings[i] != msg {
+				t.Errorf("warning %d wrong for %q. expected=%q, got=%q", i, tt.input, msg, warnings[i])
+			}
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	input := `let f = fn(a) { if (a) { [a.b, {"k": -a}] } else { f(a)[0] } };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	kinds := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		kinds = append(kinds, strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+		return true
+	})
+
+	expected := "Program LetStatement Identifier FunctionLiteral Identifier BlockStatement " +
+		"ExpressionStatement IfExpression Identifier BlockStatement ExpressionStatement ArrayLiteral " +
+		"MemberExpression Identifier Identifier HashLiteral StringLiteral PrefixExpression Identifier " +
+		"BlockStatement ExpressionStatement IndexExpression CallExpression Identifier Identifier IntegerLiteral"
+	if strings.Join(kinds, " ") != expected {
+		t.Errorf("wrong visit order.\nexpected=%s\ngot=%s", expected, strings.Join(kinds, " "))
+	}
+
+	count := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		count++
+		_, isFunction := node.(*ast.FunctionLiteral)
+		return !isFunction
+	})
+	if count != 4 {
+		t.Errorf("Inspect descended into a pruned node. visited=%d", count)
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let total = add(1, 2 * [3, 4][x.y]) + {"a": -1}["a"];
+if (total) { "yes" } else { fn(n) { n } }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	sources := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		sources = append(sources, input[node.Pos():node.End()])
+		return true
+	})
+
+	expected := []string{
+		input,
+		`let total = add(1, 2 * [3, 4][x.y]) + {"a": -1}["a"]`,
+		`total`,
+		`add(1, 2 * [3, 4][x.y]) + {"a": -1}["a"]`,
+		`add(1, 2 * [3, 4][x.y])`,
+		`add`,
+		`1`,
+		`2 * [3, 4][x.y]`,
+		`2`,
+		`[3, 4][x.y]`,
+		`[3, 4]`,
+		`3`,
+		`4`,
+		`x.y`,
+		`x`,
+		`y`,
+		`{"a": -1}["a"]`,
+		`{"a": -1}`,
+		`"a"`,
+		`-1`,
+		`1`,
+		`"a"`,
+		`if (total) { "yes" } else { fn(n) { n } }`,
+		`if (total) { "yes" } else { fn(n) { n } }`,
+		`total`,
+		`{ "yes" }`,
+		`"yes"`,
+		`"yes"`,
+		`{ fn(n) { n } }`,
+		`fn(n) { n }`,
+		`fn(n) { n }`,
+		`n`,
+		`{ n }`,
+		`n`,
+		`n`,
+	}
+
+	if len(sources) != len(expected) {
+		t.Fatalf("wrong number of nodes. expected=%d, got=%d: %q", len(expected), len(sources), sources)
+	}
+	for i, source := range sources {
+		if source != expected[i] {
+			t.Errorf("node %d has wrong source. expected=%q, got=%q", i, expected[i], source)
+		}
+	}
+}
+
+func TestMaxTokens(t *testing.T) {
+	input := strings.Repeat("let x = 1; ", 1000)
+
+	l := lexer.New(input)
+	p := New(l, MaxTokens(100))
+	program := p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected an error for input over the limit")
+	}
+	if errors[0] != "input exceeds the maximum of 100 tokens" {
+		t.Errorf("wrong error. got=%q", errors[0])
+	}
+	if len(program.Statements) > 20 {
+		t.Errorf("parser kept reading past the limit. got %d statements", len(program.Statements))
+	}
+
+	l = lexer.New("let x = 1; x")
+	p = New(l, MaxTokens(6))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestMaxDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		opts     []Option
+		expected string
+	}{
+		{strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000), nil,
+			"expression nested too deeply, the maximum depth is 1000"},
+		{strings.Repeat("[", 50) + strings.Repeat("]", 50), []Option{MaxDepth(20)},
+			"expression nested too deeply, the maximum depth is 20"},
+		{strings.Repeat("fn() { ", 30) + strings.Repeat("}", 30), []Option{MaxDepth(20)},
+			"expression nested too deeply, the maximum depth is 20"},
+		{strings.Repeat("-", 30) + "1", []Option{MaxDepth(20)},
+			"expression nested too deeply, the maximum depth is 20"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l, tt.opts...)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected exactly one error, got %d: %q", len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+
+	l := lexer.New(strings.Repeat("[", 50) + strings.Repeat("]", 50))
+	p := New(l, MaxDepth(0))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestIllegalTokens(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = @;", "unexpected character '@' at 1:9"},
+		{"let @ = 1;", "unexpected character '@' at 1:5"},
+		{"1 +\n  $", "unexpected character '$' at 2:3"},
+		{`let s = "\u{110000}";`, `invalid escape sequence \u{110000} in string at 1:9`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected an error for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let x = ; let y = 2; let = 3; y",
+			[]string{
+				"line 1, column 9: no prefix parse function for ; found",
+				"line 1, column 26: expected next token to be IDENT, got = instead",
+			},
+		},
+		{
+			"let x = (1 + ;\nlet y = 2",
+			[]string{"line 1, column 14: no prefix parse function for ; found"},
+		},
+		{
+			"let f = fn() {\n  let = 1;\n  let b = ;\n  b\n};\nlet c = ;",
+			[]string{
+				"line 2, column 7: expected next token to be IDENT, got = instead",
+				"line 3, column 11: no prefix parse function for ; found",
+				"line 6, column 9: no prefix parse function for ; found",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		messages := []string{}
+		for _, msg := range p.ErrorMessages() {
+			messages = append(messages, msg.String())
+		}
+		if strings.Join(messages, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong errors for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, messages)
+		}
+	}
+
+	p := New(lexer.New("let x = ; let y = 2; y"))
+	program := p.ParseProgram()
+	if program.String() != "let x = ;let y = 2;y" {
+		t.Errorf("statements after an error are not parsed. got=%q", program.String())
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := strings.Repeat("let = 1; ", 200)
+
+	tests := []struct {
+		opts     []Option
+		expected int
+	}{
+		{nil, DefaultMaxErrors},
+		{[]Option{MaxErrors(3)}, 3},
+		{[]Option{MaxErrors(0)}, 200},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(input), tt.opts...)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if tt.expected == 200 {
+			if len(errors) != 200 {
+				t.Errorf("wrong number of errors without a limit. got=%d", len(errors))
+			}
+			continue
+		}
+		if len(errors) != tt.expected+1 {
+			t.Fatalf("wrong number of errors. expected=%d, got=%d", tt.expected+1, len(errors))
+		}
+		if last := errors[len(errors)-1]; last != fmt.Sprintf("too many errors, stopped after %d", tt.expected) {
+			t.Errorf("wrong last error. got=%q", last)
+		}
+	}
+
+	p := New(lexer.New("let = 1; let y = 2;"), MaxErrors(1))
+	program := p.ParseProgram()
+	if len(program.Statements) > 1 {
+		t.Errorf("parser kept reading after too many errors. got %d statements", len(program.Statements))
+	}
+}
+
+func TestRegisterParseFunctions(t *testing.T) {
+	// `@x` is shorthand for `inspect(x)`.
+	p := New(lexer.New("@x + 1; @-f(2)"))
+	p.RegisterPrefix(token.ILLEGAL, func() ast.Expression {
+		tok := p.CurToken()
+		p.NextToken()
+		return &ast.CallExpression{
+			Token:     tok,
+			Function:  &ast.Identifier{Token: tok, Value: "inspect"},
+			Arguments: []ast.Expression{p.ParseExpression(PREFIX)},
+		}
+	})
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if actual := program.String(); actual != "(inspect(x) + 1)inspect((-f(2)))" {
+		t.Errorf("wrong program. got=%q", actual)
+	}
+
+	// `a # b` binds like `*`.
+	p = New(lexer.New("1 + a # b * c"))
+	p.RegisterInfix(token.ILLEGAL, func(left ast.Expression) ast.Expression {
+		expression := &ast.InfixExpression{Token: p.CurToken(), Operator: p.CurToken().Literal, Left: left}
+		p.NextToken()
+		expression.Right = p.ParseExpression(PRODUCT)
+		return expression
+	})
+	p.SetPrecedence(token.ILLEGAL, PRODUCT)
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if actual := program.String(); actual != "(1 + ((a # b) * c))" {
+		t.Errorf("wrong program. got=%q", actual)
+	}
+
+	// Other parsers are unaffected.
+	p = New(lexer.New("@x"))
+	p.ParseProgram()
+	if len(p.Errors()) != 1 || p.Errors()[0] != "unexpected character '@' at 1:1" {
+		t.Errorf("wrong errors. got=%q", p.Errors())
+	}
+}
+
+func TestReset(t *testing.T) {
+	p := New(lexer.New("let = 1; for (x in xs) {"), MaxErrors(1))
+	p.ParseProgram()
+	first := p.Errors()
+	if len(first) != 2 || first[1] != "too many errors, stopped after 1" {
+		t.Fatalf("wrong errors for first program. got=%q", first)
+	}
+
+	p.Reset(lexer.New("let x = 1; x * 2"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if actual := program.String(); actual != "let x = 1;(x * 2)" {
+		t.Errorf("wrong second program. got=%q", actual)
+	}
+	if len(first) != 2 {
+		t.Errorf("errors of first program changed. got=%q", first)
+	}
+
+	p.Reset(lexer.New("break; let y = ;"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 2 || errors[0] != "break outside loop" {
+		t.Errorf("wrong errors for third program. got=%q", errors)
+	}
+}
@@ -14,25 +14,69 @@ import (
 	"leopard/lexer"
 	"leopard/object"
 	"leopard/parser"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+// DefaultWrapWidth is the length of a result's inspected form above which
+// collections are printed across multiple lines, unless configured
+// otherwise with WrapWidth.
+const DefaultWrapWidth = 80
+
+// config holds the settings of a REPL session.
+type config struct {
+	wrapWidth int
+}
+
+// Option configures the REPL started by Start.
+type Option func(*config)
+
+// WrapWidth makes the REPL print arrays, hashes and sets whose inspected
+// form is longer than n characters across multiple indented lines, in the
+// format of the `inspect` builtin. A width of 0 disables wrapping.
+func WrapWidth(n int) Option {
+	return func(c *config) {
+		c.wrapWidth = n
+	}
+}
+
 // Start initializes the REPL, reading from the provided input and writing
 // results to the provided output. It continues until EOF is reached.
-func Start(in io.Reader, out io.Writer) {
+//
+// Each result is bound in the session to `_` and to `_` followed by the
+// number of the line that produced it, as in `_3`, so later lines can use it.
+//
+// A line starting with ":ast " prints how the rest of the line parses, as
+// PrintAST does, instead of evaluating it, and one starting with ":tokens "
+// prints its tokens, as PrintTokens does.
+func Start(in io.Reader, out io.Writer, opts ...Option) {
+	cfg := config{wrapWidth: DefaultWrapWidth}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	e := evaluator.New()
 
-	for {
+	for line := 1; ; line++ {
 		fmt.Fprintf(out, PROMPT)
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
+		if source, ok := strings.CutPrefix(scanner.Text(), ":ast "); ok {
+			PrintAST(out, source)
+			continue
+		}
+		if source, ok := strings.CutPrefix(scanner.Text(), ":tokens "); ok {
+			PrintTokens(out, source)
+			continue
+		}
+
+		l := lexer.New(scanner.Text())
 		p := parser.New(l)
 
 		program := p.ParseProgram()
@@ -40,12 +84,59 @@ func Start(in io.Reader, out io.Writer) {
 			printParserErrors(out, p.Errors())
 			continue
 		}
+		for _, msg := range p.Warnings() {
+			io.WriteString(out, "warning: "+msg+"\n")
+		}
 
-		evaluated := evaluator.Eval(program, env)
+		evaluated := e.Eval(program, env)
 		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
+			io.WriteString(out, format(evaluated, cfg.wrapWidth))
 			io.WriteString(out, "\n")
 		}
+		if evaluated != nil && evaluated.Type() != object.ERROR_OBJ {
+			env.Set("_", evaluated)
+			env.Set(fmt.Sprintf("_%d", line), evaluated)
+		}
+	}
+}
+
+// PrintAST parses source and writes each statement on its own line in the
+// fully parenthesized form of its String method, so 1 + 2 * 3 is printed
+// as (1 + (2 * 3)). Parser errors are written instead if there are any.
+func PrintAST(out io.Writer, source string) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return
+	}
+
+	for _, stmt := range program.Statements {
+		io.WriteString(out, stmt.String()+"\n")
+	}
+}
+
+// PrintTokens lexes source and writes each of its tokens, up to and
+// including EOF, on its own line with its position, type and quoted literal.
+func PrintTokens(out io.Writer, source string) {
+	for _, tok := range lexer.Tokens(source) {
+		fmt.Fprintf(out, "%d:%d %s %q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+	}
+}
+
+// format returns the text printed for a result, wrapping collections whose
+// inspected form is longer than width.
+func format(obj object.Object, width int) string {
+	inspected := obj.Inspect()
+	if width <= 0 || len(inspected) <= width {
+		return inspected
+	}
+
+	switch obj.(type) {
+	case *object.Array, *object.Hash, *object.Set:
+		return object.Describe(obj)
+	default:
+		return inspected
 	}
 }
 
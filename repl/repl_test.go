@@ -0,0 +1,99 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrapWidth(t *testing.T) {
+	input := "[1, 2, 3]\n[100000, 200000, 300000]\n\"a long string that is not a collection\"\n"
+
+	tests := []struct {
+		opts     []Option
+		expected string
+	}{
+		{
+			[]Option{WrapWidth(0)},
+			">> [1, 2, 3]\n>> [100000, 200000, 300000]\n>> a long string that is not a collection\n>> ",
+		},
+		{
+			[]Option{WrapWidth(20)},
+			">> [1, 2, 3]\n" +
+				">> ARRAY(3) [\n  INTEGER 100000\n  INTEGER 200000\n  INTEGER 300000\n]\n" +
+				">> a long string that is not a collection\n>> ",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, tt.opts...)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output.\nexpected=%q\ngot=%q", tt.expected, out.String())
+		}
+	}
+}
+
+func TestResultHistory(t *testing.T) {
+	input := "2 + 3\n_ * 2\nlet x = 1;\nmissing\n_1 + _2 + _\n"
+	expected := ">> 5\n>> 10\n>> >> ERROR: identifier not found: missing\n>> 25\n>> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestPrintAST(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "(1 + (2 * 3))\n"},
+		{"let x = -a * b; x == 1 < 2", "let x = ((-a) * b);\n(x == (1 < 2))\n"},
+		{"let = 1", "Parser errors:\n\texpected next token to be IDENT, got = instead\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		PrintAST(&out, tt.input)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	Start(strings.NewReader(":ast 1 + 2 * 3\n"), &out)
+	if expected := ">> (1 + (2 * 3))\n>> "; out.String() != expected {
+		t.Errorf("wrong output for :ast.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestPrintTokens(t *testing.T) {
+	var out bytes.Buffer
+	PrintTokens(&out, "let s = \"hi\";\nx?.y")
+
+	expected := `1:1 LET "let"
+1:5 IDENT "s"
+1:7 = "="
+1:9 STRING "hi"
+1:13 ; ";"
+2:1 IDENT "x"
+2:2 ?. "?."
+2:4 IDENT "y"
+2:5 EOF ""
+`
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":tokens 1.5\n"), &out)
+	if expected := ">> 1:1 FLOAT \"1.5\"\n1:4 EOF \"\"\n>> "; out.String() != expected {
+		t.Errorf("wrong output for :tokens.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
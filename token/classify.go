@@ -0,0 +1,66 @@
+package token
+
+// Category is the kind of a token for syntax highlighting.
+type Category string
+
+// Token categories.
+const (
+	Keyword     Category = "keyword"
+	Identifier  Category = "identifier"
+	Number      Category = "number"
+	String      Category = "string"
+	Operator    Category = "operator"
+	Comment     Category = "comment"
+	Punctuation Category = "punctuation"
+	Invalid     Category = "invalid"
+)
+
+// categories maps the token types that are not keywords to their category.
+var categories = map[TokenType]Category{
+	IDENT:  Identifier,
+	INT:    Number,
+	FLOAT:  Number,
+	STRING: String,
+
+	ASSIGN:      Operator,
+	PLUS:        Operator,
+	MINUS:       Operator,
+	BANG:        Operator,
+	ASTERISK:    Operator,
+	SLASH:       Operator,
+	FLOOR_SLASH: Operator,
+	LT:          Operator,
+	GT:          Operator,
+	EQ:          Operator,
+	NOT_EQ:      Operator,
+	COALESCE:    Operator,
+
+	COMMA:     Punctuation,
+	SEMICOLON: Punctuation,
+	COLON:     Punctuation,
+	DOT:       Punctuation,
+	ELLIPSIS:  Punctuation,
+	LPAREN:    Punctuation,
+	RPAREN:    Punctuation,
+	LBRACE:    Punctuation,
+	RBRACE:    Punctuation,
+	LBRACKET:  Punctuation,
+	RBRACKET:  Punctuation,
+
+	QUESTION_DOT:      Punctuation,
+	QUESTION_LBRACKET: Punctuation,
+}
+
+// Classify returns the category of tok. Illegal tokens and EOF are
+// Invalid. The language has no comments yet, so no token is a Comment.
+func Classify(tok Token) Category {
+	for _, keyword := range keywords {
+		if tok.Type == keyword {
+			return Keyword
+		}
+	}
+	if category, ok := categories[tok.Type]; ok {
+		return category
+	}
+	return Invalid
+}
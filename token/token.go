@@ -6,14 +6,36 @@ including identifiers, literals, operators, delimiters, and keywords.
 */
 package token
 
+import "sort"
+
 // TokenType represents the type of a token.
 type TokenType string
 
 // Token represents a lexical token in the language, consisting of a type
-// and its literal string value.
+// and its literal string value. Line and Column give the 1-based position
+// of the token's first character in the source, or zero if unknown, and
+// Offset gives its 0-based byte offset.
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int
+	Column  int
+	Offset  int
+
+	// Raw is the source text of the token, quotes included, if it cannot
+	// be told from Literal, as for string literals with escape sequences.
+	Raw string
+}
+
+// Len returns the number of bytes the token spans in the source.
+func (t Token) Len() int {
+	if t.Raw != "" {
+		return len(t.Raw)
+	}
+	if t.Type == STRING {
+		return len(t.Literal) + 2
+	}
+	return len(t.Literal)
 }
 
 // Token type constants.
@@ -24,6 +46,7 @@ const (
 	// Identifiers + literals
 	IDENT  = "IDENT" // add, foobar, x, y, ..
 	INT    = "INT"   // 12345
+	FLOAT  = "FLOAT" // 3.14
 	STRING = "STRING"
 
 	// Operators.
@@ -34,16 +57,26 @@ const (
 	ASTERISK = "*"
 	SLASH    = "/"
 
+	FLOOR_SLASH = "//"
+
 	LT = "<"
 	GT = ">"
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	COALESCE = "??"
+
 	// Delimiters.
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	DOT       = "."
+	ELLIPSIS  = "..."
+
+	// Optional access, which yields null instead of failing on null.
+	QUESTION_DOT      = "?."
+	QUESTION_LBRACKET = "?["
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -60,18 +93,41 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	DEFER    = "DEFER"
+	YIELD    = "YIELD"
+	IN       = "IN"
+	FOR      = "FOR"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 )
 
 // keywords maps string representations of keywords to their corresponding
 // token types.
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"defer":    DEFER,
+	"yield":    YIELD,
+	"in":       IN,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+}
+
+// Keywords returns the language's keywords in alphabetical order.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	return words
 }
 
 // LookupIdent returns the TokenType associated with the given identifier.
@@ -0,0 +1,44 @@
+package token_test
+
+import (
+	"leopard/lexer"
+	"leopard/token"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	input := `let add = fn(x) { if (x != 1.5) { return x + 2; } "done" }; a.b[0] @`
+
+	expected := []token.Category{
+		token.Keyword, token.Identifier, token.Operator, token.Keyword, token.Punctuation,
+		token.Identifier, token.Punctuation, token.Punctuation, token.Keyword, token.Punctuation,
+		token.Identifier, token.Operator, token.Number, token.Punctuation, token.Punctuation,
+		token.Keyword, token.Identifier, token.Operator, token.Number, token.Punctuation,
+		token.Punctuation, token.String, token.Punctuation, token.Punctuation, token.Identifier,
+		token.Punctuation, token.Identifier, token.Punctuation, token.Number, token.Punctuation,
+		token.Invalid, token.Invalid,
+	}
+
+	l := lexer.New(input)
+	for i, category := range expected {
+		tok := l.NextToken()
+		if got := token.Classify(tok); got != category {
+			t.Errorf("tests[%d] - %q classified wrong. expected=%s, got=%s", i, tok.Literal, category, got)
+		}
+	}
+
+	tokens := []struct {
+		input    string
+		expected token.Category
+	}{
+		{"...", token.Punctuation},
+		{"//", token.Operator},
+	}
+
+	for _, tt := range tokens {
+		tok := lexer.New(tt.input).NextToken()
+		if got := token.Classify(tok); got != tt.expected {
+			t.Errorf("%q classified wrong. expected=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}